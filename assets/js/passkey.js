@@ -0,0 +1,100 @@
+// Runs the WebAuthn ceremonies of the forms with a data-passkey attribute:
+// "register" adds a passkey to the logged in user and "login" logs in with
+// one. The form action starts the ceremony and data-finish completes it.
+(function () {
+  "use strict";
+
+  function decode(value) {
+    const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+    const binary = atob(base64.padEnd(base64.length + ((4 - (base64.length % 4)) % 4), "="));
+    return Uint8Array.from(binary, (c) => c.charCodeAt(0));
+  }
+
+  function encode(buffer) {
+    const binary = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  }
+
+  async function post(form, url, body) {
+    const response = await fetch(url, {
+      method: "POST",
+      credentials: "same-origin",
+      headers: {
+        "Content-Type": "application/json",
+        "X-CSRF-Token": form.elements.csrf.value,
+      },
+      body: JSON.stringify(body || {}),
+    });
+    const data = await response.json();
+    if (!response.ok) {
+      throw new Error(data.error || response.statusText);
+    }
+    return data;
+  }
+
+  async function register(form) {
+    const options = (await post(form, form.action)).publicKey;
+    options.challenge = decode(options.challenge);
+    options.user.id = decode(options.user.id);
+    (options.excludeCredentials || []).forEach((c) => (c.id = decode(c.id)));
+    const credential = await navigator.credentials.create({ publicKey: options });
+    const response = credential.response;
+    const name = form.elements.name ? form.elements.name.value : "";
+    return post(form, form.dataset.finish + "?name=" + encodeURIComponent(name), {
+      id: credential.id,
+      rawId: encode(credential.rawId),
+      type: credential.type,
+      authenticatorAttachment: credential.authenticatorAttachment,
+      response: {
+        clientDataJSON: encode(response.clientDataJSON),
+        attestationObject: encode(response.attestationObject),
+        transports: response.getTransports ? response.getTransports() : [],
+      },
+    });
+  }
+
+  async function login(form) {
+    const options = (await post(form, form.action)).publicKey;
+    options.challenge = decode(options.challenge);
+    (options.allowCredentials || []).forEach((c) => (c.id = decode(c.id)));
+    const credential = await navigator.credentials.get({ publicKey: options });
+    const response = credential.response;
+    return post(form, form.dataset.finish, {
+      id: credential.id,
+      rawId: encode(credential.rawId),
+      type: credential.type,
+      authenticatorAttachment: credential.authenticatorAttachment,
+      response: {
+        clientDataJSON: encode(response.clientDataJSON),
+        authenticatorData: encode(response.authenticatorData),
+        signature: encode(response.signature),
+        userHandle: response.userHandle ? encode(response.userHandle) : null,
+      },
+    });
+  }
+
+  const ceremonies = { register: register, login: login };
+
+  document.querySelectorAll("form[data-passkey]").forEach((form) => {
+    if (!window.PublicKeyCredential) {
+      return;
+    }
+    const error = form.querySelector(".passkey-error");
+    form.hidden = false;
+    document.querySelectorAll(".passkey-unsupported").forEach((e) => (e.hidden = true));
+    form.addEventListener("submit", async (event) => {
+      event.preventDefault();
+      error.hidden = true;
+      try {
+        const result = await ceremonies[form.dataset.passkey](form);
+        window.location.assign(result.redirect);
+      } catch (e) {
+        // The user closing the browser prompt is not an error worth showing
+        if (e.name !== "NotAllowedError" && e.name !== "AbortError") {
+          error.textContent = e.message;
+          error.hidden = false;
+        }
+      }
+    });
+  });
+})();
@@ -0,0 +1,2 @@
+alter table config add column theme text not null default 'default';
+alter table config add column custom_css text not null default '';
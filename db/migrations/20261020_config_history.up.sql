@@ -0,0 +1,3 @@
+alter table config add column created_by text not null default '';
+
+update config set created_by = admin_user_id;
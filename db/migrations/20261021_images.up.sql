@@ -0,0 +1,15 @@
+create table if not exists images (
+    image_id text primary key,
+    user_id text not null,
+    filename text not null,
+    content_type text not null,
+    data blob not null,
+    created_at datetime not null default current_timestamp,
+    constraint images_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
+
+create index images_user_id_idx on images (user_id);
+
+-- The genesis configuration pointed to images that were never shipped
+update config set image_home = '' where image_home = 'static/images/house.png';
+update config set favicon_home = '' where favicon_home = 'static/images/cowboy.ico';
@@ -0,0 +1,25 @@
+create table if not exists sites (
+    site_id text primary key,
+    hostname text not null,
+    enable_signup boolean not null default false,
+    created_at datetime not null default current_timestamp,
+    updated_at datetime not null default current_timestamp
+);
+
+create unique index sites_hostname_idx on sites (hostname);
+
+-- The default site answers every host without a site of its own, so existing data keeps being served
+insert into sites (site_id, hostname) values ('default', '');
+
+alter table posts add column site_id text not null default 'default';
+alter table users add column site_id text not null default 'default';
+alter table config add column site_id text not null default 'default';
+alter table images add column site_id text not null default 'default';
+
+create index posts_site_id_idx on posts (site_id);
+create index config_site_id_idx on config (site_id);
+create index images_site_id_idx on images (site_id);
+
+-- Usernames are unique per site
+drop index usersname_unique_idx;
+create unique index users_site_id_username_idx on users (site_id, username);
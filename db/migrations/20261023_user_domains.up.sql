@@ -0,0 +1,12 @@
+create table if not exists user_domains (
+    user_id text primary key,
+    site_id text not null,
+    domain text not null,
+    token text not null,
+    verified_at datetime,
+    created_at datetime not null default current_timestamp,
+    constraint user_domains_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
+
+-- Several users may claim a domain, only one can prove they own it
+create unique index user_domains_verified_domain_idx on user_domains (domain) where verified_at is not null;
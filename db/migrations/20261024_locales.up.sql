@@ -0,0 +1,2 @@
+alter table config add column locale text not null default 'en';
+alter table users add column locale text not null default '';
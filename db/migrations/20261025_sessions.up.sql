@@ -0,0 +1,14 @@
+create table if not exists sessions (
+    session_id text primary key,
+    site_id text not null,
+    user_id text not null,
+    user_agent text not null default '',
+    ip text not null default '',
+    created_at datetime not null default current_timestamp,
+    last_seen_at datetime not null default current_timestamp,
+    expires_at datetime not null,
+    revoked_at datetime,
+    constraint sessions_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
+
+create index sessions_user_id_idx on sessions (user_id);
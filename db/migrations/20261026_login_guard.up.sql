@@ -0,0 +1,21 @@
+create table if not exists login_failures (
+    site_id text not null,
+    username text not null,
+    failures integer not null default 0,
+    locked_until datetime,
+    updated_at datetime not null default current_timestamp,
+    primary key (site_id, username)
+);
+
+create table if not exists login_events (
+    event_id text primary key,
+    site_id text not null,
+    username text not null,
+    user_id text not null default '',
+    ip text not null default '',
+    event text not null,
+    actor_id text not null default '',
+    created_at datetime not null default current_timestamp
+);
+
+create index login_events_site_id_created_at_idx on login_events (site_id, created_at);
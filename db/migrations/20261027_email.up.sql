@@ -0,0 +1,16 @@
+alter table users add column email_verified_at datetime;
+
+-- Emails identify accounts when resetting passwords
+create unique index users_site_id_email_idx on users (site_id, email) where email is not null;
+
+create table if not exists user_tokens (
+    token_hash text primary key,
+    site_id text not null,
+    user_id text not null,
+    purpose text not null,
+    email text not null default '',
+    expires_at datetime not null,
+    used_at datetime,
+    created_at datetime not null default current_timestamp,
+    constraint user_tokens_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
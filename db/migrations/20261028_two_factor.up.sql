@@ -0,0 +1,16 @@
+create table if not exists two_factor (
+    user_id text primary key,
+    secret text not null,
+    enabled_at datetime,
+    last_step integer not null default 0,
+    created_at datetime not null default current_timestamp,
+    constraint two_factor_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
+
+create table if not exists recovery_codes (
+    code_hash text not null,
+    user_id text not null,
+    used_at datetime,
+    primary key (user_id, code_hash),
+    constraint recovery_codes_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
@@ -0,0 +1,18 @@
+create table if not exists passkeys (
+    credential_id text primary key,
+    site_id text not null,
+    user_id text not null,
+    name text not null,
+    public_key blob not null,
+    attestation_type text not null default '',
+    aaguid blob,
+    sign_count integer not null default 0,
+    transports text not null default '',
+    backup_eligible boolean not null default false,
+    backup_state boolean not null default false,
+    created_at datetime not null default current_timestamp,
+    last_used_at datetime,
+    constraint passkeys_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
+
+create index passkeys_user_id_idx on passkeys (user_id);
@@ -0,0 +1,14 @@
+create table if not exists identities (
+    identity_id text primary key,
+    site_id text not null,
+    user_id text not null,
+    issuer text not null,
+    subject text not null,
+    email text not null default '',
+    created_at datetime not null default current_timestamp,
+    last_login_at datetime,
+    constraint identities_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
+
+create unique index identities_site_id_issuer_subject_idx on identities (site_id, issuer, subject);
+create index identities_user_id_idx on identities (user_id);
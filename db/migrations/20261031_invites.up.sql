@@ -0,0 +1,29 @@
+alter table config add column signup_mode text not null default 'closed';
+alter table config add column inviters text not null default 'admin';
+update config set signup_mode = 'open' where site_id in (select site_id from sites where enable_signup is true);
+
+create table if not exists invites (
+    code text primary key,
+    site_id text not null,
+    created_by text not null,
+    max_uses integer not null default 1,
+    uses integer not null default 0,
+    expires_at datetime not null,
+    revoked_at datetime,
+    created_at datetime not null default current_timestamp,
+    constraint invites_created_by_FK foreign key (created_by) references users(user_id) on delete cascade
+);
+
+create index invites_created_by_idx on invites (created_by);
+
+create table if not exists invitees (
+    user_id text primary key,
+    site_id text not null,
+    inviter_id text,
+    invite_code text not null,
+    created_at datetime not null default current_timestamp,
+    constraint invitees_user_id_FK foreign key (user_id) references users(user_id) on delete cascade,
+    constraint invitees_inviter_id_FK foreign key (inviter_id) references users(user_id) on delete set null
+);
+
+create index invitees_inviter_id_idx on invitees (inviter_id);
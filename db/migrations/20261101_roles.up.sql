@@ -0,0 +1,72 @@
+create table if not exists permissions (
+    name text primary key
+);
+
+insert into permissions (name) values
+    ('config.manage'),
+    ('users.manage'),
+    ('roles.manage'),
+    ('posts.create'),
+    ('posts.edit_any'),
+    ('invites.create');
+
+create table if not exists roles (
+    role_id text primary key,
+    site_id text not null,
+    name text not null,
+    created_at datetime not null default current_timestamp
+);
+
+create unique index roles_site_id_name_idx on roles (site_id, name);
+
+create table if not exists role_permissions (
+    role_id text not null,
+    permission text not null,
+    primary key (role_id, permission),
+    constraint role_permissions_role_id_FK foreign key (role_id) references roles(role_id) on delete cascade,
+    constraint role_permissions_permission_FK foreign key (permission) references permissions(name) on delete cascade
+);
+
+create table if not exists user_roles (
+    user_id text not null,
+    role_id text not null,
+    primary key (user_id, role_id),
+    constraint user_roles_user_id_FK foreign key (user_id) references users(user_id) on delete cascade,
+    constraint user_roles_role_id_FK foreign key (role_id) references roles(role_id) on delete cascade
+);
+
+create index user_roles_role_id_idx on user_roles (role_id);
+
+-- Every site starts with the same roles, new sites get them from domain.DefaultRoles
+insert into roles (role_id, site_id, name)
+select lower(hex(randomblob(16))), sites.site_id, defaults.name from sites, (
+    select 'admin' as name union all
+    select 'moderator' union all
+    select 'author' union all
+    select 'reader'
+) defaults;
+
+insert into role_permissions (role_id, permission)
+select roles.role_id, defaults.permission from roles join (
+    select 'admin' as name, 'config.manage' as permission union all
+    select 'admin', 'users.manage' union all
+    select 'admin', 'roles.manage' union all
+    select 'admin', 'posts.create' union all
+    select 'admin', 'posts.edit_any' union all
+    select 'admin', 'invites.create' union all
+    select 'moderator', 'posts.create' union all
+    select 'moderator', 'posts.edit_any' union all
+    select 'moderator', 'invites.create' union all
+    select 'author', 'posts.create'
+) defaults on defaults.name = roles.name;
+
+-- The admin of each site keeps managing it, and everybody else keeps posting
+insert into user_roles (user_id, role_id)
+select config.admin_user_id, roles.role_id from config
+join roles on roles.site_id = config.site_id and roles.name = 'admin'
+where config.active is true and config.admin_user_id in (select user_id from users);
+
+insert into user_roles (user_id, role_id)
+select users.user_id, roles.role_id from users
+join roles on roles.site_id = users.site_id and roles.name = 'author'
+where users.user_id not in (select user_id from user_roles);
@@ -0,0 +1,4 @@
+alter table users add column suspended_at datetime;
+alter table users add column password_reset_required boolean not null default false;
+
+create index login_events_user_id_event_idx on login_events (user_id, event);
@@ -0,0 +1,12 @@
+alter table users add column theme text not null default '';
+
+create table if not exists username_redirects (
+    site_id text not null,
+    username text not null,
+    user_id text not null,
+    created_at datetime not null default current_timestamp,
+    primary key (site_id, username),
+    constraint username_redirects_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
+
+create index username_redirects_user_id_idx on username_redirects (user_id);
@@ -0,0 +1,14 @@
+create table if not exists access_tokens (
+    token_id text primary key,
+    site_id text not null,
+    user_id text not null,
+    name text not null,
+    hash text not null unique,
+    scopes text not null,
+    created_at datetime not null default current_timestamp,
+    last_used_at datetime,
+    revoked_at datetime,
+    constraint access_tokens_user_id_FK foreign key (user_id) references users(user_id) on delete cascade
+);
+
+create index access_tokens_user_id_idx on access_tokens (user_id);
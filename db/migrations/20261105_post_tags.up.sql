@@ -0,0 +1,8 @@
+create table if not exists post_tags (
+    post_id text not null,
+    tag text not null,
+    primary key (post_id, tag),
+    constraint post_tags_post_id_FK foreign key (post_id) references posts(post_id) on delete cascade
+);
+
+create index post_tags_tag_idx on post_tags (tag);
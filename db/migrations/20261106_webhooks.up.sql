@@ -0,0 +1,31 @@
+create table if not exists webhooks (
+    webhook_id text primary key,
+    site_id text not null,
+    url text not null,
+    secret text not null,
+    events text not null,
+    active boolean not null default true,
+    created_at datetime not null default current_timestamp,
+    constraint webhooks_site_id_FK foreign key (site_id) references sites(site_id) on delete cascade
+);
+
+create index webhooks_site_id_idx on webhooks (site_id);
+
+create table if not exists webhook_deliveries (
+    delivery_id text primary key,
+    site_id text not null,
+    webhook_id text not null,
+    event text not null,
+    payload blob not null,
+    status text not null,
+    attempts integer not null default 0,
+    next_attempt_at datetime,
+    last_attempt_at datetime,
+    response_status integer not null default 0,
+    error text not null default '',
+    created_at datetime not null default current_timestamp,
+    constraint webhook_deliveries_webhook_id_FK foreign key (webhook_id) references webhooks(webhook_id) on delete cascade
+);
+
+create index webhook_deliveries_webhook_id_idx on webhook_deliveries (webhook_id);
+create index webhook_deliveries_status_idx on webhook_deliveries (status, next_attempt_at);
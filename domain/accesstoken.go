@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Scopes an access token can grant.
+const (
+	ScopeReadPosts    = "posts.read"
+	ScopeWritePosts   = "posts.write"
+	ScopeUploadImages = "images.upload"
+)
+
+// Scopes lists every scope, in the order they are shown to users.
+var Scopes = []string{ScopeReadPosts, ScopeWritePosts, ScopeUploadImages}
+
+// AccessTokenPrefix starts every access token, so they are told apart from
+// session JWTs and easy to spot in leaked files.
+const AccessTokenPrefix = "byd_"
+
+// AccessToken is a personal token a user creates for their scripts, which
+// send it as "Authorization: Bearer <token>". It only acts as the user on
+// the routes its scopes allow. Only its hash is stored.
+type AccessToken struct {
+	ID     string
+	SiteID string
+	UserID string
+	// Name reminds the user what the token is for, like "Publish script".
+	Name       string
+	Hash       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (t AccessToken) Allows(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+type AccessTokenRepository interface {
+	// ListByUser returns the tokens of a user that were not revoked, newest
+	// first.
+	ListByUser(ctx context.Context, siteID string, userID string) ([]AccessToken, error)
+	// GetByHash returns the token with the hash if it was not revoked.
+	GetByHash(ctx context.Context, siteID string, hash string) (AccessToken, error)
+	Create(ctx context.Context, t AccessToken) error
+	// Touch records that the token was used.
+	Touch(ctx context.Context, id string, usedAt time.Time) error
+	Revoke(ctx context.Context, siteID string, userID string, id string) error
+}
@@ -1,19 +1,94 @@
 package domain
 
 import (
+	"context"
 	"time"
 )
 
+// Sign-up modes of a site.
+const (
+	SignupClosed = "closed"
+	SignupOpen   = "open"
+	// SignupInvite only lets people with an invite code sign up.
+	SignupInvite = "invite"
+)
+
+// Who may create invite codes.
+const (
+	InvitersUsers = "users"
+	// InvitersAdmin only lets users whose role allows it create invites.
+	InvitersAdmin = "admin"
+)
+
 type Config struct {
-	ID              string
-	Title           string
-	Description     string
-	ImageHome       string
-	Favicon         string
-	Footer          string
+	ID          string
+	SiteID      string
+	Title       string
+	Description string
+	ImageHome   string
+	Favicon     string
+	Footer      string
+	Theme       string
+	CustomCSS   string
+	// Locale is the language used when the visitor has no preference.
+	Locale string
+	// SignupMode is one of SignupClosed, SignupOpen or SignupInvite.
+	SignupMode string
+	// Inviters is InvitersUsers or InvitersAdmin.
+	Inviters        string
 	BackyardVersion string
 	Active          bool
-	AdminUserID     string
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	// AdminUserID is the user that set up the site. What users can do is
+	// decided by their roles.
+	AdminUserID string
+	// CreatedBy is the user who saved this version of the configuration.
+	CreatedBy string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FieldChange is a configuration field whose value differs between two
+// versions. Field is the name of the field in the configuration form.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Diff returns the fields changed from prev to c.
+func (c Config) Diff(prev Config) []FieldChange {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"title", prev.Title, c.Title},
+		{"description", prev.Description, c.Description},
+		{"image_home", prev.ImageHome, c.ImageHome},
+		{"favicon", prev.Favicon, c.Favicon},
+		{"footer", prev.Footer, c.Footer},
+		{"theme", prev.Theme, c.Theme},
+		{"custom_css", prev.CustomCSS, c.CustomCSS},
+		{"locale", prev.Locale, c.Locale},
+		{"signup_mode", prev.SignupMode, c.SignupMode},
+		{"inviters", prev.Inviters, c.Inviters},
+		{"backyard_version", prev.BackyardVersion, c.BackyardVersion},
+	}
+	changes := []FieldChange{}
+	for _, f := range fields {
+		if f.old != f.new {
+			changes = append(changes, FieldChange{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	return changes
+}
+
+type ConfigRepository interface {
+	// GetActive returns the configuration currently in use by the site.
+	GetActive(ctx context.Context, siteID string) (Config, error)
+	GetByID(ctx context.Context, siteID string, id string) (Config, error)
+	// List returns every version of the site configuration, newest first.
+	List(ctx context.Context, siteID string) ([]Config, error)
+	// Save deactivates the active configuration of c.SiteID and stores c as
+	// the new active one in a single transaction.
+	Save(ctx context.Context, c Config) error
 }
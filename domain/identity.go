@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Identity links a user to their account at an external OpenID Connect
+// provider, so they can log in there instead of with a password.
+type Identity struct {
+	ID     string
+	SiteID string
+	UserID string
+	// Issuer and Subject identify the account at the provider. The subject
+	// never changes, unlike the email or username.
+	Issuer  string
+	Subject string
+	// Email is the address the provider reported at the last login.
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+type IdentityRepository interface {
+	GetBySubject(ctx context.Context, siteID string, issuer string, subject string) (Identity, error)
+	// ListByUser returns the identities linked to a user, oldest first.
+	ListByUser(ctx context.Context, userID string) ([]Identity, error)
+	Create(ctx context.Context, i Identity) error
+	// RecordLogin stores the email reported by the provider on a login.
+	RecordLogin(ctx context.Context, id string, email string, at time.Time) error
+	Delete(ctx context.Context, userID string, id string) error
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type Image struct {
+	ID          string
+	SiteID      string
+	UserID      string
+	Filename    string
+	ContentType string
+	Data        []byte
+	CreatedAt   time.Time
+}
+
+// URL returns the path the image is served at.
+func (i Image) URL() string {
+	return "/media/" + i.ID
+}
+
+type ImageRepository interface {
+	Create(ctx context.Context, i Image) error
+	GetByID(ctx context.Context, siteID string, id string) (Image, error)
+	// List returns every image of the site without its data, newest first.
+	List(ctx context.Context, siteID string) ([]Image, error)
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Invite is a code that lets people sign up while the site is invite-only.
+type Invite struct {
+	Code      string
+	SiteID    string
+	CreatedBy string
+	// MaxUses is how many people can sign up with the code.
+	MaxUses   int
+	Uses      int
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Usable reports if someone can still sign up with the invite.
+func (i Invite) Usable(now time.Time) bool {
+	return i.RevokedAt == nil && i.Uses < i.MaxUses && now.Before(i.ExpiresAt)
+}
+
+// Invitee records who invited a user, building the invite tree of a site.
+type Invitee struct {
+	UserID string
+	SiteID string
+	// InviterID is empty once the inviter is deleted.
+	InviterID  string
+	InviteCode string
+	CreatedAt  time.Time
+}
+
+type InviteRepository interface {
+	GetByCode(ctx context.Context, siteID string, code string) (Invite, error)
+	// ListByCreator returns the invites created by a user, newest first.
+	ListByCreator(ctx context.Context, siteID string, userID string) ([]Invite, error)
+	Create(ctx context.Context, i Invite) error
+	Revoke(ctx context.Context, siteID string, userID string, code string) error
+	// Redeem uses the invite once. It returns ErrNotFound if the invite does
+	// not exist or is no longer usable.
+	Redeem(ctx context.Context, siteID string, code string, now time.Time) (Invite, error)
+	AddInvitee(ctx context.Context, i Invitee) error
+	// ListInvitees returns every invited user of the site, oldest first.
+	ListInvitees(ctx context.Context, siteID string) ([]Invitee, error)
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// LoginFailure counts the consecutive failed logins with a username. It is
+// kept for any username, registered or not, so locked out usernames do not
+// reveal which accounts exist.
+type LoginFailure struct {
+	SiteID      string
+	Username    string
+	Failures    int
+	LockedUntil *time.Time
+	UpdatedAt   time.Time
+}
+
+func (f LoginFailure) Locked(now time.Time) bool {
+	return f.LockedUntil != nil && now.Before(*f.LockedUntil)
+}
+
+const (
+	LoginEventSuccess = "success"
+	LoginEventFailure = "failure"
+	LoginEventLockout = "lockout"
+	LoginEventUnlock  = "unlock"
+	// LoginEventTwoFactorReset is recorded when an admin turns off the
+	// two-factor authentication of a user.
+	LoginEventTwoFactorReset = "2fa_reset"
+	// Events recorded when an admin manages a user.
+	LoginEventSuspend       = "suspend"
+	LoginEventUnsuspend     = "unsuspend"
+	LoginEventPasswordReset = "password_reset"
+	LoginEventDelete        = "delete"
+)
+
+// LoginEvent is an entry of the login audit log.
+type LoginEvent struct {
+	ID       string
+	SiteID   string
+	Username string
+	// UserID is empty when the username does not belong to any user.
+	UserID string
+	IP     string
+	Event  string
+	// ActorID is the admin that caused the event, for unlocks.
+	ActorID   string
+	CreatedAt time.Time
+}
+
+type LoginRepository interface {
+	GetFailures(ctx context.Context, siteID string, username string) (LoginFailure, error)
+	// IncrementFailures adds a failed login to the username and returns the
+	// updated count.
+	IncrementFailures(ctx context.Context, siteID string, username string) (LoginFailure, error)
+	Lock(ctx context.Context, siteID string, username string, until time.Time) error
+	ClearFailures(ctx context.Context, siteID string, username string) error
+	// ListLocked returns the usernames locked out at the moment.
+	ListLocked(ctx context.Context, siteID string) ([]LoginFailure, error)
+	AddEvent(ctx context.Context, e LoginEvent) error
+	// ListEvents returns the latest limit events, newest first.
+	ListEvents(ctx context.Context, siteID string, limit int) ([]LoginEvent, error)
+	// LastLogins returns when each user of the site last logged in, keyed by
+	// user ID.
+	LastLogins(ctx context.Context, siteID string) (map[string]time.Time, error)
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Passkey is a WebAuthn credential a user registered to log in without a
+// password.
+type Passkey struct {
+	// ID is the base64url encoded credential ID chosen by the authenticator.
+	ID     string
+	SiteID string
+	UserID string
+	// Name tells the passkeys of a user apart, like "Laptop" or "Phone".
+	Name string
+	// PublicKey is the COSE encoded public key the assertions are verified with.
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	// SignCount is the signature counter of the last assertion, used to
+	// detect cloned authenticators.
+	SignCount  uint32
+	Transports []string
+	// BackupEligible and BackupState tell if the passkey is synced between
+	// devices.
+	BackupEligible bool
+	BackupState    bool
+	CreatedAt      time.Time
+	LastUsedAt     *time.Time
+}
+
+type PasskeyRepository interface {
+	GetByID(ctx context.Context, siteID string, id string) (Passkey, error)
+	// ListByUser returns the passkeys of a user, oldest first.
+	ListByUser(ctx context.Context, userID string) ([]Passkey, error)
+	Create(ctx context.Context, p Passkey) error
+	// Use records an assertion made with the passkey.
+	Use(ctx context.Context, id string, signCount uint32, backupState bool, usedAt time.Time) error
+	Delete(ctx context.Context, userID string, id string) error
+}
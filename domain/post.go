@@ -1,20 +1,104 @@
 package domain
 
 import (
+	"context"
+	"slices"
+	"strings"
 	"time"
 )
 
 type Post struct {
 	ID      string
+	SiteID  string
 	Title   string
 	Content string
 	Draft   bool
+	// Tags are normalized with NormalizeTags.
+	Tags []string
 	Access
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// Tag is a tag of the published posts of a site.
+type Tag struct {
+	Name string
+	// Posts is how many published posts have the tag.
+	Posts int
+}
+
+// NormalizeTags returns the tags trimmed and lower cased, sorted and without
+// empty or repeated ones.
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}
+
 type Access struct {
 	UserID   string
+	Username string
 	Relation string
 }
+
+const RelationAuthor = "AUTHOR"
+
+// Author returns the username of the post author, or an empty string if the
+// related user is not the author.
+func (p Post) Author() string {
+	if p.Access.Relation != RelationAuthor {
+		return ""
+	}
+	return p.Access.Username
+}
+
+// PostFilter selects a page of the posts of a site listed by the API.
+type PostFilter struct {
+	SiteID string
+	// AuthorID only selects the posts written by the user, if set.
+	AuthorID string
+	// Tag only selects the posts with the tag, if set.
+	Tag string
+	// AllDrafts also selects the drafts, and DraftsOf only the drafts written
+	// by the user, if set.
+	AllDrafts bool
+	DraftsOf  string
+	// Limit and Offset select a page of the posts, a zero Limit selects them
+	// all.
+	Limit  int
+	Offset int
+}
+
+type PostRepository interface {
+	// List returns the posts ordered by last update, newest first. Drafts are
+	// only included when includeDrafts is true.
+	List(ctx context.Context, siteID string, includeDrafts bool) ([]Post, error)
+	// ListByAuthor is like List, but only returns the posts written by userID.
+	ListByAuthor(ctx context.Context, siteID string, userID string, includeDrafts bool) ([]Post, error)
+	// Search returns the page of posts matching the filter ordered by last
+	// update, newest first.
+	Search(ctx context.Context, filter PostFilter) ([]Post, error)
+	// Count returns how many posts match the filter, ignoring its page.
+	Count(ctx context.Context, filter PostFilter) (int, error)
+	GetByID(ctx context.Context, siteID string, id string) (Post, error)
+	// Create stores the post and relates it to p.Access.UserID as its author.
+	Create(ctx context.Context, p Post) error
+	// Update replaces the title, content, draft state and tags of a post.
+	Update(ctx context.Context, p Post) error
+	Delete(ctx context.Context, siteID string, id string) error
+	// ListTags returns the tags of the published posts of a site by name.
+	ListTags(ctx context.Context, siteID string) ([]Tag, error)
+	IsAuthor(ctx context.Context, postID string, userID string) (bool, error)
+	// CountByAuthor returns how many posts each user of the site wrote, keyed
+	// by user ID. Drafts are only counted when includeDrafts is true.
+	CountByAuthor(ctx context.Context, siteID string, includeDrafts bool) (map[string]int, error)
+	// CountAll returns how many published posts and drafts there are on every
+	// site.
+	CountAll(ctx context.Context) (published int, drafts int, err error)
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Permissions are the named actions a role can allow. Each one is also a row
+// of the permissions table.
+const (
+	PermissionManageConfig  = "config.manage"
+	PermissionManageUsers   = "users.manage"
+	PermissionManageRoles   = "roles.manage"
+	PermissionCreatePosts   = "posts.create"
+	PermissionEditAnyPost   = "posts.edit_any"
+	PermissionCreateInvites = "invites.create"
+)
+
+// Names of the roles every site starts with.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleAuthor    = "author"
+	RoleReader    = "reader"
+)
+
+// RoleDefault is the role given to people when they sign up.
+const RoleDefault = RoleAuthor
+
+// DefaultRoles are the roles every site starts with, and what they allow.
+var DefaultRoles = []Role{
+	{Name: RoleAdmin, Permissions: []string{PermissionManageConfig, PermissionManageUsers, PermissionManageRoles, PermissionCreatePosts, PermissionEditAnyPost, PermissionCreateInvites}},
+	{Name: RoleModerator, Permissions: []string{PermissionCreatePosts, PermissionEditAnyPost, PermissionCreateInvites}},
+	{Name: RoleAuthor, Permissions: []string{PermissionCreatePosts}},
+	{Name: RoleReader, Permissions: []string{}},
+}
+
+// Role is a set of permissions given to users of a site.
+type Role struct {
+	ID          string
+	SiteID      string
+	Name        string
+	Permissions []string
+	CreatedAt   time.Time
+}
+
+// Allows reports if the role grants permission.
+func (r Role) Allows(permission string) bool {
+	return slices.Contains(r.Permissions, permission)
+}
+
+type RoleRepository interface {
+	// List returns the roles of a site with their permissions, by name.
+	List(ctx context.Context, siteID string) ([]Role, error)
+	// Create stores a role with its permissions.
+	Create(ctx context.Context, r Role) error
+	// ListByUser returns the roles given to a user.
+	ListByUser(ctx context.Context, userID string) ([]Role, error)
+	// HasPermission reports if any role of the user grants permission.
+	HasPermission(ctx context.Context, userID string, permission string) (bool, error)
+	// Assign gives a user the role of the site with the given name.
+	Assign(ctx context.Context, siteID string, userID string, roleName string) error
+	// SetUserRoles replaces the roles of a user with roleIDs, ignoring the
+	// ones that are not roles of the site.
+	SetUserRoles(ctx context.Context, siteID string, userID string, roleIDs []string) error
+	// ListUserRoles returns the role IDs of every user of the site that has
+	// some, keyed by user ID.
+	ListUserRoles(ctx context.Context, siteID string) (map[string][]string, error)
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Session is a login on one device. The authorization cookie references it,
+// so revoking the session logs the device out even if the cookie is still
+// valid.
+type Session struct {
+	ID         string
+	SiteID     string
+	UserID     string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// Live reports if the session can still be used to authenticate requests.
+func (s Session) Live(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+type SessionRepository interface {
+	GetByID(ctx context.Context, siteID string, id string) (Session, error)
+	// ListByUser returns the live sessions of a user, most recently seen first.
+	ListByUser(ctx context.Context, siteID string, userID string) ([]Session, error)
+	Create(ctx context.Context, s Session) error
+	Touch(ctx context.Context, siteID string, id string, lastSeen time.Time) error
+	Revoke(ctx context.Context, siteID string, userID string, id string) error
+	// RevokeAll revokes every session of a user except the one with ID keepID,
+	// which may be empty to revoke them all.
+	RevokeAll(ctx context.Context, siteID string, userID string, keepID string) error
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultSiteID is the site answering every host that has no site of its own.
+const DefaultSiteID = "default"
+
+// Site is one of the instances hosted by the process. Every post, user, image
+// and configuration belongs to a site.
+type Site struct {
+	ID           string
+	Hostname     string
+	EnableSignup bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// NewSite is a site with everything it needs before being served: an admin
+// user, its roles, among them the RoleAdmin one given to the admin, and its
+// first configuration.
+type NewSite struct {
+	Site   Site
+	Admin  User
+	Roles  []Role
+	Config Config
+}
+
+type SiteRepository interface {
+	GetByID(ctx context.Context, id string) (Site, error)
+	GetByHostname(ctx context.Context, hostname string) (Site, error)
+	List(ctx context.Context) ([]Site, error)
+	Create(ctx context.Context, s Site) error
+	// Provision creates a site together with its admin, roles and
+	// configuration. Either all of them are created or none.
+	Provision(ctx context.Context, s NewSite) error
+}
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// UserToken is a single use secret sent to a user, for example in a link by
+// email. Only its hash is stored, so a leaked database does not leak usable
+// tokens.
+type UserToken struct {
+	Hash    string
+	SiteID  string
+	UserID  string
+	Purpose string
+	// Email is the address the token was sent to.
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (t UserToken) Usable(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// HashToken returns the hash stored for a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type UserTokenRepository interface {
+	Create(ctx context.Context, t UserToken) error
+	// Get returns the token with the hash if it is still usable.
+	Get(ctx context.Context, siteID string, purpose string, hash string) (UserToken, error)
+	// Consume marks the token with the hash as used and returns it, if it was
+	// still usable. A token can only be consumed once.
+	Consume(ctx context.Context, siteID string, purpose string, hash string) (UserToken, error)
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// TwoFactor is the TOTP authenticator of a user. It is pending until the user
+// proves their authenticator app works by entering a code.
+type TwoFactor struct {
+	UserID string
+	// Secret is the base32 encoded TOTP secret shared with the authenticator app.
+	Secret    string
+	EnabledAt *time.Time
+	// LastStep is the time step of the last accepted code, so codes cannot be
+	// used twice.
+	LastStep  int64
+	CreatedAt time.Time
+}
+
+func (t TwoFactor) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userID string) (TwoFactor, error)
+	// SavePending stores a secret the user has not confirmed yet, replacing
+	// any previous one.
+	SavePending(ctx context.Context, t TwoFactor) error
+	// Enable turns two-factor authentication on and replaces the recovery
+	// codes with codeHashes.
+	Enable(ctx context.Context, userID string, codeHashes []string) error
+	// ReplaceRecoveryCodes replaces the recovery codes with codeHashes.
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	// Delete turns two-factor authentication off and removes the recovery codes.
+	Delete(ctx context.Context, userID string) error
+	// UseStep records the step of an accepted code. It returns ErrNotFound if
+	// the step is not after the last one used.
+	UseStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode marks a recovery code as used. It returns ErrNotFound if
+	// the code does not exist or was already used.
+	UseRecoveryCode(ctx context.Context, userID string, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userID string) (int, error)
+}
@@ -1,16 +1,32 @@
 package domain
 
 import (
+	"context"
 	"errors"
 	"time"
 )
 
 type User struct {
-	ID        string
-	Username  string
-	Email     *string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID       string
+	SiteID   string
+	Username string
+	Email    *string
+	// EmailVerifiedAt is set once the user opens the link sent to Email.
+	EmailVerifiedAt *time.Time
+	// Password holds the bcrypt hash, never the plain text password.
+	Password string
+	// Locale is the language the user picked, empty to use the browser one.
+	Locale string
+	// Theme is the theme the user sees the site with, empty to use the one of
+	// the site.
+	Theme string
+	// SuspendedAt is set while an admin keeps the user from logging in.
+	SuspendedAt *time.Time
+	// PasswordResetRequired makes the user choose a new password the next
+	// time they log in with the current one.
+	PasswordResetRequired bool
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
 }
 
 func (u User) ValidateEmail() error {
@@ -19,3 +35,69 @@ func (u User) ValidateEmail() error {
 	}
 	return nil
 }
+
+// User statuses admins can filter by.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+)
+
+// SignUp is a user signing up with their first role, and the invite code
+// they were given, if any.
+type SignUp struct {
+	User       User
+	Role       string
+	InviteCode string
+}
+
+// UserFilter selects the users of a site listed to admins.
+type UserFilter struct {
+	SiteID string
+	// Query matches part of the username or email, empty matches everyone.
+	Query string
+	// Status is UserStatusActive, UserStatusSuspended or empty for both.
+	Status string
+}
+
+type UserRepository interface {
+	GetByID(ctx context.Context, id string) (User, error)
+	GetByUsername(ctx context.Context, siteID string, username string) (User, error)
+	// List returns the users of a site by username.
+	List(ctx context.Context, siteID string) ([]User, error)
+	// Search returns the users matching the filter by username.
+	Search(ctx context.Context, filter UserFilter) ([]User, error)
+	UsernameExists(ctx context.Context, siteID string, username string) (bool, error)
+	GetByEmail(ctx context.Context, siteID string, email string) (User, error)
+	EmailExists(ctx context.Context, siteID string, email string) (bool, error)
+	Create(ctx context.Context, u User) error
+	// SignUp creates the user with its role, redeeming the invite code at now
+	// and recording who invited them if there is one. Either all of it is done
+	// or none. It returns ErrNotFound if the invite is no longer usable.
+	SignUp(ctx context.Context, s SignUp, now time.Time) error
+	SetLocale(ctx context.Context, id string, locale string) error
+	SetTheme(ctx context.Context, id string, theme string) error
+	// SetEmail changes the email of a user, which has to be verified again.
+	SetEmail(ctx context.Context, id string, email string) error
+	// SetUsername renames a user. The old username is kept to redirect links
+	// to the new one, until someone else takes it.
+	SetUsername(ctx context.Context, id string, username string) error
+	// GetByPreviousUsername returns the user that was last renamed from
+	// username.
+	GetByPreviousUsername(ctx context.Context, siteID string, username string) (User, error)
+	// SetPassword replaces the password hash of a user, which no longer needs
+	// to be reset.
+	SetPassword(ctx context.Context, id string, password string) error
+	SetPasswordResetRequired(ctx context.Context, id string, required bool) error
+	// SetSuspended suspends the user at the given time, or lifts the
+	// suspension if it is nil.
+	SetSuspended(ctx context.Context, id string, suspendedAt *time.Time) error
+	// Delete removes the user together with everything that belongs only to
+	// them, in one transaction. The posts and images of the user are given to
+	// reassignTo, or deleted with them if it is empty.
+	Delete(ctx context.Context, id string, reassignTo string) error
+	// SetEmailVerified marks the email of a user as verified, if it is still
+	// email.
+	SetEmailVerified(ctx context.Context, id string, email string) error
+	// CountAll returns how many users there are on every site.
+	CountAll(ctx context.Context) (int, error)
+}
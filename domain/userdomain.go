@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// UserDomain is a hostname a user attached to their backyard. Requests on a
+// verified domain are routed to the user's profile.
+type UserDomain struct {
+	Domain     string
+	UserID     string
+	SiteID     string
+	Token      string
+	VerifiedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (d UserDomain) Verified() bool {
+	return d.VerifiedAt != nil
+}
+
+// TXTRecordName is the DNS name where the user must publish TXTRecordValue to
+// prove they own the domain.
+func (d UserDomain) TXTRecordName() string {
+	return "_backyard-challenge." + d.Domain
+}
+
+func (d UserDomain) TXTRecordValue() string {
+	return "backyard-verification=" + d.Token
+}
+
+// TXTResolver looks up DNS TXT records. *net.Resolver implements it.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+var ErrDomainNotVerified = errors.New("verification record not found")
+
+// Verify checks the ownership TXT record is published for the domain.
+func (d UserDomain) Verify(ctx context.Context, resolver TXTResolver) error {
+	records, err := resolver.LookupTXT(ctx, d.TXTRecordName())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDomainNotVerified, err)
+	}
+	if !slices.Contains(records, d.TXTRecordValue()) {
+		return ErrDomainNotVerified
+	}
+	return nil
+}
+
+type UserDomainRepository interface {
+	GetByUser(ctx context.Context, userID string) (UserDomain, error)
+	// GetVerified returns the verified domain matching the hostname.
+	GetVerified(ctx context.Context, domain string) (UserDomain, error)
+	// Save attaches d to its user, replacing any domain attached before.
+	Save(ctx context.Context, d UserDomain) error
+	MarkVerified(ctx context.Context, userID string) error
+	Delete(ctx context.Context, userID string) error
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Events sent to webhooks.
+const (
+	EventPostPublished = "post.published"
+	EventPostUpdated   = "post.updated"
+	EventPostDeleted   = "post.deleted"
+	EventUserSignedUp  = "user.signed_up"
+)
+
+// Events are the events webhooks can subscribe to.
+var Events = []string{EventPostPublished, EventPostUpdated, EventPostDeleted, EventUserSignedUp}
+
+// Webhook is a URL of a site that is sent a signed JSON request when the
+// events it subscribes to happen.
+type Webhook struct {
+	ID     string
+	SiteID string
+	URL    string
+	// Secret signs the payloads, so the receiver can check they come from the
+	// site.
+	Secret    string
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+}
+
+// Subscribes reports if the webhook is active and sent the event.
+func (w Webhook) Subscribes(event string) bool {
+	return w.Active && slices.Contains(w.Events, event)
+}
+
+// Status of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event sent, or to send, to a webhook. Failed attempts
+// are retried until the delivery succeeds or runs out of attempts.
+type WebhookDelivery struct {
+	ID        string
+	SiteID    string
+	WebhookID string
+	Event     string
+	Payload   []byte
+	Status    string
+	Attempts  int
+	// NextAttemptAt is when a pending delivery is attempted next.
+	NextAttemptAt *time.Time
+	LastAttemptAt *time.Time
+	// ResponseStatus is the HTTP status of the last attempt, 0 if it got no
+	// response.
+	ResponseStatus int
+	Error          string
+	CreatedAt      time.Time
+}
+
+type WebhookRepository interface {
+	// List returns the webhooks of a site, oldest first.
+	List(ctx context.Context, siteID string) ([]Webhook, error)
+	GetByID(ctx context.Context, siteID string, id string) (Webhook, error)
+	Create(ctx context.Context, w Webhook) error
+	// Update replaces the URL, events and active state of a webhook.
+	Update(ctx context.Context, w Webhook) error
+	// Delete deletes a webhook with its deliveries.
+	Delete(ctx context.Context, siteID string, id string) error
+	CreateDelivery(ctx context.Context, d WebhookDelivery) error
+	// ListDeliveries returns the latest deliveries of a webhook, newest first.
+	ListDeliveries(ctx context.Context, webhookID string, limit int) ([]WebhookDelivery, error)
+	GetDelivery(ctx context.Context, webhookID string, id string) (WebhookDelivery, error)
+	// ClaimDue returns up to limit pending deliveries of every site due by
+	// now, the oldest first, and moves their next attempt lease later, so
+	// other processes sharing the database do not send them too. If the
+	// process stops before saving the result, they are sent once the lease
+	// is over.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	// UpdateDelivery saves the result of an attempt: the status, attempts, next
+	// attempt, response status and error of d.
+	UpdateDelivery(ctx context.Context, d WebhookDelivery) error
+}
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SMTPSender sends messages through an SMTP server.
+type SMTPSender struct {
+	// Addr is the host:port of the server.
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPSender) Send(ctx context.Context, m Message) error {
+	data, err := m.encode(s.From)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, from.Address, []string{m.To}, data)
+}
+
+// FileSender writes every message to a file in Dir, for development.
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func (s FileSender) Send(ctx context.Context, m Message) error {
+	data, err := m.encode(s.From)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(m.To))
+	return os.WriteFile(filepath.Join(s.Dir, name), data, 0o644)
+}
+
+// LogSender prints the plain text version of every message, for development.
+type LogSender struct {
+	Out  io.Writer
+	From string
+}
+
+func (s LogSender) Send(ctx context.Context, m Message) error {
+	_, err := fmt.Fprintf(s.Out, "From: %s\nTo: %s\nSubject: %s\n\n%s\n", s.From, m.To, m.Subject, m.Text)
+	return err
+}
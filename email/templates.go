@@ -0,0 +1,80 @@
+package email
+
+import (
+	"backyard/i18n"
+	"bytes"
+	htmltemplate "html/template"
+	"io/fs"
+	texttemplate "text/template"
+)
+
+// Data is what the email templates can show. The site fields come from the
+// instance configuration, so emails look like the site that sends them.
+type Data struct {
+	SiteTitle string
+	SiteURL   string
+	// SiteImage is the absolute URL of the home image, if any.
+	SiteImage string
+	Footer    htmltemplate.HTML
+	Username  string
+	// Link is the URL the recipient has to open, if any.
+	Link string
+}
+
+// Templates renders the emails found in templates/email. Every email has an
+// HTML version, <name>.html, and a plain text one, <name>.txt. The HTML
+// versions share the layout in base.html.
+type Templates struct {
+	html map[string]map[string]*htmltemplate.Template
+	text map[string]map[string]*texttemplate.Template
+}
+
+// Names lists the emails the templates must provide.
+var Names = []string{"verify-email", "reset-password"}
+
+func ParseTemplates(files fs.FS) (*Templates, error) {
+	t := &Templates{
+		html: map[string]map[string]*htmltemplate.Template{},
+		text: map[string]map[string]*texttemplate.Template{},
+	}
+	for _, locale := range i18n.Locales() {
+		locale := locale
+		tr := func(key string, args ...any) string { return i18n.T(locale, key, args...) }
+		t.html[locale] = map[string]*htmltemplate.Template{}
+		t.text[locale] = map[string]*texttemplate.Template{}
+		for _, name := range Names {
+			h, err := htmltemplate.New("").Funcs(htmltemplate.FuncMap{"t": tr}).ParseFS(files, "templates/email/"+name+".html", "templates/email/base.html")
+			if err != nil {
+				return nil, err
+			}
+			t.html[locale][name] = h
+			txt, err := texttemplate.New("").Funcs(texttemplate.FuncMap{"t": tr}).ParseFS(files, "templates/email/"+name+".txt")
+			if err != nil {
+				return nil, err
+			}
+			t.text[locale][name] = txt
+		}
+	}
+	return t, nil
+}
+
+// Render builds the named email for to. The subject is the email.<name>.subject
+// message, formatted with the site title.
+func (t *Templates) Render(locale string, name string, to string, data Data) (Message, error) {
+	if _, ok := t.html[locale]; !ok {
+		locale = i18n.Default
+	}
+	var html, text bytes.Buffer
+	if err := t.html[locale][name].ExecuteTemplate(&html, "base.html", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.text[locale][name].ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: i18n.T(locale, "email."+name+".subject", data.SiteTitle),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"backyard/theme"
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// embedded holds every file the server needs at runtime, so the binary can be
+// started from any directory.
+//
+//go:embed templates/*.html
+//go:embed templates/email
+//go:embed assets
+//go:embed themes
+//go:embed db/migrations/*.sql
+var embedded embed.FS
+
+// siteFS returns the templates, assets and themes to serve. Files found in
+// themeDir take precedence over the embedded ones.
+func siteFS(themeDir string) fs.FS {
+	if themeDir == "" {
+		return theme.Overlay{embedded}
+	}
+	return theme.Overlay{os.DirFS(themeDir), embedded}
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"backyard/domain"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	accessTokenContextKey = "accessToken"
+	// tokenScopeContextKey holds the scope an access token needs to act as
+	// its user on the current route.
+	tokenScopeContextKey     = "tokenScope"
+	maxAccessTokenNameLength = 64
+)
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or an
+// empty string.
+func bearerToken(c echo.Context) string {
+	value, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+// currentAccessToken returns the access token sent by a script, if it exists,
+// was not revoked, and its user is not suspended. The result is kept in the
+// context like the session.
+func (h *Handler) currentAccessToken(c echo.Context) (domain.AccessToken, bool) {
+	if token, ok := c.Get(accessTokenContextKey).(*domain.AccessToken); ok {
+		return *token, token.ID != ""
+	}
+	token := h.lookupAccessToken(c)
+	c.Set(accessTokenContextKey, &token)
+	return token, token.ID != ""
+}
+
+func (h *Handler) lookupAccessToken(c echo.Context) domain.AccessToken {
+	value := bearerToken(c)
+	if !strings.HasPrefix(value, domain.AccessTokenPrefix) {
+		return domain.AccessToken{}
+	}
+	token, err := h.AccessTokens.GetByHash(c.Request().Context(), CurrentSite(c).ID, domain.HashToken(value))
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			LogError(c, err)
+		}
+		return domain.AccessToken{}
+	}
+	user, err := h.Users.GetByID(c.Request().Context(), token.UserID)
+	if err != nil || user.SuspendedAt != nil {
+		return domain.AccessToken{}
+	}
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > touchInterval {
+		if err := h.AccessTokens.Touch(c.Request().Context(), token.ID, now); err != nil {
+			LogError(c, err)
+		}
+		token.LastUsedAt = &now
+	}
+	return token
+}
+
+// AllowToken lets scripts use the route with an access token granting scope,
+// besides the users logged in with the session cookie.
+func (h *Handler) AllowToken(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(tokenScopeContextKey, scope)
+			return next(c)
+		}
+	}
+}
+
+// tokenUserID returns the ID of the user of the access token of the request,
+// if the route allows tokens with one of its scopes.
+func (h *Handler) tokenUserID(c echo.Context) string {
+	scope, _ := c.Get(tokenScopeContextKey).(string)
+	if scope == "" {
+		return ""
+	}
+	token, ok := h.currentAccessToken(c)
+	if !ok || !token.Allows(scope) {
+		return ""
+	}
+	return token.UserID
+}
+
+// ParseCredential checks the credential the echojwt middleware found in the
+// request: an access token in the Authorization header, or the JWT of the
+// session cookie.
+func (h *Handler) ParseCredential(c echo.Context, auth string) (interface{}, error) {
+	if strings.HasPrefix(auth, domain.AccessTokenPrefix) {
+		token, ok := h.currentAccessToken(c)
+		if !ok || token.Hash != domain.HashToken(auth) {
+			return nil, errors.New("invalid access token")
+		}
+		return token, nil
+	}
+	claims, ok := h.parseToken(auth)
+	if !ok {
+		return nil, errors.New("invalid or expired token")
+	}
+	return claims, nil
+}
+
+type AccessTokenDTO struct {
+	ID         string
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// GetAccessTokens lists the access tokens of the user, with a form to create
+// a new one.
+func (h *Handler) GetAccessTokens(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	return h.renderAccessTokens(c, userID, "", "")
+}
+
+// renderAccessTokens shows the tokens of the user. newToken is the token
+// just created, which is only shown once.
+func (h *Handler) renderAccessTokens(c echo.Context, userID string, newToken string, errorMessage string) error {
+	tokens, err := h.AccessTokens.ListByUser(c.Request().Context(), CurrentSite(c).ID, userID)
+	if err != nil {
+		return err
+	}
+	dtos := []AccessTokenDTO{}
+	for _, t := range tokens {
+		dtos = append(dtos, AccessTokenDTO{
+			ID:         t.ID,
+			Name:       t.Name,
+			Scopes:     t.Scopes,
+			CreatedAt:  t.CreatedAt,
+			LastUsedAt: t.LastUsedAt,
+		})
+	}
+	status := http.StatusOK
+	if errorMessage != "" {
+		status = http.StatusBadRequest
+	}
+	return c.Render(status, "user-tokens.html", struct {
+		Tokens   []AccessTokenDTO
+		Scopes   []string
+		NewToken string
+		Error    string
+	}{
+		Tokens:   dtos,
+		Scopes:   domain.Scopes,
+		NewToken: newToken,
+		Error:    errorMessage,
+	})
+}
+
+// CreateAccessToken creates a named token with the checked scopes.
+func (h *Handler) CreateAccessToken(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" || utf8.RuneCountInString(name) > maxAccessTokenNameLength {
+		return h.renderAccessTokens(c, userID, "", "tokens.error.name")
+	}
+	form, err := c.FormParams()
+	if err != nil {
+		return err
+	}
+	scopes := []string{}
+	for _, scope := range domain.Scopes {
+		if slices.Contains(form["scope"], scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return h.renderAccessTokens(c, userID, "", "tokens.error.scopes")
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	value := domain.AccessTokenPrefix + secret
+	err = h.AccessTokens.Create(c.Request().Context(), domain.AccessToken{
+		ID:     uuid.NewString(),
+		SiteID: CurrentSite(c).ID,
+		UserID: userID,
+		Name:   name,
+		Hash:   domain.HashToken(value),
+		Scopes: scopes,
+	})
+	if err != nil {
+		return err
+	}
+	return h.renderAccessTokens(c, userID, value, "")
+}
+
+// RevokeAccessToken stops a token of the user from working.
+func (h *Handler) RevokeAccessToken(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	err := h.AccessTokens.Revoke(c.Request().Context(), CurrentSite(c).ID, userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/settings/tokens")
+}
@@ -0,0 +1,413 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/i18n"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultAPIPageSize = 20
+	maxAPIPageSize     = 100
+)
+
+// APIError is the body of every error answered by the JSON API.
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+type APIErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code" doc:"HTTP status text in snake case, like not_found"`
+	Message string `json:"message"`
+}
+
+// RenderAPIError answers err with the error envelope of the JSON API. Errors
+// other than echo.HTTPError are internal, and their details are not shown.
+func RenderAPIError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	message := http.StatusText(status)
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		status = he.Code
+		message = fmt.Sprint(he.Message)
+	}
+	return c.JSON(status, APIError{Error: APIErrorDetail{
+		Status:  status,
+		Code:    strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+		Message: message,
+	}})
+}
+
+type APIPost struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content" doc:"Markdown source of the post"`
+	HTML      string    `json:"html" doc:"Sanitized HTML rendering of the content"`
+	Draft     bool      `json:"draft"`
+	Tags      []string  `json:"tags"`
+	Author    string    `json:"author" doc:"Username of the author"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// APIPostInput is the body of the requests creating or replacing a post.
+type APIPostInput struct {
+	Title   string   `json:"title"`
+	Content string   `json:"content" doc:"Markdown source of the post"`
+	Draft   bool     `json:"draft,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+type APIPostPage struct {
+	Posts   []APIPost `json:"posts"`
+	Page    int       `json:"page"`
+	PerPage int       `json:"per_page"`
+	Total   int       `json:"total" doc:"Number of posts of all the pages"`
+}
+
+type APIUser struct {
+	Username  string    `json:"username"`
+	Posts     int       `json:"posts" doc:"Number of published posts"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIUserList struct {
+	Users []APIUser `json:"users"`
+}
+
+type APITag struct {
+	Name  string `json:"name"`
+	Posts int    `json:"posts" doc:"Number of published posts with the tag"`
+}
+
+type APITagList struct {
+	Tags []APITag `json:"tags"`
+}
+
+type APIInstance struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Version     string   `json:"version" doc:"Version of Backyard"`
+	SignupMode  string   `json:"signup_mode" doc:"closed, open or invite"`
+	Locale      string   `json:"locale" doc:"Default language"`
+	Locales     []string `json:"locales" doc:"Languages the interface is translated to"`
+}
+
+func (h *Handler) apiPost(c echo.Context, p domain.Post) APIPost {
+	tags := p.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return APIPost{
+		ID:        p.ID,
+		Title:     p.Title,
+		Content:   p.Content,
+		HTML:      string(safeMd(p.Content)),
+		Draft:     p.Draft,
+		Tags:      tags,
+		Author:    p.Author(),
+		URL:       h.siteURL(c) + "/posts/" + p.ID,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
+
+// apiPage returns the page and page size asked in the query string.
+func apiPage(c echo.Context) (int, int, error) {
+	page, perPage := 1, defaultAPIPageSize
+	var err error
+	if value := c.QueryParam("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "page must be a positive number")
+		}
+	}
+	if value := c.QueryParam("per_page"); value != "" {
+		perPage, err = strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxAPIPageSize {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("per_page must be between 1 and %d", maxAPIPageSize))
+		}
+	}
+	return page, perPage, nil
+}
+
+// APIGetPosts lists the published posts newest first, one page at a time.
+// Drafts are listed to their authors and to users who may edit any post.
+func (h *Handler) APIGetPosts(c echo.Context) error {
+	ctx := c.Request().Context()
+	siteID := CurrentSite(c).ID
+	page, perPage, err := apiPage(c)
+	if err != nil {
+		return err
+	}
+	userID := h.getUserID(c)
+	editAny, err := h.can(c, domain.PermissionEditAnyPost)
+	if err != nil {
+		return err
+	}
+
+	authorID := domainUserID(c)
+	if username := c.QueryParam("author"); username != "" {
+		author, err := h.Users.GetByUsername(ctx, siteID, username)
+		if errors.Is(err, domain.ErrNotFound) || (err == nil && authorID != "" && author.ID != authorID) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		if err != nil {
+			return err
+		}
+		authorID = author.ID
+	}
+	filter := domain.PostFilter{
+		SiteID:    siteID,
+		AuthorID:  authorID,
+		Tag:       strings.ToLower(strings.TrimSpace(c.QueryParam("tag"))),
+		AllDrafts: editAny,
+		DraftsOf:  userID,
+	}
+	result := APIPostPage{Posts: []APIPost{}, Page: page, PerPage: perPage}
+	result.Total, err = h.Posts.Count(ctx, filter)
+	if err != nil {
+		return err
+	}
+	filter.Limit = perPage
+	filter.Offset = (page - 1) * perPage
+	posts, err := h.Posts.Search(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		result.Posts = append(result.Posts, h.apiPost(c, p))
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// apiGetPost returns the post in the id path parameter, if the user may see
+// it.
+func (h *Handler) apiGetPost(c echo.Context) (domain.Post, error) {
+	p, err := h.Posts.GetByID(c.Request().Context(), CurrentSite(c).ID, c.Param("id"))
+	if err == nil && domainUserID(c) != "" && domainUserID(c) != p.Access.UserID {
+		err = domain.ErrNotFound
+	}
+	if err == nil && p.Draft {
+		allowed, err := h.canEditPost(c, p.ID)
+		if err != nil {
+			return domain.Post{}, err
+		}
+		if !allowed {
+			return domain.Post{}, echo.NewHTTPError(http.StatusNotFound, "post not found")
+		}
+	}
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.Post{}, echo.NewHTTPError(http.StatusNotFound, "post not found")
+	}
+	return p, err
+}
+
+func (h *Handler) APIGetPost(c echo.Context) error {
+	p, err := h.apiGetPost(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, h.apiPost(c, p))
+}
+
+// bindPostInput reads and checks the post sent in the request body.
+func bindPostInput(c echo.Context) (APIPostInput, error) {
+	var input APIPostInput
+	if err := c.Bind(&input); err != nil {
+		return APIPostInput{}, echo.NewHTTPError(http.StatusBadRequest, "the body must be a JSON post")
+	}
+	input.Title = strings.TrimSpace(input.Title)
+	if input.Title == "" || strings.TrimSpace(input.Content) == "" {
+		return APIPostInput{}, echo.NewHTTPError(http.StatusBadRequest, "title and content are required")
+	}
+	input.Tags = domain.NormalizeTags(input.Tags)
+	return input, nil
+}
+
+// APICreatePost creates a post written by the user, if their roles allow it.
+func (h *Handler) APICreatePost(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return echo.ErrUnauthorized
+	}
+	allowed, err := h.can(c, domain.PermissionCreatePosts)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return echo.NewHTTPError(http.StatusForbidden, "your role does not allow creating posts")
+	}
+	input, err := bindPostInput(c)
+	if err != nil {
+		return err
+	}
+
+	id := uuid.NewString()
+	err = h.Posts.Create(c.Request().Context(), domain.Post{
+		ID:      id,
+		SiteID:  CurrentSite(c).ID,
+		Title:   input.Title,
+		Content: input.Content,
+		Draft:   input.Draft,
+		Tags:    input.Tags,
+		Access:  domain.Access{UserID: userID},
+	})
+	if err != nil {
+		return err
+	}
+	p, err := h.Posts.GetByID(c.Request().Context(), CurrentSite(c).ID, id)
+	if err != nil {
+		return err
+	}
+	h.postChanged(c, domain.Post{}, p)
+	post := h.apiPost(c, p)
+	c.Response().Header().Set(echo.HeaderLocation, h.siteURL(c)+"/api/v1/posts/"+id)
+	return c.JSON(http.StatusCreated, post)
+}
+
+// apiEditablePost returns the post in the id path parameter, if the user is
+// its author or may edit any post.
+func (h *Handler) apiEditablePost(c echo.Context) (domain.Post, error) {
+	if h.getUserID(c) == "" {
+		return domain.Post{}, echo.ErrUnauthorized
+	}
+	p, err := h.apiGetPost(c)
+	if err != nil {
+		return domain.Post{}, err
+	}
+	allowed, err := h.canEditPost(c, p.ID)
+	if err != nil {
+		return domain.Post{}, err
+	}
+	if !allowed {
+		return domain.Post{}, echo.NewHTTPError(http.StatusForbidden, "only the author can change this post")
+	}
+	return p, nil
+}
+
+// APIUpdatePost replaces the title, content, draft state and tags of a post.
+func (h *Handler) APIUpdatePost(c echo.Context) error {
+	p, err := h.apiEditablePost(c)
+	if err != nil {
+		return err
+	}
+	input, err := bindPostInput(c)
+	if err != nil {
+		return err
+	}
+	before := p
+	p.Title = input.Title
+	p.Content = input.Content
+	p.Draft = input.Draft
+	p.Tags = input.Tags
+	err = h.Posts.Update(c.Request().Context(), p)
+	if err != nil {
+		return err
+	}
+	h.postChanged(c, before, p)
+	p, err = h.Posts.GetByID(c.Request().Context(), p.SiteID, p.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, h.apiPost(c, p))
+}
+
+func (h *Handler) APIDeletePost(c echo.Context) error {
+	p, err := h.apiEditablePost(c)
+	if err != nil {
+		return err
+	}
+	err = h.Posts.Delete(c.Request().Context(), p.SiteID, p.ID)
+	if err != nil {
+		return err
+	}
+	h.postChanged(c, p, domain.Post{})
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) apiUser(c echo.Context, u domain.User, posts map[string]int) APIUser {
+	return APIUser{
+		Username:  u.Username,
+		Posts:     posts[u.ID],
+		URL:       h.siteURL(c) + "/" + u.Username,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+// APIGetUsers lists the users of the site by username. Suspended users are
+// left out.
+func (h *Handler) APIGetUsers(c echo.Context) error {
+	users, err := h.Users.Search(c.Request().Context(), domain.UserFilter{SiteID: CurrentSite(c).ID, Status: domain.UserStatusActive})
+	if err != nil {
+		return err
+	}
+	posts, err := h.Posts.CountByAuthor(c.Request().Context(), CurrentSite(c).ID, false)
+	if err != nil {
+		return err
+	}
+	result := APIUserList{Users: []APIUser{}}
+	for _, u := range users {
+		if ownerID := domainUserID(c); ownerID != "" && ownerID != u.ID {
+			continue
+		}
+		result.Users = append(result.Users, h.apiUser(c, u, posts))
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) APIGetUser(c echo.Context) error {
+	user, err := h.Users.GetByUsername(c.Request().Context(), CurrentSite(c).ID, c.Param("username"))
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && user.SuspendedAt != nil) ||
+		(err == nil && domainUserID(c) != "" && domainUserID(c) != user.ID) {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	if err != nil {
+		return err
+	}
+	posts, err := h.Posts.Count(c.Request().Context(), domain.PostFilter{SiteID: user.SiteID, AuthorID: user.ID})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, h.apiUser(c, user, map[string]int{user.ID: posts}))
+}
+
+// APIGetTags lists the tags of the published posts by name.
+func (h *Handler) APIGetTags(c echo.Context) error {
+	tags, err := h.Posts.ListTags(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	result := APITagList{Tags: []APITag{}}
+	for _, t := range tags {
+		result.Tags = append(result.Tags, APITag{Name: t.Name, Posts: t.Posts})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// APIGetInstance describes the site.
+func (h *Handler) APIGetInstance(c echo.Context) error {
+	config, err := h.Configs.GetActive(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, APIInstance{
+		Title:       config.Title,
+		Description: config.Description,
+		Version:     config.BackyardVersion,
+		SignupMode:  h.signupMode(c, config),
+		Locale:      config.Locale,
+		Locales:     i18n.Locales(),
+	})
+}
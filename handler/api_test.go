@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"backyard/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestPost adds a post written by the user.
+func createTestPost(t *testing.T, h *Handler, user domain.User, title string, draft bool, tags ...string) domain.Post {
+	t.Helper()
+	post := domain.Post{
+		ID:      uuid.NewString(),
+		SiteID:  user.SiteID,
+		Title:   title,
+		Content: "Hello",
+		Draft:   draft,
+		Tags:    tags,
+		Access:  domain.Access{UserID: user.ID, Relation: domain.RelationAuthor},
+	}
+	if err := h.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+// getPosts calls APIGetPosts with the query, as the user if any, and returns
+// the titles of the posts and the total.
+func getPosts(t *testing.T, h *Handler, query string, user *domain.User) ([]string, int) {
+	t.Helper()
+	c, rec := newTestContext(http.MethodGet, "/api/posts?"+query, nil)
+	if user != nil {
+		c.Request().AddCookie(sessionCookie(t, h, *user))
+	}
+	if err := h.APIGetPosts(c); err != nil {
+		t.Fatal(err)
+	}
+	var page APIPostPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	titles := []string{}
+	for _, p := range page.Posts {
+		titles = append(titles, p.Title)
+	}
+	return titles, page.Total
+}
+
+func TestAPIGetPostsPages(t *testing.T) {
+	h := newTestHandler(t)
+	admin := newTestAdmin(t, h)
+	alice := createTestUser(t, h, "alice", "password")
+	bob := createTestUser(t, h, "bob", "password")
+	for i := range 5 {
+		createTestPost(t, h, alice, fmt.Sprint("alice ", i), false, "go")
+	}
+	createTestPost(t, h, alice, "alice draft", true, "go")
+	createTestPost(t, h, bob, "bob", false)
+	createTestPost(t, h, bob, "bob draft", true)
+
+	tests := []struct {
+		query string
+		user  *domain.User
+		count int
+		total int
+	}{
+		{"per_page=2", nil, 2, 6},
+		{"per_page=2&page=3", nil, 2, 6},
+		{"per_page=2&page=4", nil, 0, 6},
+		{"per_page=4&page=2", &alice, 3, 7},
+		{"per_page=10", &admin, 8, 8},
+		{"per_page=2&tag=go", nil, 2, 5},
+		{"per_page=10&tag=go", &alice, 6, 6},
+		{"per_page=10&author=bob", &alice, 1, 1},
+		{"per_page=10&author=bob", &bob, 2, 2},
+	}
+	for _, tt := range tests {
+		titles, total := getPosts(t, h, tt.query, tt.user)
+		if len(titles) != tt.count || total != tt.total {
+			t.Errorf("%s: %d posts of %d %v, want %d of %d", tt.query, len(titles), total, titles, tt.count, tt.total)
+		}
+	}
+
+	// The pages do not overlap
+	seen := map[string]bool{}
+	for page := 1; page <= 3; page++ {
+		titles, _ := getPosts(t, h, fmt.Sprintf("per_page=2&page=%d", page), nil)
+		for _, title := range titles {
+			if seen[title] {
+				t.Errorf("%s listed twice", title)
+			}
+			seen[title] = true
+		}
+	}
+}
+
+func TestAPIUsersCountPublishedPosts(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "password")
+	createTestPost(t, h, alice, "Published", false)
+	createTestPost(t, h, alice, "Draft", true)
+
+	c, rec := newTestContext(http.MethodGet, "/api/v1/users", nil)
+	if err := h.APIGetUsers(c); err != nil {
+		t.Fatal(err)
+	}
+	var users APIUserList
+	if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Users) != 1 || users.Users[0].Posts != 1 {
+		t.Errorf("users: %+v", users.Users)
+	}
+
+	c, rec = newTestContext(http.MethodGet, "/api/v1/users/alice", nil)
+	c.SetParamNames("username")
+	c.SetParamValues("alice")
+	if err := h.APIGetUser(c); err != nil {
+		t.Fatal(err)
+	}
+	var user APIUser
+	if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Posts != 1 {
+		t.Errorf("alice has %d posts, want 1", user.Posts)
+	}
+}
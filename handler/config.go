@@ -2,25 +2,35 @@ package handler
 
 import (
 	"backyard/domain"
-	"context"
+	"backyard/i18n"
+	"backyard/theme"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/microcosm-cc/bluemonday"
 )
 
+// sanitizerFooter only allows the inline markup a footer needs, like links and emphasis.
+var sanitizerFooter = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowElements("p", "br", "span", "small", "em", "strong", "b", "i")
+	p.RequireNoFollowOnLinks(true)
+	return p
+}()
+
 func (h *Handler) Config(ctx echo.Context) error {
-	userID := getUserID(ctx, h.JWTSecret)
-	if userID == "" {
-		return ctx.Redirect(http.StatusFound, "/")
-	}
-	row := h.DB.QueryRow("select config_id, backyard_version from config where active is true and admin_user_id = $1 order by updated_at desc", userID)
-	oldConfigID := "old-id"
-	backyardVersion := ""
-	err := row.Scan(&oldConfigID, &backyardVersion)
+	userID := h.getUserID(ctx)
+	old, err := h.Configs.GetActive(ctx.Request().Context(), CurrentSite(ctx).ID)
 	if err != nil {
 		return err
 	}
@@ -32,43 +42,58 @@ func (h *Handler) Config(ctx echo.Context) error {
 	formTitle := ctx.FormValue("title")
 	formFooter := ctx.FormValue("footer")
 	formDescription := ctx.FormValue("description")
-	c := domain.Config{
-		ID:              ID,
-		Active:          true,
-		BackyardVersion: backyardVersion,
-		Title:           formTitle,
-		Footer:          formFooter,
-		Description:     formDescription,
+	formTheme := ctx.FormValue("theme")
+	if !slices.Contains(h.Themes, formTheme) {
+		return fmt.Errorf("invalid theme")
 	}
-	tx, err := h.DB.BeginTx(context.TODO(), nil)
-	if err != nil {
-		return fmt.Errorf("error in begin transaction: %v", err)
+	formLocale := ctx.FormValue("locale")
+	if !i18n.Supported(formLocale) {
+		return fmt.Errorf("invalid locale")
 	}
-	stmt, err := h.DB.Prepare("update config set active = false, updated_at = current_timestamp where config_id = ?")
-	if err != nil {
-		return err
+	formSignupMode := ctx.FormValue("signup_mode")
+	if !slices.Contains(signupModes, formSignupMode) {
+		return fmt.Errorf("invalid signup mode")
 	}
-	_, err = stmt.Exec(oldConfigID)
-	if err != nil {
-		return err
+	formInviters := ctx.FormValue("inviters")
+	if formInviters != domain.InvitersUsers && formInviters != domain.InvitersAdmin {
+		return fmt.Errorf("invalid inviters")
 	}
-	stmt, err = h.DB.Prepare(`insert into config (config_id, active, backyard_version, title_home, desc_home, image_home, favicon_home, footer_html, admin_user_id)
-        values (?,?,?,?,?,?,?,?,?)`)
+	formImageHome, err := h.imageFormValue(ctx, userID, "image_home")
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(c.ID, c.Active, c.BackyardVersion, c.Title, c.Description, c.ImageHome, c.Favicon, c.Footer, userID)
+	formFavicon, err := h.imageFormValue(ctx, userID, "favicon")
 	if err != nil {
 		return err
 	}
-	err = tx.Commit()
+	c := domain.Config{
+		ID:              ID,
+		SiteID:          CurrentSite(ctx).ID,
+		Active:          true,
+		BackyardVersion: old.BackyardVersion,
+		Title:           formTitle,
+		Footer:          formFooter,
+		Description:     formDescription,
+		ImageHome:       formImageHome,
+		Favicon:         formFavicon,
+		Theme:           formTheme,
+		CustomCSS:       ctx.FormValue("custom_css"),
+		Locale:          formLocale,
+		SignupMode:      formSignupMode,
+		Inviters:        formInviters,
+		AdminUserID:     old.AdminUserID,
+		CreatedBy:       userID,
+	}
+	err = h.Configs.Save(ctx.Request().Context(), c)
 	if err != nil {
-		return fmt.Errorf("error in commit transaction: %v", err)
+		return err
 	}
 	return ctx.Redirect(http.StatusFound, "/config")
 
 }
 
+var signupModes = []string{domain.SignupClosed, domain.SignupOpen, domain.SignupInvite}
+
 type ConfigDTO struct {
 	ID              string
 	Title           string
@@ -76,6 +101,15 @@ type ConfigDTO struct {
 	ImageHome       string
 	Favicon         string
 	Footer          string
+	Theme           string
+	Themes          []string
+	CustomCSS       string
+	Locale          string
+	Locales         []string
+	SignupMode      string
+	SignupModes     []string
+	Inviters        string
+	Images          []domain.Image
 	BackyardVersion string
 	Active          bool
 	AdminUserID     string
@@ -84,14 +118,11 @@ type ConfigDTO struct {
 }
 
 func (h *Handler) GetConfigForm(ctx echo.Context) error {
-	userID := getUserID(ctx, h.JWTSecret)
-	if userID == "" {
-		return fmt.Errorf("user id empty")
+	c, err := h.Configs.GetActive(ctx.Request().Context(), CurrentSite(ctx).ID)
+	if err != nil {
+		return err
 	}
-
-	row := h.DB.QueryRow("select config_id, active, backyard_version, title_home, desc_home, image_home, favicon_home, footer_html, admin_user_id, created_at, updated_at from config where active is true and admin_user_id = $1 order by updated_at desc", userID)
-	c := domain.Config{}
-	err := row.Scan(&c.ID, &c.Active, &c.BackyardVersion, &c.Title, &c.Description, &c.ImageHome, &c.Favicon, &c.Footer, &c.AdminUserID, &c.CreatedAt, &c.UpdatedAt)
+	images, err := h.Images.List(ctx.Request().Context(), CurrentSite(ctx).ID)
 	if err != nil {
 		return err
 	}
@@ -104,8 +135,103 @@ func (h *Handler) GetConfigForm(ctx echo.Context) error {
 		ImageHome:       c.ImageHome,
 		Favicon:         c.Favicon,
 		Footer:          c.Footer,
+		Theme:           c.Theme,
+		Themes:          h.Themes,
+		CustomCSS:       c.CustomCSS,
+		Locale:          c.Locale,
+		Locales:         i18n.Locales(),
+		SignupMode:      c.SignupMode,
+		SignupModes:     signupModes,
+		Inviters:        c.Inviters,
+		Images:          images,
 		AdminUserID:     c.AdminUserID,
 		CreatedAt:       c.CreatedAt,
 		UpdatedAt:       c.UpdatedAt,
 	})
 }
+
+// GetCustomCSS serves the stylesheet set by the admin. Browsers revalidate it on
+// every page load and get a 304 response while it does not change.
+func (h *Handler) GetCustomCSS(ctx echo.Context) error {
+	c, err := h.Configs.GetActive(ctx.Request().Context(), CurrentSite(ctx).ID)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(c.CustomCSS))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	ctx.Response().Header().Set("Cache-Control", "no-cache")
+	ctx.Response().Header().Set("ETag", etag)
+	if ctx.Request().Header.Get("If-None-Match") == etag {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+	return ctx.Blob(http.StatusOK, "text/css; charset=utf-8", []byte(c.CustomCSS))
+}
+
+type ConfigVersionDTO struct {
+	ID        string
+	Active    bool
+	Title     string
+	CreatedBy string
+	CreatedAt time.Time
+	Changes   []domain.FieldChange
+}
+
+func (h *Handler) GetConfigHistory(ctx echo.Context) error {
+	configs, err := h.Configs.List(ctx.Request().Context(), CurrentSite(ctx).ID)
+	if err != nil {
+		return err
+	}
+	usernames := map[string]string{}
+	versions := []ConfigVersionDTO{}
+	for i, c := range configs {
+		// The first version is compared with an empty configuration, so every field set shows up as changed
+		prev := domain.Config{}
+		if i+1 < len(configs) {
+			prev = configs[i+1]
+		}
+		username, ok := usernames[c.CreatedBy]
+		if !ok {
+			if u, err := h.Users.GetByID(ctx.Request().Context(), c.CreatedBy); err == nil {
+				username = u.Username
+			}
+			usernames[c.CreatedBy] = username
+		}
+		versions = append(versions, ConfigVersionDTO{
+			ID:        c.ID,
+			Active:    c.Active,
+			Title:     c.Title,
+			CreatedBy: username,
+			CreatedAt: c.CreatedAt,
+			Changes:   c.Diff(prev),
+		})
+	}
+	return ctx.Render(http.StatusOK, "config-history.html", struct {
+		Versions []ConfigVersionDTO
+	}{
+		Versions: versions,
+	})
+}
+
+// ActivateConfig restores a past version by saving a copy of it as a new active
+// configuration, so the history keeps growing instead of being rewritten.
+func (h *Handler) ActivateConfig(ctx echo.Context) error {
+	userID := h.getUserID(ctx)
+	version, err := h.Configs.GetByID(ctx.Request().Context(), CurrentSite(ctx).ID, ctx.Param("id"))
+	if errors.Is(err, domain.ErrNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(h.Themes, version.Theme) {
+		version.Theme = theme.Default
+	}
+	version.ID = uuid.NewString()
+	version.CreatedBy = userID
+	err = h.Configs.Save(ctx.Request().Context(), version)
+	if err != nil {
+		return err
+	}
+	return ctx.Redirect(http.StatusFound, "/config/history")
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"backyard/domain"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestActivateConfigOfAnotherSite(t *testing.T) {
+	h := newTestHandler(t)
+	admin := newTestAdmin(t, h)
+	other := domain.Config{ID: uuid.NewString(), SiteID: "other", Title: "Other"}
+	if err := h.Configs.Save(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{other.ID, "unknown"} {
+		c, _ := newTestContext(http.MethodPost, "/config/history/"+id+"/activate", nil, sessionCookie(t, h, admin))
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		if err := h.ActivateConfig(c); !errors.Is(err, echo.ErrNotFound) {
+			t.Errorf("activating %s: %v, want %v", id, err, echo.ErrNotFound)
+		}
+	}
+	config, err := h.Configs.GetActive(context.Background(), domain.DefaultSiteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Title != "Backyard" {
+		t.Errorf("active config = %+v", config)
+	}
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/email"
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	verifyEmailTokenDuration   = 7 * 24 * time.Hour
+	resetPasswordTokenDuration = time.Hour
+)
+
+// normalizeEmail returns the address in addr, lower cased, or an error if it
+// is not a single valid address.
+func normalizeEmail(addr string) (string, error) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(addr))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(parsed.Address), nil
+}
+
+// siteURL returns the scheme, host and port of the current site, without a
+// trailing slash, for absolute links. It never comes from the Host header of
+// the request, which clients choose, so links sent by email cannot point to
+// other hosts.
+func (h *Handler) siteURL(c echo.Context) string {
+	base := h.BaseURL
+	if base == nil {
+		base = &url.URL{Scheme: "http", Host: "localhost"}
+	}
+	site := CurrentSite(c)
+	if site.Hostname == "" {
+		return base.Scheme + "://" + base.Host
+	}
+	host := site.Hostname
+	if port := base.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	return base.Scheme + "://" + host
+}
+
+// newUserToken stores a single use token for the user and returns it.
+func (h *Handler) newUserToken(ctx context.Context, user domain.User, purpose string, addr string, duration time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = h.Tokens.Create(ctx, domain.UserToken{
+		Hash:      domain.HashToken(token),
+		SiteID:    user.SiteID,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     addr,
+		ExpiresAt: time.Now().Add(duration),
+	})
+	return token, err
+}
+
+// mailContext holds what sending an email needs from the request, so it can
+// also be sent once the request is over.
+type mailContext struct {
+	ctx     context.Context
+	siteID  string
+	siteURL string
+	locale  string
+}
+
+func (h *Handler) mailContext(c echo.Context) mailContext {
+	return mailContext{
+		ctx:     context.WithoutCancel(c.Request().Context()),
+		siteID:  CurrentSite(c).ID,
+		siteURL: h.siteURL(c),
+		locale:  CurrentLocale(c),
+	}
+}
+
+// sendEmail renders the named email in the user's language, with the look of
+// the site, and sends it to addr.
+func (h *Handler) sendEmail(m mailContext, user domain.User, name string, addr string, link string) error {
+	config, err := h.Configs.GetActive(m.ctx, m.siteID)
+	if err != nil {
+		return err
+	}
+	data := email.Data{
+		SiteTitle: config.Title,
+		SiteURL:   m.siteURL,
+		Footer:    template.HTML(sanitizerFooter.Sanitize(config.Footer)),
+		Username:  user.Username,
+		Link:      link,
+	}
+	if config.ImageHome != "" {
+		data.SiteImage = m.siteURL + config.ImageHome
+	}
+	locale := user.Locale
+	if locale == "" {
+		locale = m.locale
+	}
+	message, err := h.Emails.Render(locale, name, addr, data)
+	if err != nil {
+		return err
+	}
+	return h.Mailer.Send(m.ctx, message)
+}
+
+// sendPasswordReset emails a password reset link to the owner of addr, if it
+// is a verified email.
+func (h *Handler) sendPasswordReset(m mailContext, addr string) error {
+	user, err := h.Users.GetByEmail(m.ctx, m.siteID, addr)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && user.EmailVerifiedAt == nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, err := h.newUserToken(m.ctx, user, domain.TokenResetPassword, addr, resetPasswordTokenDuration)
+	if err != nil {
+		return err
+	}
+	return h.sendEmail(m, user, "reset-password", addr, m.siteURL+"/password/reset?token="+token)
+}
+
+// sendVerificationEmail sends the user a link to prove they own their email.
+func (h *Handler) sendVerificationEmail(c echo.Context, user domain.User) error {
+	if user.Email == nil {
+		return nil
+	}
+	token, err := h.newUserToken(c.Request().Context(), user, domain.TokenVerifyEmail, *user.Email, verifyEmailTokenDuration)
+	if err != nil {
+		return err
+	}
+	return h.sendEmail(h.mailContext(c), user, "verify-email", *user.Email, h.siteURL(c)+"/verify-email?token="+token)
+}
+
+// renderMessage shows a page with a title and a message, both message keys.
+func renderMessage(c echo.Context, status int, title string, message string) error {
+	return c.Render(status, "message.html", struct {
+		Title   string
+		Message string
+	}{
+		Title:   title,
+		Message: message,
+	})
+}
+
+// VerifyEmail marks the email of a user as verified when they open the link
+// sent to it.
+func (h *Handler) VerifyEmail(c echo.Context) error {
+	token, err := h.Tokens.Consume(c.Request().Context(), CurrentSite(c).ID, domain.TokenVerifyEmail, domain.HashToken(c.QueryParam("token")))
+	if errors.Is(err, domain.ErrNotFound) {
+		return renderMessage(c, http.StatusBadRequest, "email.verify-email.title", "email.invalid_link")
+	}
+	if err != nil {
+		return err
+	}
+	err = h.Users.SetEmailVerified(c.Request().Context(), token.UserID, token.Email)
+	if errors.Is(err, domain.ErrNotFound) {
+		// The user changed their email after the link was sent
+		return renderMessage(c, http.StatusBadRequest, "email.verify-email.title", "email.invalid_link")
+	}
+	if err != nil {
+		return err
+	}
+	return renderMessage(c, http.StatusOK, "email.verify-email.title", "email.verify-email.done")
+}
+
+func (h *Handler) GetForgotPasswordForm(c echo.Context) error {
+	return c.Render(http.StatusOK, "password-forgot.html", nil)
+}
+
+// ForgotPassword emails a password reset link to the owner of a verified
+// email. The email is looked up and sent after responding, so the response is
+// the same, and takes as long, whether the email belongs to someone or not,
+// and shutting down waits for the email to be sent.
+// Every request counts against the IP address like a failed login, as each
+// may send an email.
+func (h *Handler) ForgotPassword(c echo.Context) error {
+	if !h.ResetThrottle.Allow(c.RealIP(), time.Now()) {
+		return c.HTML(http.StatusTooManyRequests, T(c, "error.too_many_attempts"))
+	}
+	h.ResetThrottle.Fail(c.RealIP(), time.Now())
+	addr, err := normalizeEmail(c.FormValue("email"))
+	if err != nil {
+		return c.HTML(http.StatusBadRequest, T(c, "error.invalid_email"))
+	}
+	m := h.mailContext(c)
+	attrs := RequestAttrs(c)
+	h.goBackground(func() {
+		if err := h.sendPasswordReset(m, addr); err != nil {
+			slog.ErrorContext(m.ctx, err.Error(), attrs...)
+		}
+	})
+	return renderMessage(c, http.StatusOK, "password.forgot.title", "password.forgot.sent")
+}
+
+func (h *Handler) GetResetPasswordForm(c echo.Context) error {
+	token := c.QueryParam("token")
+	_, err := h.Tokens.Get(c.Request().Context(), CurrentSite(c).ID, domain.TokenResetPassword, domain.HashToken(token))
+	if errors.Is(err, domain.ErrNotFound) {
+		return renderMessage(c, http.StatusBadRequest, "password.reset.title", "email.invalid_link")
+	}
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "password-reset.html", struct {
+		Token string
+	}{
+		Token: token,
+	})
+}
+
+// ResetPassword sets a new password with a token sent by ForgotPassword. Every
+// session of the user is revoked and their login lockout lifted.
+func (h *Handler) ResetPassword(c echo.Context) error {
+	password := c.FormValue("password")
+	if len(password) == 0 {
+		return c.HTML(http.StatusBadRequest, T(c, "error.bad_request"))
+	}
+	token, err := h.Tokens.Consume(c.Request().Context(), CurrentSite(c).ID, domain.TokenResetPassword, domain.HashToken(c.FormValue("token")))
+	if errors.Is(err, domain.ErrNotFound) {
+		return renderMessage(c, http.StatusBadRequest, "password.reset.title", "email.invalid_link")
+	}
+	if err != nil {
+		return err
+	}
+	user, err := h.Users.GetByID(c.Request().Context(), token.UserID)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	err = h.Users.SetPassword(c.Request().Context(), user.ID, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	err = h.Sessions.RevokeAll(c.Request().Context(), user.SiteID, user.ID, "")
+	if err != nil {
+		return err
+	}
+	err = h.Logins.ClearFailures(c.Request().Context(), user.SiteID, user.Username)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/login")
+}
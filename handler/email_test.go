@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestForgotPasswordSendsInBackground(t *testing.T) {
+	h := newTestHandler(t)
+	createTestUser(t, h, "alice", "password")
+	mailer := h.Mailer.(*testMailer)
+
+	for _, addr := range []string{"alice@example.com", "nobody@example.com"} {
+		c, rec := newTestContext(http.MethodPost, "/password/forgot", url.Values{"email": {addr}})
+		// The request is over once responded
+		ctx, cancel := context.WithCancel(c.Request().Context())
+		c.SetRequest(c.Request().WithContext(ctx))
+		if err := h.ForgotPassword(c); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("asking for %s: status %d", addr, rec.Code)
+		}
+	}
+
+	// Shutting down waits for the emails like this
+	h.Background.Wait()
+	sent := mailer.Sent()
+	if len(sent) != 1 || sent[0].To != "alice@example.com" || !strings.Contains(sent[0].Text, "/password/reset?token=") {
+		t.Errorf("emails sent: %+v", sent)
+	}
+}
@@ -1,12 +1,122 @@
 package handler
 
-import "database/sql"
+import (
+	"backyard/domain"
+	"backyard/email"
+	"backyard/sso"
+	"backyard/webhook"
+	"crypto/rand"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
 
 type Handler struct {
-	DB           *sql.DB
+	Posts        domain.PostRepository
+	Users        domain.UserRepository
+	Configs      domain.ConfigRepository
+	Images       domain.ImageRepository
+	Sites        domain.SiteRepository
+	UserDomains  domain.UserDomainRepository
+	Sessions     domain.SessionRepository
+	Logins       domain.LoginRepository
+	Tokens       domain.UserTokenRepository
+	TwoFactor    domain.TwoFactorRepository
+	Passkeys     domain.PasskeyRepository
+	Identities   domain.IdentityRepository
+	Invites      domain.InviteRepository
+	Roles        domain.RoleRepository
+	AccessTokens domain.AccessTokenRepository
+	Webhooks     domain.WebhookRepository
+	// WebhookDispatcher is told about new webhook deliveries, nil if they are
+	// only sent when it next polls.
+	WebhookDispatcher *webhook.Dispatcher
+	// Mailer sends the emails rendered with Emails.
+	Mailer email.Sender
+	Emails *email.Templates
+	// LoginThrottle slows down password guessing from a single IP address.
+	LoginThrottle *LoginThrottle
+	// ResetThrottle limits how many password reset emails a single IP address
+	// can ask for.
+	ResetThrottle *LoginThrottle
+	// SSO is the OpenID Connect identity provider users can log in with, nil
+	// if there is none.
+	SSO *sso.Provider
+	// Resolver looks up the DNS records proving custom domain ownership.
+	Resolver     domain.TXTResolver
 	JWTSecret    string
 	EnableSignup bool
 	Environment  string
+	// SecureCookies marks cookies to be only sent over HTTPS.
+	SecureCookies bool
+	// Themes lists the names of the themes the admin can pick from.
+	Themes []string
+	// Assets holds the default static files, used when the instance has not
+	// set its own.
+	Assets fs.FS
+	// BaseURL is the scheme, host and port the default site is served on.
+	// Absolute links to other sites use its scheme and port with their
+	// hostname.
+	BaseURL *url.URL
+	// ReservedUsernames are the names users cannot take, as routes like
+	// /login would take precedence over their profile.
+	ReservedUsernames []string
+	// Background tracks the work going on after responding, like sending
+	// emails and webhook deliveries, which shutting down waits for.
+	Background sync.WaitGroup
+
+	passkeyChallenges answeredChallenges
+}
+
+// goBackground runs f after responding, tracked by h.Background. f must not
+// use the context of the request, which is cancelled once responded.
+func (h *Handler) goBackground(f func()) {
+	h.Background.Add(1)
+	go func() {
+		defer h.Background.Done()
+		f()
+	}()
 }
 
 var PrivateKey = ""
+
+// usernamePattern matches the usernames people can choose, which are part of
+// the URLs of their pages.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// usernameReserved reports if username is one of ReservedUsernames, ignoring
+// case.
+func (h *Handler) usernameReserved(username string) bool {
+	return slices.ContainsFunc(h.ReservedUsernames, func(reserved string) bool {
+		return strings.EqualFold(reserved, username)
+	})
+}
+
+// randomToken returns n random bytes encoded as hex.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newCookie returns a cookie for the whole site that scripts cannot read and
+// that is not sent on cross-site subrequests.
+func (h *Handler) newCookie(name string, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   h.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/email"
+	"backyard/storage/memory"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testRenderer writes the name of the template and its data instead of
+// rendering it, so tests can tell which page a handler responded with, and
+// which message it shows.
+type testRenderer struct{}
+
+func (testRenderer) Render(w io.Writer, name string, data any, c echo.Context) error {
+	_, err := fmt.Fprintf(w, "%s %+v", name, data)
+	return err
+}
+
+// testMailer keeps the emails it is given instead of sending them.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []email.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, message email.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+func (m *testMailer) Sent() []email.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.sent)
+}
+
+// newTestHandler returns a handler of the default site, with its default
+// roles and open to sign-up, backed by in-memory repositories.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	users := memory.NewUserRepository()
+	roles := memory.NewRoleRepository()
+	for _, role := range domain.DefaultRoles {
+		role.ID = uuid.NewString()
+		role.SiteID = domain.DefaultSiteID
+		if err := roles.Create(context.Background(), role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configs := memory.NewConfigRepository(domain.Config{
+		ID:         uuid.NewString(),
+		SiteID:     domain.DefaultSiteID,
+		Title:      "Backyard",
+		SignupMode: domain.SignupOpen,
+	})
+	posts := memory.NewPostRepository(users)
+	images := memory.NewImageRepository()
+	users.SetContent(posts, images)
+	invites := memory.NewInviteRepository()
+	users.SetSignUp(roles, invites)
+	emails, err := email.ParseTemplates(os.DirFS(".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("http://example.com")
+	return &Handler{
+		Posts:         posts,
+		Users:         users,
+		Configs:       configs,
+		Images:        images,
+		Sites:         memory.NewSiteRepository(users, roles, configs),
+		UserDomains:   memory.NewUserDomainRepository(),
+		Sessions:      memory.NewSessionRepository(),
+		Logins:        memory.NewLoginRepository(),
+		Tokens:        memory.NewUserTokenRepository(),
+		TwoFactor:     memory.NewTwoFactorRepository(),
+		Passkeys:      memory.NewPasskeyRepository(),
+		Identities:    memory.NewIdentityRepository(),
+		Invites:       invites,
+		Roles:         roles,
+		AccessTokens:  memory.NewAccessTokenRepository(),
+		Webhooks:      memory.NewWebhookRepository(),
+		LoginThrottle: NewLoginThrottle(),
+		ResetThrottle: NewLoginThrottle(),
+		Mailer:        &testMailer{},
+		Emails:        emails,
+		JWTSecret:     "test secret",
+		BaseURL:       base,
+	}
+}
+
+// createTestUser adds a user with a verified email to the default site.
+func createTestUser(t *testing.T, h *Handler, username string, password string) domain.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := username + "@example.com"
+	now := time.Now()
+	user := domain.User{
+		ID:              uuid.NewString(),
+		SiteID:          domain.DefaultSiteID,
+		Username:        username,
+		Email:           &email,
+		EmailVerifiedAt: &now,
+		Password:        string(hash),
+	}
+	if err := h.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// sessionCookie starts a session for the user and returns its authorization
+// cookie.
+func sessionCookie(t *testing.T, h *Handler, user domain.User) *http.Cookie {
+	t.Helper()
+	session := domain.Session{
+		ID:        uuid.NewString(),
+		SiteID:    user.SiteID,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := h.Sessions.Create(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	cookie, err := h.authorizationCookie(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie
+}
+
+// newTestContext returns the context of a request with the form, if any, and
+// the cookies, and the recorder of its response.
+func newTestContext(method string, target string, form url.Values, cookies ...*http.Cookie) (echo.Context, *httptest.ResponseRecorder) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req := httptest.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	e := echo.New()
+	e.Renderer = testRenderer{}
+	return e.NewContext(req, rec), rec
+}
+
+// responseCookie returns the cookie the response sets with name, or nil.
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"backyard/domain"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const maxImageSize = 2 << 20
+
+// allowedImageTypes are the content types accepted on upload. SVG is left out
+// because it can carry scripts.
+var allowedImageTypes = map[string]bool{
+	"image/png":    true,
+	"image/jpeg":   true,
+	"image/gif":    true,
+	"image/webp":   true,
+	"image/x-icon": true,
+}
+
+// uploadImage stores the file sent in the given form field. It returns an
+// empty image when no file was sent.
+func (h *Handler) uploadImage(c echo.Context, userID string, field string) (domain.Image, error) {
+	fileHeader, err := c.FormFile(field)
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return domain.Image{}, nil
+		}
+		return domain.Image{}, err
+	}
+	if fileHeader.Size > maxImageSize {
+		return domain.Image{}, fmt.Errorf("image too big, the maximum size is %d bytes", maxImageSize)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return domain.Image{}, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize))
+	if err != nil {
+		return domain.Image{}, err
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedImageTypes[contentType] {
+		return domain.Image{}, fmt.Errorf("unsupported image type: %s", contentType)
+	}
+	image := domain.Image{
+		ID:          uuid.NewString(),
+		SiteID:      CurrentSite(c).ID,
+		UserID:      userID,
+		Filename:    filepath.Base(fileHeader.Filename),
+		ContentType: contentType,
+		Data:        data,
+	}
+	err = h.Images.Create(c.Request().Context(), image)
+	if err != nil {
+		return domain.Image{}, err
+	}
+	return image, nil
+}
+
+// imageFormValue returns the URL of the image uploaded in field+"_file", or the
+// URL selected in field when nothing was uploaded.
+func (h *Handler) imageFormValue(c echo.Context, userID string, field string) (string, error) {
+	image, err := h.uploadImage(c, userID, field+"_file")
+	if err != nil {
+		return "", err
+	}
+	if image.ID != "" {
+		return image.URL(), nil
+	}
+	return c.FormValue(field), nil
+}
+
+// UploadImage stores the image sent in the file form field and answers with
+// its URL, for scripts and editors that upload images on their own. Only
+// users who may create posts can upload images for them.
+func (h *Handler) UploadImage(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return echo.ErrUnauthorized
+	}
+	allowed, err := h.can(c, domain.PermissionCreatePosts)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return echo.NewHTTPError(http.StatusForbidden, "your role does not allow uploading images")
+	}
+	image, err := h.uploadImage(c, userID, "file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if image.ID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing file")
+	}
+	url := h.siteURL(c) + image.URL()
+	c.Response().Header().Set(echo.HeaderLocation, url)
+	return c.JSON(http.StatusCreated, map[string]string{"url": url})
+}
+
+func (h *Handler) GetImage(c echo.Context) error {
+	image, err := h.Images.GetByID(c.Request().Context(), CurrentSite(c).ID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	// Images are never modified, a new upload gets a new ID
+	c.Response().Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.Blob(http.StatusOK, image.ContentType, image.Data)
+}
+
+// GetFavicon serves the favicon chosen in the instance configuration, or the
+// default one when none is set.
+func (h *Handler) GetFavicon(c echo.Context) error {
+	config, err := h.Configs.GetActive(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	// The favicon URL never changes, so browsers must revalidate it
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	if id, ok := strings.CutPrefix(config.Favicon, "/media/"); ok {
+		image, err := h.Images.GetByID(c.Request().Context(), CurrentSite(c).ID, id)
+		if err != nil {
+			return err
+		}
+		return c.Blob(http.StatusOK, image.ContentType, image.Data)
+	}
+	if config.Favicon != "" {
+		return c.Redirect(http.StatusFound, config.Favicon)
+	}
+	data, err := fs.ReadFile(h.Assets, "favicon.ico")
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, "image/x-icon", data)
+}
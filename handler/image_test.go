@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"backyard/domain"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// uploadTestImage posts a PNG image to UploadImage as the user and returns
+// the status of the response.
+func uploadTestImage(t *testing.T, h *Handler, user domain.User) int {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("\x89PNG\r\n\x1a\n"))
+	form.Close()
+
+	c, rec := newTestContext(http.MethodPost, "/media", nil, sessionCookie(t, h, user))
+	c.Request().Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	c.Request().Body = io.NopCloser(&body)
+	err = h.UploadImage(c)
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code
+}
+
+func TestUploadImageNeedsCreatePosts(t *testing.T) {
+	h := newTestHandler(t)
+	reader := createTestUser(t, h, "reader", "password")
+	if err := h.Roles.Assign(context.Background(), domain.DefaultSiteID, reader.ID, domain.RoleReader); err != nil {
+		t.Fatal(err)
+	}
+	author := createTestUser(t, h, "author", "password")
+	if err := h.Roles.Assign(context.Background(), domain.DefaultSiteID, author.ID, domain.RoleAuthor); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := uploadTestImage(t, h, reader); status != http.StatusForbidden {
+		t.Errorf("upload of a reader: status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := uploadTestImage(t, h, author); status != http.StatusCreated {
+		t.Errorf("upload of an author: status %d, want %d", status, http.StatusCreated)
+	}
+	images, err := h.Images.List(context.Background(), domain.DefaultSiteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].UserID != author.ID {
+		t.Errorf("images after the uploads: %+v", images)
+	}
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"backyard/domain"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxInviteUses = 100
+	maxInviteDays = 90
+)
+
+// signupMode returns how people can sign up to the site. The -enable-signup
+// flag, the site setting and the dev environment open sign-up on sites whose
+// configuration keeps it closed.
+func (h *Handler) signupMode(c echo.Context, config domain.Config) string {
+	if config.SignupMode == domain.SignupClosed && (h.Environment == "dev" || h.EnableSignup || CurrentSite(c).EnableSignup) {
+		return domain.SignupOpen
+	}
+	return config.SignupMode
+}
+
+// canInvite reports if the logged in user may create invite codes.
+func (h *Handler) canInvite(c echo.Context, config domain.Config) (bool, error) {
+	if h.getUserID(c) != "" && config.Inviters == domain.InvitersUsers {
+		return true, nil
+	}
+	return h.can(c, domain.PermissionCreateInvites)
+}
+
+// checkInvite returns the message key explaining why code does not let
+// people sign up, or an empty string if it does.
+func (h *Handler) checkInvite(c echo.Context, code string) (string, error) {
+	if code == "" {
+		return "invites.error.required", nil
+	}
+	invite, err := h.Invites.GetByCode(c.Request().Context(), CurrentSite(c).ID, code)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && !invite.Usable(time.Now())) {
+		return "invites.error.invalid", nil
+	}
+	return "", err
+}
+
+type InviteDTO struct {
+	Code      string
+	Link      string
+	Uses      int
+	MaxUses   int
+	Usable    bool
+	Revoked   bool
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type InviteeDTO struct {
+	Username string
+	JoinedAt time.Time
+}
+
+// GetInvites lists the invite codes of the user and the people that signed
+// up with them.
+func (h *Handler) GetInvites(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	return h.renderInvites(c, userID, "")
+}
+
+func (h *Handler) renderInvites(c echo.Context, userID string, errorMessage string) error {
+	ctx := c.Request().Context()
+	siteID := CurrentSite(c).ID
+	config, err := h.Configs.GetActive(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	allowed, err := h.canInvite(c, config)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return renderMessage(c, http.StatusForbidden, "invites.title", "invites.error.not_allowed")
+	}
+
+	invites, err := h.Invites.ListByCreator(ctx, siteID, userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	dtos := []InviteDTO{}
+	for _, i := range invites {
+		dtos = append(dtos, InviteDTO{
+			Code:      i.Code,
+			Link:      h.siteURL(c) + "/signup?invite=" + i.Code,
+			Uses:      i.Uses,
+			MaxUses:   i.MaxUses,
+			Usable:    i.Usable(now),
+			Revoked:   i.RevokedAt != nil,
+			ExpiresAt: i.ExpiresAt,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+
+	invitees, err := h.Invites.ListInvitees(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	invited := []InviteeDTO{}
+	for _, i := range invitees {
+		if i.InviterID != userID {
+			continue
+		}
+		user, err := h.Users.GetByID(ctx, i.UserID)
+		if err != nil {
+			return err
+		}
+		invited = append(invited, InviteeDTO{Username: user.Username, JoinedAt: i.CreatedAt})
+	}
+
+	return c.Render(http.StatusOK, "user-invites.html", struct {
+		InviteOnly bool
+		Invites    []InviteDTO
+		Invited    []InviteeDTO
+		MaxUses    int
+		MaxDays    int
+		Error      string
+	}{
+		InviteOnly: h.signupMode(c, config) == domain.SignupInvite,
+		Invites:    dtos,
+		Invited:    invited,
+		MaxUses:    maxInviteUses,
+		MaxDays:    maxInviteDays,
+		Error:      errorMessage,
+	})
+}
+
+// CreateInvite creates an invite code usable the given number of times for
+// the given number of days.
+func (h *Handler) CreateInvite(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	config, err := h.Configs.GetActive(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	allowed, err := h.canInvite(c, config)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return renderMessage(c, http.StatusForbidden, "invites.title", "invites.error.not_allowed")
+	}
+	uses, err := strconv.Atoi(c.FormValue("uses"))
+	if err != nil || uses < 1 || uses > maxInviteUses {
+		return h.renderInvites(c, userID, "invites.error.uses")
+	}
+	days, err := strconv.Atoi(c.FormValue("days"))
+	if err != nil || days < 1 || days > maxInviteDays {
+		return h.renderInvites(c, userID, "invites.error.days")
+	}
+	code, err := randomToken(8)
+	if err != nil {
+		return err
+	}
+	err = h.Invites.Create(c.Request().Context(), domain.Invite{
+		Code:      code,
+		SiteID:    CurrentSite(c).ID,
+		CreatedBy: userID,
+		MaxUses:   uses,
+		ExpiresAt: time.Now().Add(time.Duration(days) * 24 * time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/settings/invites")
+}
+
+// RevokeInvite stops an invite code of the user from letting more people in.
+func (h *Handler) RevokeInvite(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	err := h.Invites.Revoke(c.Request().Context(), CurrentSite(c).ID, userID, c.Param("code"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/settings/invites")
+}
+
+// InviteNode is a user in the invite tree, with the users they invited.
+type InviteNode struct {
+	Username string
+	JoinedAt time.Time
+	Invited  []InviteNode
+}
+
+// GetInviteTree shows the admin who invited whom. The roots are the users
+// that signed up without an invite, or whose inviter was deleted.
+func (h *Handler) GetInviteTree(c echo.Context) error {
+	ctx := c.Request().Context()
+	invitees, err := h.Invites.ListInvitees(ctx, CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+
+	invited := map[string][]domain.Invitee{}
+	isInvitee := map[string]bool{}
+	for _, i := range invitees {
+		invited[i.InviterID] = append(invited[i.InviterID], i)
+		isInvitee[i.UserID] = true
+	}
+	usernames := map[string]string{}
+	username := func(id string) string {
+		if _, ok := usernames[id]; !ok {
+			if u, err := h.Users.GetByID(ctx, id); err == nil {
+				usernames[id] = u.Username
+			}
+		}
+		return usernames[id]
+	}
+	var build func(i domain.Invitee) InviteNode
+	build = func(i domain.Invitee) InviteNode {
+		node := InviteNode{Username: username(i.UserID), JoinedAt: i.CreatedAt}
+		for _, child := range invited[i.UserID] {
+			node.Invited = append(node.Invited, build(child))
+		}
+		return node
+	}
+
+	roots := []InviteNode{}
+	for inviterID := range invited {
+		if isInvitee[inviterID] {
+			continue
+		}
+		root := InviteNode{}
+		if inviterID != "" {
+			root.Username = username(inviterID)
+		}
+		for _, child := range invited[inviterID] {
+			root.Invited = append(root.Invited, build(child))
+		}
+		roots = append(roots, root)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].Username < roots[j].Username
+	})
+	return c.Render(http.StatusOK, "admin-invites.html", struct {
+		Roots []InviteNode
+	}{
+		Roots: roots,
+	})
+}
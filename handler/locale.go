@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"backyard/i18n"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const localeContextKey = "locale"
+
+// LocaleMiddleware picks the language of the request and stores it in the
+// context. The preference of the logged in user comes first, then the one
+// picked by anonymous visitors, then the browser languages and last the
+// instance default.
+func (h *Handler) LocaleMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Set(localeContextKey, h.locale(c))
+		return next(c)
+	}
+}
+
+func (h *Handler) locale(c echo.Context) string {
+	if userID := h.getUserID(c); userID != "" {
+		if user, err := h.Users.GetByID(c.Request().Context(), userID); err == nil && i18n.Supported(user.Locale) {
+			return user.Locale
+		}
+	}
+	if cookie, err := c.Cookie("Locale"); err == nil && i18n.Supported(cookie.Value) {
+		return cookie.Value
+	}
+	if locale := i18n.Match(c.Request().Header.Get("Accept-Language")); locale != "" {
+		return locale
+	}
+	if config, err := h.Configs.GetActive(c.Request().Context(), CurrentSite(c).ID); err == nil && i18n.Supported(config.Locale) {
+		return config.Locale
+	}
+	return i18n.Default
+}
+
+// CurrentLocale returns the language the request is served in.
+func CurrentLocale(c echo.Context) string {
+	if locale, ok := c.Get(localeContextKey).(string); ok {
+		return locale
+	}
+	return i18n.Default
+}
+
+// T translates a message to the language of the request.
+func T(c echo.Context, key string, args ...any) string {
+	return i18n.T(CurrentLocale(c), key, args...)
+}
+
+func (h *Handler) GetLanguageForm(c echo.Context) error {
+	locale := ""
+	if userID := h.getUserID(c); userID != "" {
+		if user, err := h.Users.GetByID(c.Request().Context(), userID); err == nil {
+			locale = user.Locale
+		}
+	} else if cookie, err := c.Cookie("Locale"); err == nil {
+		locale = cookie.Value
+	}
+	return c.Render(http.StatusOK, "user-language.html", struct {
+		Locale  string
+		Locales []string
+	}{
+		Locale:  locale,
+		Locales: i18n.Locales(),
+	})
+}
+
+// SaveLanguage stores the language preference in the account of logged in
+// users, and in a cookie for anonymous visitors.
+func (h *Handler) SaveLanguage(c echo.Context) error {
+	locale := c.FormValue("locale")
+	if locale != "" && !i18n.Supported(locale) {
+		return c.HTML(http.StatusBadRequest, T(c, "error.bad_request"))
+	}
+	if userID := h.getUserID(c); userID != "" {
+		err := h.Users.SetLocale(c.Request().Context(), userID, locale)
+		if err != nil {
+			return err
+		}
+		return c.Redirect(http.StatusFound, "/")
+	}
+
+	expires := time.Now().Add(time.Hour * 24 * 365)
+	if locale == "" {
+		expires = time.Now().Add(-1 * time.Second)
+	}
+	c.SetCookie(h.newCookie("Locale", locale, expires))
+	return c.Redirect(http.StatusFound, "/")
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"backyard/domain"
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequestUserID returns the user the request was authenticated as, if a
+// handler looked it up. It never queries the database, so the access log can
+// call it for every request.
+func RequestUserID(c echo.Context) string {
+	if session, ok := c.Get(sessionContextKey).(*domain.Session); ok && session.ID != "" {
+		return session.UserID
+	}
+	if token, ok := c.Get(accessTokenContextKey).(*domain.AccessToken); ok && token.ID != "" {
+		return token.UserID
+	}
+	return ""
+}
+
+// RequestAttrs returns the request and user IDs to log with the messages of
+// a request.
+func RequestAttrs(c echo.Context) []any {
+	attrs := []any{slog.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID))}
+	if userID := RequestUserID(c); userID != "" {
+		attrs = append(attrs, slog.String("user_id", userID))
+	}
+	return attrs
+}
+
+// LogError logs an error of a request that does not fail it, like a webhook
+// that could not be queued.
+func LogError(c echo.Context, err error) {
+	slog.ErrorContext(c.Request().Context(), err.Error(), RequestAttrs(c)...)
+}
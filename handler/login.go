@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"backyard/domain"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxLoginFailures is how many consecutive wrong passwords lock a username out.
+	maxLoginFailures = 5
+	// lockoutDuration is how long the first lockout lasts. Every further
+	// failure doubles it, up to maxLockoutDuration.
+	lockoutDuration    = 15 * time.Minute
+	maxLockoutDuration = 24 * time.Hour
+	// loginFailuresReset is how long after the last failure the count starts
+	// again from zero.
+	loginFailuresReset = 24 * time.Hour
+)
+
+// dummyPasswordHash is compared with the password when the username does not
+// exist, so the response takes as long as for a wrong password.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("backyard"), bcrypt.DefaultCost)
+
+// LoginThrottle slows down failed logins coming from the same IP address.
+// The first few failures are free, then every attempt has to wait twice as
+// long as the previous one.
+type LoginThrottle struct {
+	mu       sync.Mutex
+	failures map[string]ipFailures
+}
+
+type ipFailures struct {
+	count int
+	last  time.Time
+}
+
+const (
+	freeLoginFailures   = 5
+	maxLoginBackoff     = 15 * time.Minute
+	loginFailuresExpiry = time.Hour
+)
+
+func NewLoginThrottle() *LoginThrottle {
+	return &LoginThrottle{failures: map[string]ipFailures{}}
+}
+
+func (t *LoginThrottle) backoff(count int) time.Duration {
+	if count < freeLoginFailures {
+		return 0
+	}
+	shift := count - freeLoginFailures
+	if shift > 10 {
+		return maxLoginBackoff
+	}
+	return min(time.Second<<shift, maxLoginBackoff)
+}
+
+// Allow reports if the IP address may try to log in now.
+func (t *LoginThrottle) Allow(ip string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.failures[ip]
+	if !ok {
+		return true
+	}
+	return !now.Before(f.last.Add(t.backoff(f.count)))
+}
+
+// Fail records a failed login from the IP address.
+func (t *LoginThrottle) Fail(ip string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f := t.failures[ip]
+	if now.Sub(f.last) > loginFailuresExpiry {
+		f.count = 0
+	}
+	f.count++
+	f.last = now
+	t.failures[ip] = f
+
+	for key, f := range t.failures {
+		if now.Sub(f.last) > loginFailuresExpiry {
+			delete(t.failures, key)
+		}
+	}
+}
+
+// checkLoginAllowed returns errLoginThrottled if the IP address or the
+// username made too many failed attempts lately.
+func (h *Handler) checkLoginAllowed(c echo.Context, username string) error {
+	ctx := c.Request().Context()
+	siteID := CurrentSite(c).ID
+	now := time.Now()
+
+	if !h.LoginThrottle.Allow(c.RealIP(), now) {
+		return errLoginThrottled
+	}
+	failure, err := h.Logins.GetFailures(ctx, siteID, username)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	if failure.Locked(now) {
+		return errLoginThrottled
+	}
+	if failure.Failures > 0 && now.Sub(failure.UpdatedAt) > loginFailuresReset {
+		return h.Logins.ClearFailures(ctx, siteID, username)
+	}
+	return nil
+}
+
+// checkPassword verifies the credentials of a login attempt, enforcing the
+// IP throttle and the username lockout. Every failure returns the same
+// errLoginFailed or errLoginThrottled, whether the username exists or not.
+func (h *Handler) checkPassword(c echo.Context, username string, password string) (domain.User, error) {
+	if err := h.checkLoginAllowed(c, username); err != nil {
+		return domain.User{}, err
+	}
+
+	user, err := h.Users.GetByUsername(c.Request().Context(), CurrentSite(c).ID, username)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return domain.User{}, err
+	}
+	hash := dummyPasswordHash
+	if err == nil {
+		hash = []byte(user.Password)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || user.ID == "" {
+		return domain.User{}, h.recordLoginFailure(c, username, user.ID)
+	}
+	return user, nil
+}
+
+// checkCurrentPassword verifies the password a logged in user enters to
+// confirm a sensitive change. It is throttled and counts towards the lockout
+// like a login, so a stolen session cannot be used to guess the password. It
+// returns errLoginFailed or errLoginThrottled when the check fails.
+func (h *Handler) checkCurrentPassword(c echo.Context, user domain.User) error {
+	if err := h.checkLoginAllowed(c, user.Username); err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(c.FormValue("current_password"))) != nil {
+		return h.recordLoginFailure(c, user.Username, user.ID)
+	}
+	return nil
+}
+
+// currentPasswordMessage returns the message key telling why
+// checkCurrentPassword failed with err, or false for other errors.
+func currentPasswordMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, errLoginFailed):
+		return "sessions.error.wrong_password", true
+	case errors.Is(err, errLoginThrottled):
+		return "error.too_many_attempts", true
+	default:
+		return "", false
+	}
+}
+
+// finishLogin starts the session of a user that passed every login step,
+// unless they are suspended or have to choose a new password first.
+func (h *Handler) finishLogin(c echo.Context, user domain.User) error {
+	if user.SuspendedAt != nil {
+		return errAccountSuspended
+	}
+	if user.PasswordResetRequired {
+		return errPasswordResetRequired
+	}
+	err := h.Logins.ClearFailures(c.Request().Context(), user.SiteID, user.Username)
+	if err != nil {
+		return err
+	}
+	err = h.addLoginEvent(c, user.Username, user.ID, domain.LoginEventSuccess)
+	if err != nil {
+		return err
+	}
+	return h.startSession(c, user)
+}
+
+var (
+	errLoginFailed    = errors.New("wrong username or password")
+	errLoginThrottled = errors.New("too many failed logins")
+	// errAccountSuspended is returned for suspended users that passed
+	// every other login step, so telling them does not help guessing.
+	errAccountSuspended = errors.New("account suspended")
+	// errPasswordResetRequired is returned for the right password of a user
+	// an admin asked to choose a new one.
+	errPasswordResetRequired = errors.New("password reset required")
+)
+
+// loginError renders the response for a failed login.
+func loginError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, errLoginFailed):
+		return c.HTML(http.StatusBadRequest, T(c, "error.wrong_credentials"))
+	case errors.Is(err, errLoginThrottled):
+		return c.HTML(http.StatusTooManyRequests, T(c, "error.too_many_attempts"))
+	case errors.Is(err, errAccountSuspended):
+		return c.HTML(http.StatusForbidden, T(c, "error.suspended"))
+	case errors.Is(err, errPasswordResetRequired):
+		return c.HTML(http.StatusForbidden, T(c, "error.password_reset_required"))
+	default:
+		return err
+	}
+}
+
+// recordLoginFailure counts a failed attempt against the IP address and the
+// username, locking it out after too many. It returns errLoginFailed, unless
+// recording fails.
+func (h *Handler) recordLoginFailure(c echo.Context, username string, userID string) error {
+	h.LoginThrottle.Fail(c.RealIP(), time.Now())
+	err := h.addLoginEvent(c, username, userID, domain.LoginEventFailure)
+	if err != nil {
+		return err
+	}
+	failure, err := h.Logins.IncrementFailures(c.Request().Context(), CurrentSite(c).ID, username)
+	if err != nil {
+		return err
+	}
+	if failure.Failures < maxLoginFailures {
+		return errLoginFailed
+	}
+
+	duration := maxLockoutDuration
+	if shift := failure.Failures - maxLoginFailures; shift < 10 {
+		duration = min(lockoutDuration<<shift, maxLockoutDuration)
+	}
+	err = h.Logins.Lock(c.Request().Context(), CurrentSite(c).ID, username, time.Now().Add(duration))
+	if err != nil {
+		return err
+	}
+	err = h.addLoginEvent(c, username, userID, domain.LoginEventLockout)
+	if err != nil {
+		return err
+	}
+	return errLoginFailed
+}
+
+func (h *Handler) addLoginEvent(c echo.Context, username string, userID string, event string) error {
+	return h.Logins.AddEvent(c.Request().Context(), domain.LoginEvent{
+		ID:       uuid.NewString(),
+		SiteID:   CurrentSite(c).ID,
+		Username: username,
+		UserID:   userID,
+		IP:       c.RealIP(),
+		Event:    event,
+		ActorID:  h.getUserID(c),
+	})
+}
+
+// loginEventsShown is how many audit log entries the lockouts page lists.
+const loginEventsShown = 100
+
+// GetLockouts lists the locked out usernames and the latest logins to the admin.
+func (h *Handler) GetLockouts(c echo.Context) error {
+	locked, err := h.Logins.ListLocked(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	events, err := h.Logins.ListEvents(c.Request().Context(), CurrentSite(c).ID, loginEventsShown)
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "admin-lockouts.html", struct {
+		Locked []domain.LoginFailure
+		Events []domain.LoginEvent
+	}{
+		Locked: locked,
+		Events: events,
+	})
+}
+
+// Unlock lifts the lockout of a username before it expires.
+func (h *Handler) Unlock(c echo.Context) error {
+	username := c.FormValue("username")
+	err := h.Logins.ClearFailures(c.Request().Context(), CurrentSite(c).ID, username)
+	if err != nil {
+		return err
+	}
+	lockedUserID := ""
+	if user, err := h.Users.GetByUsername(c.Request().Context(), CurrentSite(c).ID, username); err == nil {
+		lockedUserID = user.ID
+	}
+	err = h.addLoginEvent(c, username, lockedUserID, domain.LoginEventUnlock)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/lockouts")
+}
@@ -0,0 +1,458 @@
+package handler
+
+import (
+	"backyard/domain"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// maxNoteTitleLength is the length of the titles made up for notes, the posts
+// Micropub clients send without a name.
+const maxNoteTitleLength = 60
+
+var errInsufficientScope = errors.New("insufficient scope")
+
+// MicropubError is the body of the errors answered by the Micropub endpoint,
+// as the spec defines them.
+type MicropubError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// RenderMicropubError answers err the way Micropub clients expect. Like in the
+// JSON API, errors other than echo.HTTPError are not detailed.
+func RenderMicropubError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	description := http.StatusText(status)
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		status = he.Code
+		description = fmt.Sprint(he.Message)
+	}
+	code := "invalid_request"
+	switch {
+	case status == http.StatusUnauthorized:
+		code = "unauthorized"
+	case status == http.StatusForbidden && he != nil && errors.Is(he.Internal, errInsufficientScope):
+		code = "insufficient_scope"
+	case status == http.StatusForbidden:
+		code = "forbidden"
+	case status >= http.StatusInternalServerError:
+		code = "server_error"
+	}
+	return c.JSON(status, MicropubError{Error: code, Description: description})
+}
+
+// MicropubAccessToken moves the access_token form field Micropub clients may
+// send instead of the Authorization header into the header, where the CSRF
+// and credential middlewares look for tokens. It must run before them.
+func MicropubAccessToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if req.Method == http.MethodPost && strings.HasPrefix(req.URL.Path, "/micropub") && req.Header.Get(echo.HeaderAuthorization) == "" {
+			if token := c.FormValue("access_token"); token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			}
+		}
+		return next(c)
+	}
+}
+
+// micropubUserID returns the logged in user, or the user of the access token
+// if it has one of the scopes.
+func (h *Handler) micropubUserID(c echo.Context, scopes ...string) (string, error) {
+	for _, scope := range scopes {
+		c.Set(tokenScopeContextKey, scope)
+		if userID := h.getUserID(c); userID != "" {
+			return userID, nil
+		}
+	}
+	if _, ok := h.currentAccessToken(c); ok {
+		return "", echo.NewHTTPError(http.StatusForbidden, "the access token needs the "+strings.Join(scopes, " or ")+" scope").SetInternal(errInsufficientScope)
+	}
+	return "", echo.NewHTTPError(http.StatusUnauthorized, "missing or invalid access token")
+}
+
+// micropubRequest is a Micropub request with a JSON body: a post to create
+// with type and properties, or an action on the post at URL.
+type micropubRequest struct {
+	Type       []string         `json:"type"`
+	Properties map[string][]any `json:"properties"`
+	Action     string           `json:"action"`
+	URL        string           `json:"url"`
+	Replace    map[string][]any `json:"replace"`
+	Add        map[string][]any `json:"add"`
+	// Delete lists the properties to remove, or maps them to the values to
+	// remove.
+	Delete any `json:"delete"`
+}
+
+// Micropub creates, updates and deletes posts for Micropub clients. Form
+// encoded requests can create and delete posts, JSON requests can also update
+// them.
+func (h *Handler) Micropub(c echo.Context) error {
+	var req micropubRequest
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "the body is not valid JSON")
+		}
+		if req.Action == "" && !slices.Contains(req.Type, "h-entry") {
+			return echo.NewHTTPError(http.StatusBadRequest, "only h-entry posts are supported")
+		}
+	} else {
+		form, err := c.FormParams()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "the body is not a valid form")
+		}
+		req.Action = form.Get("action")
+		req.URL = form.Get("url")
+		if req.Action == "" && form.Get("h") != "entry" {
+			return echo.NewHTTPError(http.StatusBadRequest, "only h=entry posts are supported")
+		}
+		req.Properties = micropubFormProperties(form)
+	}
+
+	switch req.Action {
+	case "":
+		return h.micropubCreate(c, req.Properties)
+	case "update":
+		return h.micropubUpdate(c, req)
+	case "delete":
+		return h.micropubDelete(c, req.URL)
+	case "undelete":
+		return echo.NewHTTPError(http.StatusBadRequest, "deleted posts cannot be restored")
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, "unknown action "+req.Action)
+}
+
+// micropubFormProperties returns the properties of a form encoded post. Fields
+// with several values may end with [].
+func micropubFormProperties(form url.Values) map[string][]any {
+	properties := map[string][]any{}
+	for name, values := range form {
+		if name == "h" || name == "access_token" || strings.HasPrefix(name, "mp-") {
+			continue
+		}
+		name = strings.TrimSuffix(name, "[]")
+		for _, value := range values {
+			properties[name] = append(properties[name], value)
+		}
+	}
+	return properties
+}
+
+func (h *Handler) micropubCreate(c echo.Context, properties map[string][]any) error {
+	userID, err := h.micropubUserID(c, domain.ScopeWritePosts)
+	if err != nil {
+		return err
+	}
+	allowed, err := h.can(c, domain.PermissionCreatePosts)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return echo.NewHTTPError(http.StatusForbidden, "your role does not allow creating posts")
+	}
+
+	p := domain.Post{
+		ID:     uuid.NewString(),
+		SiteID: CurrentSite(c).ID,
+		Access: domain.Access{UserID: userID},
+	}
+	setMicropubProperties(&p, properties)
+	// Photos are added at the end of the content, uploaded or by URL
+	photos := properties["photo"]
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		image, err := h.uploadImage(c, userID, "photo")
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if image.ID != "" {
+			photos = append(photos, h.siteURL(c)+image.URL())
+		}
+	}
+	for _, photo := range photos {
+		src, alt := micropubPhoto(photo)
+		if src != "" {
+			p.Content = strings.TrimSpace(p.Content + "\n\n![" + alt + "](" + src + ")")
+		}
+	}
+	if p.Content == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "content is required")
+	}
+	if p.Title == "" {
+		p.Title = noteTitle(p.Content)
+	}
+
+	err = h.Posts.Create(c.Request().Context(), p)
+	if err != nil {
+		return err
+	}
+	h.postChanged(c, domain.Post{}, p)
+	c.Response().Header().Set(echo.HeaderLocation, h.siteURL(c)+"/posts/"+p.ID)
+	return c.NoContent(http.StatusCreated)
+}
+
+// setMicropubProperties copies the properties backed by the post model into
+// p. Other properties are ignored.
+func setMicropubProperties(p *domain.Post, properties map[string][]any) {
+	if values, ok := properties["name"]; ok {
+		p.Title = strings.TrimSpace(strings.Join(micropubStrings(values), " "))
+	}
+	if values, ok := properties["content"]; ok {
+		content := []string{}
+		for _, value := range values {
+			content = append(content, micropubContent(value))
+		}
+		p.Content = strings.TrimSpace(strings.Join(content, "\n\n"))
+	}
+	if values, ok := properties["category"]; ok {
+		p.Tags = domain.NormalizeTags(micropubStrings(values))
+	}
+	if values, ok := properties["post-status"]; ok {
+		p.Draft = slices.Contains(micropubStrings(values), "draft")
+	}
+}
+
+// micropubStrings returns the plain text of property values. Embedded objects
+// are replaced with their value.
+func micropubStrings(values []any) []string {
+	result := []string{}
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			result = append(result, v)
+		case map[string]any:
+			if s, ok := v["value"].(string); ok {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+// micropubContent returns the content of a post, which JSON requests may send
+// as HTML. Markdown renders HTML as it is, once sanitized.
+func micropubContent(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if html, ok := v["html"].(string); ok {
+			return html
+		}
+		if text, ok := v["value"].(string); ok {
+			return text
+		}
+	}
+	return ""
+}
+
+// micropubPhoto returns the URL and alternative text of a photo property.
+func micropubPhoto(value any) (string, string) {
+	switch v := value.(type) {
+	case string:
+		return v, ""
+	case map[string]any:
+		src, _ := v["value"].(string)
+		alt, _ := v["alt"].(string)
+		return src, alt
+	}
+	return "", ""
+}
+
+// noteTitle makes up a title from the first line of content.
+func noteTitle(content string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	line = strings.TrimSpace(strings.TrimLeft(line, "#>*- "))
+	if utf8.RuneCountInString(line) <= maxNoteTitleLength {
+		return line
+	}
+	runes := []rune(line)
+	return strings.TrimSpace(string(runes[:maxNoteTitleLength])) + "…"
+}
+
+// micropubPost returns the post at rawURL, if it is on this site and the user
+// may see it.
+func (h *Handler) micropubPost(c echo.Context, rawURL string, userID string) (domain.Post, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || rawURL == "" {
+		return domain.Post{}, echo.NewHTTPError(http.StatusBadRequest, "missing or invalid url")
+	}
+	id, ok := strings.CutPrefix(u.Path, "/posts/")
+	if !ok {
+		return domain.Post{}, echo.NewHTTPError(http.StatusBadRequest, "the url is not a post")
+	}
+	p, err := h.Posts.GetByID(c.Request().Context(), CurrentSite(c).ID, id)
+	if err == nil && domainUserID(c) != "" && domainUserID(c) != p.Access.UserID {
+		err = domain.ErrNotFound
+	}
+	if err == nil && p.Draft && p.Access.UserID != userID {
+		allowed, err := h.can(c, domain.PermissionEditAnyPost)
+		if err != nil {
+			return domain.Post{}, err
+		}
+		if !allowed {
+			return domain.Post{}, echo.NewHTTPError(http.StatusBadRequest, "post not found")
+		}
+	}
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.Post{}, echo.NewHTTPError(http.StatusBadRequest, "post not found")
+	}
+	return p, err
+}
+
+// micropubEditablePost returns the post at rawURL, if the user of the request
+// is its author or may edit any post.
+func (h *Handler) micropubEditablePost(c echo.Context, rawURL string) (domain.Post, error) {
+	userID, err := h.micropubUserID(c, domain.ScopeWritePosts)
+	if err != nil {
+		return domain.Post{}, err
+	}
+	p, err := h.micropubPost(c, rawURL, userID)
+	if err != nil {
+		return domain.Post{}, err
+	}
+	allowed, err := h.canEditPost(c, p.ID)
+	if err != nil {
+		return domain.Post{}, err
+	}
+	if !allowed {
+		return domain.Post{}, echo.NewHTTPError(http.StatusForbidden, "only the author can change this post")
+	}
+	return p, nil
+}
+
+// micropubUpdate replaces, adds and removes the properties of a post. Only
+// tags can have values added or removed.
+func (h *Handler) micropubUpdate(c echo.Context, req micropubRequest) error {
+	p, err := h.micropubEditablePost(c, req.URL)
+	if err != nil {
+		return err
+	}
+	before := p
+	p.Tags = slices.Clone(p.Tags)
+	setMicropubProperties(&p, req.Replace)
+	if values, ok := req.Add["category"]; ok {
+		p.Tags = domain.NormalizeTags(append(p.Tags, micropubStrings(values)...))
+	}
+	switch remove := req.Delete.(type) {
+	case []any:
+		for _, name := range micropubStrings(remove) {
+			switch name {
+			case "name":
+				p.Title = ""
+			case "category":
+				p.Tags = nil
+			case "post-status":
+				p.Draft = false
+			}
+		}
+	case map[string]any:
+		if values, ok := remove["category"].([]any); ok {
+			removed := domain.NormalizeTags(micropubStrings(values))
+			p.Tags = slices.DeleteFunc(p.Tags, func(tag string) bool { return slices.Contains(removed, tag) })
+		}
+	case nil:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "delete must be a list of properties or an object")
+	}
+	if p.Content == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "content is required")
+	}
+	if p.Title == "" {
+		p.Title = noteTitle(p.Content)
+	}
+
+	err = h.Posts.Update(c.Request().Context(), p)
+	if err != nil {
+		return err
+	}
+	h.postChanged(c, before, p)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) micropubDelete(c echo.Context, rawURL string) error {
+	p, err := h.micropubEditablePost(c, rawURL)
+	if err != nil {
+		return err
+	}
+	err = h.Posts.Delete(c.Request().Context(), p.SiteID, p.ID)
+	if err != nil {
+		return err
+	}
+	h.postChanged(c, p, domain.Post{})
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetMicropub answers the queries of Micropub clients: the configuration of
+// the endpoint, and the source of a post to edit it.
+func (h *Handler) GetMicropub(c echo.Context) error {
+	userID, err := h.micropubUserID(c, domain.ScopeWritePosts, domain.ScopeReadPosts)
+	if err != nil {
+		return err
+	}
+	switch c.QueryParam("q") {
+	case "config":
+		return c.JSON(http.StatusOK, map[string]any{
+			"media-endpoint": h.siteURL(c) + "/micropub/media",
+			"syndicate-to":   []any{},
+			"q":              []string{"config", "source", "syndicate-to"},
+			"post-types": []map[string]string{
+				{"type": "note", "name": "Note"},
+				{"type": "article", "name": "Article"},
+				{"type": "photo", "name": "Photo"},
+			},
+		})
+	case "syndicate-to":
+		return c.JSON(http.StatusOK, map[string]any{"syndicate-to": []any{}})
+	case "source":
+		return h.micropubSource(c, userID)
+	case "":
+		return echo.NewHTTPError(http.StatusBadRequest, "missing q parameter")
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, "unknown query "+c.QueryParam("q"))
+}
+
+// micropubSource answers the properties of a post, or only the ones asked
+// for in the properties parameter.
+func (h *Handler) micropubSource(c echo.Context, userID string) error {
+	p, err := h.micropubPost(c, c.QueryParam("url"), userID)
+	if err != nil {
+		return err
+	}
+	status := "published"
+	if p.Draft {
+		status = "draft"
+	}
+	properties := map[string]any{
+		"name":        []string{p.Title},
+		"content":     []string{p.Content},
+		"category":    p.Tags,
+		"post-status": []string{status},
+		"published":   []string{p.CreatedAt.Format(time.RFC3339)},
+		"updated":     []string{p.UpdatedAt.Format(time.RFC3339)},
+	}
+	query := c.QueryParams()
+	wanted := append(query["properties"], query["properties[]"]...)
+	if len(wanted) == 0 {
+		return c.JSON(http.StatusOK, map[string]any{"type": []string{"h-entry"}, "properties": properties})
+	}
+	filtered := map[string]any{}
+	for _, name := range wanted {
+		if value, ok := properties[name]; ok {
+			filtered[name] = value
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]any{"properties": filtered})
+}
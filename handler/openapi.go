@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"backyard/domain"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIRoute is an endpoint of the JSON API. Routes are registered and
+// described in the OpenAPI document from the same list, so both always match.
+type APIRoute struct {
+	Method string
+	// Path is the echo path relative to /api/v1, like /posts/:id.
+	Path string
+	// OperationID names the route in the OpenAPI document, like getPost.
+	OperationID string
+	Summary     string
+	// Scope is the access token scope the route accepts, empty if tokens are
+	// not needed.
+	Scope string
+	Query []APIParam
+	// Body is a value of the type of the request body, nil for none.
+	Body any
+	// Response is a value of the type answered with Status, nil for none.
+	Response any
+	Status   int
+	Handler  echo.HandlerFunc
+}
+
+// APIParam is a query string parameter of an APIRoute.
+type APIParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// APIRoutes lists the endpoints of version 1 of the JSON API.
+func (h *Handler) APIRoutes() []APIRoute {
+	return []APIRoute{
+		{
+			Method: http.MethodGet, Path: "/posts", OperationID: "listPosts",
+			Summary: "List posts, newest first",
+			Scope:   domain.ScopeReadPosts,
+			Query: []APIParam{
+				{Name: "page", Type: "integer", Description: "Page number, starting at 1"},
+				{Name: "per_page", Type: "integer", Description: "Posts per page, up to 100"},
+				{Name: "author", Type: "string", Description: "Only list the posts of this username"},
+				{Name: "tag", Type: "string", Description: "Only list the posts with this tag"},
+			},
+			Response: APIPostPage{}, Status: http.StatusOK, Handler: h.APIGetPosts,
+		},
+		{
+			Method: http.MethodPost, Path: "/posts", OperationID: "createPost",
+			Summary: "Create a post",
+			Scope:   domain.ScopeWritePosts,
+			Body:    APIPostInput{}, Response: APIPost{}, Status: http.StatusCreated, Handler: h.APICreatePost,
+		},
+		{
+			Method: http.MethodGet, Path: "/posts/:id", OperationID: "getPost",
+			Summary:  "Get a post",
+			Scope:    domain.ScopeReadPosts,
+			Response: APIPost{}, Status: http.StatusOK, Handler: h.APIGetPost,
+		},
+		{
+			Method: http.MethodPut, Path: "/posts/:id", OperationID: "updatePost",
+			Summary: "Replace a post",
+			Scope:   domain.ScopeWritePosts,
+			Body:    APIPostInput{}, Response: APIPost{}, Status: http.StatusOK, Handler: h.APIUpdatePost,
+		},
+		{
+			Method: http.MethodDelete, Path: "/posts/:id", OperationID: "deletePost",
+			Summary: "Delete a post",
+			Scope:   domain.ScopeWritePosts,
+			Status:  http.StatusNoContent, Handler: h.APIDeletePost,
+		},
+		{
+			Method: http.MethodGet, Path: "/users", OperationID: "listUsers",
+			Summary:  "List users",
+			Response: APIUserList{}, Status: http.StatusOK, Handler: h.APIGetUsers,
+		},
+		{
+			Method: http.MethodGet, Path: "/users/:username", OperationID: "getUser",
+			Summary:  "Get a user",
+			Response: APIUser{}, Status: http.StatusOK, Handler: h.APIGetUser,
+		},
+		{
+			Method: http.MethodGet, Path: "/tags", OperationID: "listTags",
+			Summary:  "List the tags of published posts",
+			Response: APITagList{}, Status: http.StatusOK, Handler: h.APIGetTags,
+		},
+		{
+			Method: http.MethodGet, Path: "/instance", OperationID: "getInstance",
+			Summary:  "Describe the site",
+			Response: APIInstance{}, Status: http.StatusOK, Handler: h.APIGetInstance,
+		},
+	}
+}
+
+// GetOpenAPI serves the OpenAPI 3 description of the JSON API.
+func (h *Handler) GetOpenAPI(c echo.Context) error {
+	return c.JSON(http.StatusOK, openAPIDocument(h.APIRoutes(), h.siteURL(c)+"/api/v1"))
+}
+
+var pathParamRegexp = regexp.MustCompile(`:([a-zA-Z_]+)`)
+
+// openAPIDocument describes routes served under serverURL. The schemas are
+// generated from the Go types of the bodies.
+func openAPIDocument(routes []APIRoute, serverURL string) map[string]any {
+	schemas := map[string]any{}
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content":     jsonContent(schemaOf(reflect.TypeOf(APIError{}), schemas)),
+	}
+
+	paths := map[string]map[string]any{}
+	for _, route := range routes {
+		path := pathParamRegexp.ReplaceAllString(route.Path, "{$1}")
+		parameters := []any{}
+		for _, match := range pathParamRegexp.FindAllStringSubmatch(route.Path, -1) {
+			parameters = append(parameters, map[string]any{
+				"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, param := range route.Query {
+			parameters = append(parameters, map[string]any{
+				"name": param.Name, "in": "query", "description": param.Description, "schema": map[string]any{"type": param.Type},
+			})
+		}
+
+		response := map[string]any{"description": http.StatusText(route.Status)}
+		if route.Response != nil {
+			response["content"] = jsonContent(schemaOf(reflect.TypeOf(route.Response), schemas))
+		}
+		operation := map[string]any{
+			"summary":     route.Summary,
+			"operationId": route.OperationID,
+			"parameters":  parameters,
+			"responses": map[string]any{
+				strconv.Itoa(route.Status): response,
+				"default":                  errorResponse,
+			},
+		}
+		if route.Body != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(schemaOf(reflect.TypeOf(route.Body), schemas)),
+			}
+		}
+		if route.Scope != "" {
+			operation["description"] = "Access tokens need the " + route.Scope + " scope."
+			security := []any{
+				map[string]any{"bearerAuth": []string{}},
+				map[string]any{"cookieAuth": []string{}},
+			}
+			// Reading works without credentials too, for published posts
+			if route.Method == http.MethodGet {
+				security = append(security, map[string]any{})
+			}
+			operation["security"] = security
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Backyard API",
+			"version": "1",
+		},
+		"servers": []any{map[string]any{"url": serverURL}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Personal access token created in /settings/tokens",
+				},
+				"cookieAuth": map[string]any{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": "Authorization",
+				},
+			},
+		},
+	}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// schemaOf returns the JSON schema of values of type t. Structs are added to
+// schemas, named after their type without the API prefix, and referenced.
+func schemaOf(t reflect.Type, schemas map[string]any) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaOf(t.Elem(), schemas)
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "API")
+		if _, ok := schemas[name]; !ok {
+			// Reserve the name first, in case the type refers to itself
+			schemas[name] = nil
+			properties := map[string]any{}
+			required := []string{}
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				tag, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if tag == "-" || !field.IsExported() {
+					continue
+				}
+				if tag == "" {
+					tag = field.Name
+				}
+				schema := schemaOf(field.Type, schemas)
+				if doc := field.Tag.Get("doc"); doc != "" {
+					schema["description"] = doc
+				}
+				properties[tag] = schema
+				if !strings.Contains(options, "omitempty") {
+					required = append(required, tag)
+				}
+			}
+			schemas[name] = map[string]any{"type": "object", "properties": properties, "required": required}
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
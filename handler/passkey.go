@@ -0,0 +1,423 @@
+package handler
+
+import (
+	"backyard/domain"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// passkeyCeremonyDuration is how long the browser has to answer a
+	// registration or login challenge.
+	passkeyCeremonyDuration = 5 * time.Minute
+	maxPasskeyNameLength    = 64
+)
+
+// webAuthnUser adapts a user and their passkeys to the webauthn package. The
+// user handle stored in the authenticators is the user ID.
+type webAuthnUser struct {
+	user     domain.User
+	passkeys []domain.Passkey
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := []webauthn.Credential{}
+	for _, p := range u.passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(p.ID)
+		if err != nil {
+			continue
+		}
+		transports := []protocol.AuthenticatorTransport{}
+		for _, t := range p.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: p.BackupEligible,
+				BackupState:    p.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    p.AAGUID,
+				SignCount: p.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+func (u webAuthnUser) descriptors() []protocol.CredentialDescriptor {
+	descriptors := []protocol.CredentialDescriptor{}
+	for _, credential := range u.WebAuthnCredentials() {
+		descriptors = append(descriptors, credential.Descriptor())
+	}
+	return descriptors
+}
+
+// loadWebAuthnUser returns the user with their passkeys.
+func (h *Handler) loadWebAuthnUser(c echo.Context, userID string) (webAuthnUser, error) {
+	user, err := h.Users.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		return webAuthnUser{}, err
+	}
+	passkeys, err := h.Passkeys.ListByUser(c.Request().Context(), userID)
+	if err != nil {
+		return webAuthnUser{}, err
+	}
+	return webAuthnUser{user: user, passkeys: passkeys}, nil
+}
+
+// relyingParty returns the WebAuthn relying party of the host the request
+// was made to, so passkeys work on every site and custom domain. Passkeys are
+// bound to the hostname they were registered on.
+func (h *Handler) relyingParty(c echo.Context) (*webauthn.WebAuthn, error) {
+	host := c.Request().Host
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = host
+	}
+	config, err := h.Configs.GetActive(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return nil, err
+	}
+	requireResidentKey := true
+	return webauthn.New(&webauthn.Config{
+		RPID:          hostname,
+		RPDisplayName: config.Title,
+		RPOrigins:     []string{c.Scheme() + "://" + host},
+		// Passkeys must be discoverable, so users can log in without typing
+		// their username, and must verify the user, so they replace both the
+		// password and the second factor
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			RequireResidentKey: &requireResidentKey,
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		},
+	})
+}
+
+// startPasskeyCeremony keeps the challenge sent to the browser in a short
+// lived cookie until the browser answers it.
+func (h *Handler) startPasskeyCeremony(c echo.Context, purpose string, userID string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["userID"] = userID
+	claims["siteID"] = CurrentSite(c).ID
+	claims["purpose"] = purpose
+	claims["ceremony"] = string(data)
+	expires := time.Now().Add(passkeyCeremonyDuration)
+	claims["expiration"] = expires.Unix()
+	signedData, err := token.SignedString([]byte(h.JWTSecret))
+	if err != nil {
+		return err
+	}
+	c.SetCookie(h.newCookie("WebAuthn", signedData, expires))
+	return nil
+}
+
+// answeredChallenges remembers the passkey challenges already answered until
+// they expire. Clearing the cookie holding a challenge does not keep it from
+// being sent again. Like LoginThrottle, it is kept by each process.
+type answeredChallenges struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+// answer reports if the challenge was not answered before, and remembers it
+// was until it expires.
+func (a *answeredChallenges) answer(challenge string, expires time.Time, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.expires == nil {
+		a.expires = map[string]time.Time{}
+	}
+	for key, e := range a.expires {
+		if now.After(e) {
+			delete(a.expires, key)
+		}
+	}
+	if _, ok := a.expires[challenge]; ok {
+		return false
+	}
+	a.expires[challenge] = expires
+	return true
+}
+
+// finishPasskeyCeremony returns the challenge of the ceremony started for
+// purpose and userID, and clears it, so every challenge is only answered once.
+func (h *Handler) finishPasskeyCeremony(c echo.Context, purpose string, userID string) (webauthn.SessionData, bool) {
+	cookie, err := c.Cookie("WebAuthn")
+	if err != nil {
+		return webauthn.SessionData{}, false
+	}
+	c.SetCookie(h.newCookie("WebAuthn", "", time.Now().Add(-1*time.Second)))
+	claims, ok := h.parseToken(cookie.Value)
+	if !ok || claims["purpose"] != purpose || claims["siteID"] != CurrentSite(c).ID || claims["userID"] != userID {
+		return webauthn.SessionData{}, false
+	}
+	data, ok := claims["ceremony"].(string)
+	if !ok {
+		return webauthn.SessionData{}, false
+	}
+	session := webauthn.SessionData{}
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return webauthn.SessionData{}, false
+	}
+	// parseToken checked the expiration is a number
+	expires := time.Unix(int64(claims["expiration"].(float64)), 0)
+	if !h.passkeyChallenges.answer(session.Challenge, expires, time.Now()) {
+		return webauthn.SessionData{}, false
+	}
+	return session, true
+}
+
+// passkeyError answers a failed passkey request of the browser script with
+// the translated message to show.
+func passkeyError(c echo.Context, status int, key string) error {
+	return c.JSON(status, map[string]string{"error": T(c, key)})
+}
+
+type PasskeyDTO struct {
+	ID         string
+	Name       string
+	Synced     bool
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// GetPasskeys lists the passkeys of the user, with the button to add one.
+func (h *Handler) GetPasskeys(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	passkeys, err := h.Passkeys.ListByUser(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+	dtos := []PasskeyDTO{}
+	for _, p := range passkeys {
+		dtos = append(dtos, PasskeyDTO{
+			ID:         p.ID,
+			Name:       p.Name,
+			Synced:     p.BackupState,
+			CreatedAt:  p.CreatedAt,
+			LastUsedAt: p.LastUsedAt,
+		})
+	}
+	return c.Render(http.StatusOK, "user-passkeys.html", struct {
+		Passkeys []PasskeyDTO
+	}{
+		Passkeys: dtos,
+	})
+}
+
+// BeginPasskeyRegistration sends the browser the options to create a passkey
+// for the user.
+func (h *Handler) BeginPasskeyRegistration(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return passkeyError(c, http.StatusUnauthorized, "error.unauthorized")
+	}
+	rp, err := h.relyingParty(c)
+	if err != nil {
+		return err
+	}
+	user, err := h.loadWebAuthnUser(c, userID)
+	if err != nil {
+		return err
+	}
+	// Authenticators that already hold a passkey of the user refuse to
+	// create another one
+	options, session, err := rp.BeginRegistration(user, webauthn.WithExclusions(user.descriptors()))
+	if err != nil {
+		return err
+	}
+	if err := h.startPasskeyCeremony(c, "passkey_register", userID, session); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, options)
+}
+
+// FinishPasskeyRegistration verifies the passkey created by the browser and
+// stores it with the name in the query string.
+func (h *Handler) FinishPasskeyRegistration(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return passkeyError(c, http.StatusUnauthorized, "error.unauthorized")
+	}
+	session, ok := h.finishPasskeyCeremony(c, "passkey_register", userID)
+	if !ok {
+		return passkeyError(c, http.StatusBadRequest, "passkeys.error.expired")
+	}
+	name := strings.TrimSpace(c.QueryParam("name"))
+	if name == "" {
+		name = T(c, "passkeys.default_name")
+	}
+	if utf8.RuneCountInString(name) > maxPasskeyNameLength {
+		return passkeyError(c, http.StatusBadRequest, "passkeys.error.name")
+	}
+	rp, err := h.relyingParty(c)
+	if err != nil {
+		return err
+	}
+	user, err := h.loadWebAuthnUser(c, userID)
+	if err != nil {
+		return err
+	}
+	credential, err := rp.FinishRegistration(user, session, c.Request())
+	if err != nil {
+		slog.InfoContext(c.Request().Context(), err.Error(), RequestAttrs(c)...)
+		return passkeyError(c, http.StatusBadRequest, "passkeys.error.invalid")
+	}
+
+	transports := []string{}
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	err = h.Passkeys.Create(c.Request().Context(), domain.Passkey{
+		ID:              base64.RawURLEncoding.EncodeToString(credential.ID),
+		SiteID:          user.user.SiteID,
+		UserID:          userID,
+		Name:            name,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"redirect": "/settings/passkeys"})
+}
+
+// DeletePasskey removes a passkey of the user, which can no longer be used
+// to log in.
+func (h *Handler) DeletePasskey(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	err := h.Passkeys.Delete(c.Request().Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/settings/passkeys")
+}
+
+// BeginPasskeyLogin sends the browser a challenge that any passkey of the
+// site can answer, so the user does not have to enter their username.
+func (h *Handler) BeginPasskeyLogin(c echo.Context) error {
+	rp, err := h.relyingParty(c)
+	if err != nil {
+		return err
+	}
+	options, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return err
+	}
+	if err := h.startPasskeyCeremony(c, "passkey_login", "", session); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, options)
+}
+
+// FinishPasskeyLogin verifies the challenge signed by a passkey and logs its
+// user in, with the same session cookie as a password login. The passkey
+// verified the user, so there is no second factor step, and passkeys cannot
+// be guessed, so a username locked out by wrong passwords can still use them.
+func (h *Handler) FinishPasskeyLogin(c echo.Context) error {
+	if !h.LoginThrottle.Allow(c.RealIP(), time.Now()) {
+		return passkeyError(c, http.StatusTooManyRequests, "error.too_many_attempts")
+	}
+	session, ok := h.finishPasskeyCeremony(c, "passkey_login", "")
+	if !ok {
+		return passkeyError(c, http.StatusBadRequest, "passkeys.error.expired")
+	}
+	rp, err := h.relyingParty(c)
+	if err != nil {
+		return err
+	}
+
+	var user webAuthnUser
+	var passkey domain.Passkey
+	findUser := func(rawID []byte, userHandle []byte) (webauthn.User, error) {
+		passkey, err = h.Passkeys.GetByID(c.Request().Context(), CurrentSite(c).ID, base64.RawURLEncoding.EncodeToString(rawID))
+		if err != nil {
+			return nil, err
+		}
+		if passkey.UserID != string(userHandle) {
+			return nil, domain.ErrNotFound
+		}
+		user, err = h.loadWebAuthnUser(c, passkey.UserID)
+		return user, err
+	}
+	credential, err := rp.FinishDiscoverableLogin(findUser, session, c.Request())
+	if err == nil && credential.Authenticator.CloneWarning {
+		err = errors.New("passkey signature counter went backwards")
+	}
+	if err != nil {
+		slog.InfoContext(c.Request().Context(), err.Error(), RequestAttrs(c)...)
+		h.LoginThrottle.Fail(c.RealIP(), time.Now())
+		return passkeyError(c, http.StatusBadRequest, "passkeys.error.invalid")
+	}
+
+	err = h.Passkeys.Use(c.Request().Context(), passkey.ID, credential.Authenticator.SignCount, credential.Flags.BackupState, time.Now())
+	if err != nil {
+		return err
+	}
+	err = h.finishLogin(c, user.user)
+	if errors.Is(err, errAccountSuspended) {
+		return passkeyError(c, http.StatusForbidden, "error.suspended")
+	}
+	if errors.Is(err, errPasswordResetRequired) {
+		return passkeyError(c, http.StatusForbidden, "error.password_reset_required")
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"redirect": "/"})
+}
@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"backyard/domain"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/labstack/echo/v4"
+)
+
+// testOrigin is the origin of the requests made by newTestContext.
+const testOrigin = "http://example.com"
+
+// softAuthenticator is a passkey authenticator holding a single ES256 key, as
+// a browser would use it.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, credentialID: id}
+}
+
+// passkeyOptions holds the parts of the options of a ceremony the
+// authenticator needs.
+type passkeyOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		RPID string `json:"rpId"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+func parsePasskeyOptions(t *testing.T, body []byte) passkeyOptions {
+	t.Helper()
+	options := passkeyOptions{}
+	if err := json.Unmarshal(body, &options); err != nil {
+		t.Fatalf("passkey options %s: %v", body, err)
+	}
+	return options
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, typ string, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// authData returns the authenticator data for the relying party, with the
+// user present and verified.
+func (a *softAuthenticator) authData(rpID string, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags|0x01|0x04)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// create answers the options of a registration, returning the body the
+// browser sends.
+func (a *softAuthenticator) create(t *testing.T, body []byte) []byte {
+	t.Helper()
+	options := parsePasskeyOptions(t, body)
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.PublicKey.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle = userHandle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Attested credential data: AAGUID, credential ID length and ID, key
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+	attestation, err := webauthncbor.Marshal(struct {
+		Format    string         `cbor:"fmt"`
+		Statement map[string]any `cbor:"attStmt"`
+		AuthData  []byte         `cbor:"authData"`
+	}{
+		Format:    "none",
+		Statement: map[string]any{},
+		AuthData:  a.authData(options.PublicKey.RP.ID, 0x40, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    encode(a.clientData(t, "webauthn.create", options.PublicKey.Challenge)),
+		"attestationObject": encode(attestation),
+	})
+}
+
+// get answers the options of a login, signing its challenge, and returns the
+// body the browser sends.
+func (a *softAuthenticator) get(t *testing.T, body []byte) []byte {
+	t.Helper()
+	options := parsePasskeyOptions(t, body)
+	clientData := a.clientData(t, "webauthn.get", options.PublicKey.Challenge)
+	authData := a.authData(options.PublicKey.RPID, 0, nil)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) []byte {
+	t.Helper()
+	body, err := json.Marshal(map[string]any{
+		"id":       encode(a.credentialID),
+		"rawId":    encode(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// passkeyRequest calls handler with the JSON body and cookies.
+func passkeyRequest(t *testing.T, handler echo.HandlerFunc, target string, body []byte, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	c, rec := newTestContext(http.MethodPost, target, nil, cookies...)
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+	c.Request().Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if err := handler(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// registerPasskey registers a passkey of the authenticator for the user.
+func registerPasskey(t *testing.T, h *Handler, user domain.User, a *softAuthenticator) {
+	t.Helper()
+	session := sessionCookie(t, h, user)
+	rec := passkeyRequest(t, h.BeginPasskeyRegistration, "/settings/passkeys/begin", nil, session)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("beginning registration: status %d, %s", rec.Code, rec.Body)
+	}
+	ceremony := responseCookie(rec, "WebAuthn")
+	rec = passkeyRequest(t, h.FinishPasskeyRegistration, "/settings/passkeys/finish?name=Laptop", a.create(t, rec.Body.Bytes()), session, ceremony)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("finishing registration: status %d, %s", rec.Code, rec.Body)
+	}
+}
+
+// beginPasskeyLogin returns the options of a login ceremony and the cookie
+// holding its challenge.
+func beginPasskeyLogin(t *testing.T, h *Handler) ([]byte, *http.Cookie) {
+	t.Helper()
+	rec := passkeyRequest(t, h.BeginPasskeyLogin, "/login/passkey/begin", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("beginning login: status %d, %s", rec.Code, rec.Body)
+	}
+	return rec.Body.Bytes(), responseCookie(rec, "WebAuthn")
+}
+
+func finishPasskeyLogin(t *testing.T, h *Handler, body []byte, ceremony *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	return passkeyRequest(t, h.FinishPasskeyLogin, "/login/passkey/finish", body, ceremony)
+}
+
+func TestPasskeyRegistrationAndDiscoverableLogin(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, h, user, a)
+
+	passkeys, err := h.Passkeys.ListByUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 || passkeys[0].Name != "Laptop" || passkeys[0].ID != encode(a.credentialID) {
+		t.Fatalf("passkeys after registering = %+v", passkeys)
+	}
+
+	// Login does not ask for the username, the passkey tells the user
+	options, ceremony := beginPasskeyLogin(t, h)
+	a.signCount = 1
+	rec := finishPasskeyLogin(t, h, a.get(t, options), ceremony)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d, %s", rec.Code, rec.Body)
+	}
+	cookie := responseCookie(rec, "Authorization")
+	if cookie == nil {
+		t.Fatal("logged in without an Authorization cookie")
+	}
+	c, _ := newTestContext(http.MethodGet, "/", nil, cookie)
+	if userID := h.getUserID(c); userID != user.ID {
+		t.Errorf("logged in as %q, want %q", userID, user.ID)
+	}
+	passkey, err := h.Passkeys.GetByID(context.Background(), domain.DefaultSiteID, encode(a.credentialID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passkey.SignCount != 1 || passkey.LastUsedAt == nil {
+		t.Errorf("passkey after login: sign count %d, last used %v", passkey.SignCount, passkey.LastUsedAt)
+	}
+}
+
+func TestPasskeyLoginRejectsClonedAuthenticator(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, h, user, a)
+
+	a.signCount = 5
+	options, ceremony := beginPasskeyLogin(t, h)
+	if rec := finishPasskeyLogin(t, h, a.get(t, options), ceremony); rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d, %s", rec.Code, rec.Body)
+	}
+
+	// A copy of the key signs with a counter behind the one last seen
+	a.signCount = 3
+	options, ceremony = beginPasskeyLogin(t, h)
+	rec := finishPasskeyLogin(t, h, a.get(t, options), ceremony)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("login with a counter gone backwards: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if responseCookie(rec, "Authorization") != nil {
+		t.Error("logged in with a counter gone backwards")
+	}
+}
+
+func TestPasskeyChallengeIsSingleUse(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, h, user, a)
+
+	// Many authenticators always sign with a zero counter, so only the
+	// challenge keeps an assertion from being replayed
+	options, ceremony := beginPasskeyLogin(t, h)
+	body := a.get(t, options)
+	rec := finishPasskeyLogin(t, h, body, ceremony)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d, %s", rec.Code, rec.Body)
+	}
+	if cleared := responseCookie(rec, "WebAuthn"); cleared == nil || cleared.Value != "" {
+		t.Errorf("the challenge cookie was not cleared: %v", cleared)
+	}
+	rec = finishPasskeyLogin(t, h, body, ceremony)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("replayed challenge: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if responseCookie(rec, "Authorization") != nil {
+		t.Error("logged in with a replayed challenge")
+	}
+
+	// Without the cookie there is no challenge to answer
+	options, _ = beginPasskeyLogin(t, h)
+	if rec := passkeyRequest(t, h.FinishPasskeyLogin, "/login/passkey/finish", a.get(t, options)); rec.Code != http.StatusBadRequest {
+		t.Errorf("login without the challenge cookie: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPasskeyRegistrationChallengeIsBoundToTheUser(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "password")
+	mallory := createTestUser(t, h, "mallory", "password")
+	a := newSoftAuthenticator(t)
+
+	rec := passkeyRequest(t, h.BeginPasskeyRegistration, "/settings/passkeys/begin", nil, sessionCookie(t, h, mallory))
+	ceremony := responseCookie(rec, "WebAuthn")
+	rec = passkeyRequest(t, h.FinishPasskeyRegistration, "/settings/passkeys/finish", a.create(t, rec.Body.Bytes()), sessionCookie(t, h, alice), ceremony)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("finishing the registration of another user: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	passkeys, err := h.Passkeys.ListByUser(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 0 {
+		t.Errorf("passkeys of alice = %+v, want none", passkeys)
+	}
+}
+
+func TestPasskeyLoginNeedsPasswordReset(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, h, user, a)
+	if err := h.Users.SetPasswordResetRequired(context.Background(), user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	options, ceremony := beginPasskeyLogin(t, h)
+	a.signCount = 1
+	rec := finishPasskeyLogin(t, h, a.get(t, options), ceremony)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("login: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if responseCookie(rec, "Authorization") != nil {
+		t.Error("logged in before choosing a new password")
+	}
+}
@@ -2,15 +2,14 @@ package handler
 
 import (
 	"backyard/domain"
-	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
 	"regexp"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
@@ -31,52 +30,46 @@ func (h *Handler) NewPost(c echo.Context) error {
 	title := c.FormValue("title")
 	content := c.FormValue("content")
 	draft := c.FormValue("draft") == "on"
+	tags := parseTags(c.FormValue("tags"))
 
 	if id != "" && title != "" && content != "" {
-		userID := getUserID(c, h.JWTSecret)
+		userID := h.getUserID(c)
 		if userID == "" {
 			return fmt.Errorf("couldn't get UserID in JWT token")
 		}
-		tx, err := h.DB.BeginTx(context.TODO(), nil)
-		if err != nil {
-			return fmt.Errorf("error in begin transaction: %v", err)
-		}
-		stmt, err := h.DB.Prepare("insert into posts (post_id, title, content, draft, created_at, updated_at) values (?,?,?,?,?,?)")
-		if err != nil {
-			return fmt.Errorf("error preparing statement in table posts: %v", err)
-		}
-		_, err = stmt.Exec(id, title, content, draft, time.Now().UTC(), time.Now().UTC())
-		if err != nil {
-			return fmt.Errorf("error executing statement in table posts: %v", err)
-		}
-
-		stmt, err = h.DB.Prepare("insert into users_posts (user_id, post_id, relation_type, created_at, updated_at) values (?, ?, ?, ?, ?)")
-		if err != nil {
-			return fmt.Errorf("error preparing statement in table users_posts: %v", err)
-		}
-
-		_, err = stmt.Exec(userID, id, "AUTHOR", time.Now().UTC(), time.Now().UTC())
-		if err != nil {
-			return fmt.Errorf("error executing statement in table users_posts: %v", err)
+		post := domain.Post{
+			ID:      id,
+			Title:   title,
+			Content: content,
+			SiteID:  CurrentSite(c).ID,
+			Draft:   draft,
+			Tags:    tags,
+			Access:  domain.Access{UserID: userID},
 		}
-
-		err = tx.Commit()
+		err := h.Posts.Create(c.Request().Context(), post)
 		if err != nil {
-			return fmt.Errorf("error in commit transaction: %v", err)
+			return err
 		}
+		h.postChanged(c, domain.Post{}, post)
 	}
 
 	return c.Redirect(http.StatusFound, "/")
 }
 
+// parseTags returns the tags of a comma separated list.
+func parseTags(value string) []string {
+	return domain.NormalizeTags(strings.Split(value, ","))
+}
+
 type PostDTO struct {
 	ID      string
 	Title   string
 	Content template.HTML
 	Author  string
 	Draft   bool
+	Tags    []string
 	AccessDTO
-	CreatedAt string
+	CreatedAt time.Time
 }
 
 type AccessDTO struct {
@@ -84,211 +77,148 @@ type AccessDTO struct {
 	Relation string
 }
 
-// TODO remove in favor of getUserID
-func isLoggedIn(c echo.Context, JWTSecret string) bool {
-	if JWTSecret == "" {
-		return false
-	}
-
-	cookie, err := c.Cookie("Authorization")
-	if err == nil {
-		token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
-			// SigningMethodHMAC implements the HMAC-SHA family of signing methods.
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			return []byte(JWTSecret), nil
-		})
-		if err != nil {
-			return false
-		}
-		if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			return true
-		}
+func newPostDTO(p domain.Post) PostDTO {
+	return PostDTO{
+		ID:        p.ID,
+		Title:     sanitizerStrict.Sanitize(p.Title),
+		Content:   safeMd(p.Content),
+		Draft:     p.Draft,
+		Tags:      p.Tags,
+		Author:    p.Author(),
+		CreatedAt: p.CreatedAt,
+		AccessDTO: AccessDTO{
+			UserID:   p.Access.UserID,
+			Relation: p.Access.Relation,
+		},
 	}
-	return false
 }
 
-func getUserID(c echo.Context, JWTSecret string) string {
-	if JWTSecret == "" {
-		return ""
-	}
-
-	cookie, err := c.Cookie("Authorization")
-	if err == nil {
-		token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
-			// SigningMethodHMAC implements the HMAC-SHA family of signing methods.
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			return []byte(JWTSecret), nil
-		})
+func (h *Handler) GetPosts(c echo.Context) error {
+	// The home page of a custom domain is the profile of its user
+	if ownerID := domainUserID(c); ownerID != "" {
+		owner, err := h.Users.GetByID(c.Request().Context(), ownerID)
 		if err != nil {
-			return ""
-		}
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			expiration, ok := claims["expiration"].(float64)
-			// check if the token has expired
-			if !ok || time.Now().Compare(time.Unix((int64(expiration)), 0)) > 0 {
-				return ""
-			}
-
-			userID, ok := claims["userID"].(string)
-			if ok {
-				return userID
-			}
+			return err
 		}
+		return h.renderProfile(c, owner)
 	}
-	return ""
-}
 
-func (h *Handler) GetPosts(c echo.Context) error {
-	userID := getUserID(c, h.JWTSecret)
-	// The only relation supported for now is author, and only one user can be related to the post
-	skipDrafts := ""
-	if userID == "" {
-		skipDrafts = ` where draft = false `
+	// Drafts are listed to their authors and to users who may edit any post
+	editAny, err := h.can(c, domain.PermissionEditAnyPost)
+	if err != nil {
+		return err
 	}
-	rows, err := h.DB.Query(`select posts.post_id, posts.title, posts.content, posts.draft, posts.created_at, posts.updated_at, users_posts.user_id, users_posts.relation_type, users.username from posts
-        left join users_posts on posts.post_id = users_posts.post_id
-        left join users on users_posts.user_id = users.user_id ` + skipDrafts + ` order by posts.updated_at desc`)
+	dbPosts, err := h.Posts.Search(c.Request().Context(), domain.PostFilter{
+		SiteID:    CurrentSite(c).ID,
+		AllDrafts: editAny,
+		DraftsOf:  h.getUserID(c),
+	})
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 
 	posts := []PostDTO{}
-	for rows.Next() {
-		p := domain.Post{}
-		username := ""
-		p.Access = domain.Access{}
-
-		rows.Scan(&p.ID, &p.Title, &p.Content, &p.Draft, &p.CreatedAt, &p.UpdatedAt, &p.Access.UserID, &p.Access.Relation, &username)
-		author := ""
-		if p.Access.Relation == "AUTHOR" {
-			author = username
-		}
-
-		posts = append(posts, PostDTO{
-			ID:        p.ID,
-			Title:     sanitizerStrict.Sanitize(p.Title),
-			Content:   safeMd(p.Content),
-			Draft:     p.Draft,
-			Author:    author,
-			CreatedAt: p.CreatedAt.Format(time.DateOnly),
-			AccessDTO: AccessDTO{
-				UserID:   p.Access.UserID,
-				Relation: p.Access.Relation,
-			},
-		})
+	for _, p := range dbPosts {
+		posts = append(posts, newPostDTO(p))
 	}
 
-	row := h.DB.QueryRow("select config_id, active, backyard_version, title_home, desc_home, image_home, favicon_home, footer_html, admin_user_id, created_at, updated_at from config where active is true order by updated_at desc limit 1")
-
-	config := domain.Config{}
-	err = row.Scan(&config.ID, &config.Active, &config.BackyardVersion, &config.Title, &config.Description, &config.ImageHome, &config.Favicon, &config.Footer, &config.AdminUserID, &config.CreatedAt, &config.UpdatedAt)
+	config, err := h.Configs.GetActive(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	canPost, err := h.can(c, domain.PermissionCreatePosts)
+	if err != nil {
+		return err
+	}
+	canInvite, err := h.canInvite(c, config)
 	if err != nil {
 		return err
 	}
 
 	return c.Render(http.StatusOK, "index.html", struct {
 		TitleHome  string
-		FooterHome string
+		ImageHome  string
+		FooterHome template.HTML
 		Posts      []PostDTO
 		UUID       string
 		LoggedIn   bool
+		Username   string
+		CanPost    bool
+		SSO        bool
+		Invites    bool
 	}{
 		TitleHome:  config.Title,
-		FooterHome: config.Footer,
+		ImageHome:  config.ImageHome,
+		FooterHome: template.HTML(sanitizerFooter.Sanitize(config.Footer)),
 		Posts:      posts,
 		UUID:       uuid.NewString(),
-		LoggedIn:   isLoggedIn(c, h.JWTSecret),
+		LoggedIn:   h.isLoggedIn(c),
+		Username:   h.currentUsername(c),
+		CanPost:    canPost,
+		SSO:        h.SSO != nil,
+		Invites:    canInvite && h.signupMode(c, config) == domain.SignupInvite,
 	})
 }
 
-func (h *Handler) GetByID(c echo.Context) error {
+// getPost validates the id and fetches the post, returning errors the way the
+// handlers report them. Drafts are only found by those who may edit them.
+func (h *Handler) getPost(c echo.Context, rawID string) (domain.Post, error) {
 	idRegexp := regexp.MustCompilePOSIX("^[a-zA-Z0-9-]+$?")
-	id := idRegexp.FindString((c.Param("id")))
+	id := idRegexp.FindString(rawID)
 	if len(id) < 36 {
-		return fmt.Errorf("invalid id")
+		return domain.Post{}, fmt.Errorf("invalid id")
 	}
-
-	// The only relation supported for now is author, and only one user can be related to the post
-	row := h.DB.QueryRow(`SELECT posts.post_id, posts.title, posts.content, posts.draft, posts.created_at, posts.updated_at, users_posts.user_id, users_posts.relation_type, users.username FROM posts
-        LEFT JOIN users_posts ON posts.post_id = users_posts.post_id
-        LEFT JOIN users ON users_posts.user_id = users.user_id
-        WHERE posts.post_id = $1`, id)
-	if row.Err() != nil {
-		return row.Err()
+	p, err := h.Posts.GetByID(c.Request().Context(), CurrentSite(c).ID, id)
+	// Custom domains only serve the posts of their user
+	if err == nil && domainUserID(c) != "" && domainUserID(c) != p.Access.UserID {
+		err = domain.ErrNotFound
 	}
-	p := domain.Post{}
-	username := ""
-	p.Access = domain.Access{}
-	err := row.Scan(&p.ID, &p.Title, &p.Content, &p.Draft, &p.CreatedAt, &p.UpdatedAt, &p.Access.UserID, &p.Access.Relation, &username)
-	// Currently it just returns "Error not found"
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("post not found")
+	if err == nil && p.Draft {
+		allowed, err := h.canEditPost(c, p.ID)
+		if err != nil {
+			return domain.Post{}, err
 		}
-		return err
+		if !allowed {
+			return domain.Post{}, echo.ErrNotFound
+		}
+	}
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.Post{}, echo.ErrNotFound
+	}
+	if err != nil {
+		return domain.Post{}, err
 	}
-	author := ""
-	if p.Access.Relation == "AUTHOR" {
-		author = username
+	return p, nil
+}
+
+func (h *Handler) GetByID(c echo.Context) error {
+	p, err := h.getPost(c, c.Param("id"))
+	if err != nil {
+		return err
 	}
 	return c.Render(http.StatusOK, "post-view.html", struct {
 		PostDTO
-		LoggedIn bool
+		LoggedIn  bool
+		Canonical string
 	}{
-		PostDTO{
-			ID:        p.ID,
-			Title:     sanitizerStrict.Sanitize(p.Title),
-			Content:   safeMd(p.Content),
-			Draft:     p.Draft,
-			Author:    author,
-			CreatedAt: p.CreatedAt.Format(time.DateOnly),
-		},
-		isLoggedIn(c, h.JWTSecret),
+		newPostDTO(p),
+		h.isLoggedIn(c),
+		h.canonicalURL(c, p.Access.UserID, "/posts/"+p.ID),
 	})
 }
 
 func (h *Handler) GetEditPostForm(c echo.Context) error {
-	idRegexp := regexp.MustCompilePOSIX("^[a-zA-Z0-9-]+$?")
-	id := idRegexp.FindString((c.Param("id")))
-	if len(id) < 36 {
-		return fmt.Errorf("invalid id")
-	}
-	// The only relation supported for now is author, and only one user can be related to the post
-	row := h.DB.QueryRow(`SELECT posts.post_id, posts.title, posts.content, posts.draft, posts.created_at, posts.updated_at, users_posts.user_id, users_posts.relation_type, users.username FROM posts
-        LEFT JOIN users_posts ON posts.post_id = users_posts.post_id
-        LEFT JOIN users ON users_posts.user_id = users.user_id
-        WHERE posts.post_id = $1`, id)
-	if row.Err() != nil {
-		return row.Err()
-	}
-	p := domain.Post{}
-	username := ""
-	p.Access = domain.Access{}
-	err := row.Scan(&p.ID, &p.Title, &p.Content, &p.Draft, &p.CreatedAt, &p.UpdatedAt, &p.Access.UserID, &p.Access.Relation, &username)
-	// Currently it just returns "Error not found"
+	p, err := h.getPost(c, c.Param("id"))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("post not found")
-		}
 		return err
 	}
-	author := ""
-	if p.Access.Relation == "AUTHOR" {
-		author = username
-	}
 	return c.Render(http.StatusOK, "post-edit.html", PostDTO{
 		ID:      p.ID,
 		Title:   p.Title,
 		Content: template.HTML(p.Content),
 		Draft:   p.Draft,
-		Author:  author,
+		Tags:    p.Tags,
+		Author:  p.Author(),
 	})
 }
 
@@ -301,37 +231,56 @@ func (h *Handler) EditPost(c echo.Context) error {
 	title := c.FormValue("title")
 	content := c.FormValue("content")
 	draft := c.FormValue("draft") == "on"
+	tags := parseTags(c.FormValue("tags"))
 
-	// Check the logged user is the author of the post
-	userID := getUserID(c, h.JWTSecret)
-	if userID == "" {
+	if h.getUserID(c) == "" {
 		return fmt.Errorf("couldn't get UserID in JWT token")
 	}
-	row := h.DB.QueryRow("select post_id from users_posts where post_id = $1 and user_id = $2 and relation_type = 'AUTHOR' ", id, userID)
-
-	if row.Err() != nil {
-		return row.Err()
-	}
-	temp := ""
-	err := row.Scan(&temp)
+	allowed, err := h.canEditPost(c, id)
 	if err != nil {
+		return err
+	}
+	if !allowed {
 		return fmt.Errorf("not authorized")
 	}
 
 	if id != "" && title != "" && content != "" {
-		stmt, err := h.DB.Prepare("update posts set title = ?, content = ?, draft = ?,updated_at = ? where post_id = ?")
+		before, err := h.Posts.GetByID(c.Request().Context(), CurrentSite(c).ID, id)
 		if err != nil {
 			return err
 		}
-		_, err = stmt.Exec(title, content, draft, time.Now().UTC(), id)
+		post := domain.Post{
+			ID:      id,
+			SiteID:  CurrentSite(c).ID,
+			Title:   title,
+			Content: content,
+			Draft:   draft,
+			Tags:    tags,
+		}
+		err = h.Posts.Update(c.Request().Context(), post)
 		if err != nil {
 			return err
 		}
+		h.postChanged(c, before, post)
 	}
 
 	return c.Redirect(http.StatusFound, "/posts/"+id)
 }
 
+// canEditPost reports if the logged in user is the author of the post, or
+// may edit anyone's.
+func (h *Handler) canEditPost(c echo.Context, postID string) (bool, error) {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return false, nil
+	}
+	isAuthor, err := h.Posts.IsAuthor(c.Request().Context(), postID, userID)
+	if err != nil || isAuthor {
+		return isAuthor, err
+	}
+	return h.can(c, domain.PermissionEditAnyPost)
+}
+
 func mdToHTML(md string) []byte {
 	// create markdown parser with extensions
 	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestDraftsOnlyShownToEditors(t *testing.T) {
+	h := newTestHandler(t)
+	admin := newTestAdmin(t, h)
+	alice := createTestUser(t, h, "alice", "password")
+	bob := createTestUser(t, h, "bob", "password")
+	createTestPost(t, h, alice, "Published", false)
+	draft := createTestPost(t, h, alice, "Secret draft", true)
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		shown   bool
+	}{
+		{"anonymous", nil, false},
+		{"another user", []*http.Cookie{sessionCookie(t, h, bob)}, false},
+		{"the author", []*http.Cookie{sessionCookie(t, h, alice)}, true},
+		{"an admin", []*http.Cookie{sessionCookie(t, h, admin)}, true},
+	}
+	for _, tt := range tests {
+		c, rec := newTestContext(http.MethodGet, "/", nil, tt.cookies...)
+		if err := h.GetPosts(c); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(rec.Body.String(), "Published") || strings.Contains(rec.Body.String(), "Secret draft") != tt.shown {
+			t.Errorf("%s: home page %s", tt.name, rec.Body)
+		}
+
+		c, rec = newTestContext(http.MethodGet, "/posts/"+draft.ID, nil, tt.cookies...)
+		c.SetParamNames("id")
+		c.SetParamValues(draft.ID)
+		err := h.GetByID(c)
+		if tt.shown && (err != nil || rec.Code != http.StatusOK) {
+			t.Errorf("%s: viewing the draft: status %d, %v", tt.name, rec.Code, err)
+		}
+		if !tt.shown && !errors.Is(err, echo.ErrNotFound) {
+			t.Errorf("%s: viewing the draft: %v, want %v", tt.name, err, echo.ErrNotFound)
+		}
+	}
+}
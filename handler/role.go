@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"backyard/domain"
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+// can reports if the logged in user has a role granting permission.
+func (h *Handler) can(c echo.Context, permission string) (bool, error) {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return false, nil
+	}
+	return h.Roles.HasPermission(c.Request().Context(), userID, permission)
+}
+
+// RequirePermission only lets through users whose roles grant permission.
+// Visitors that are not logged in are sent to the login page first, and
+// scripts whose access token lacks the scope of the route are turned away.
+func (h *Handler) RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if h.getUserID(c) == "" {
+				if bearerToken(c) != "" {
+					return echo.ErrForbidden
+				}
+				return c.Redirect(http.StatusFound, "/login")
+			}
+			ok, err := h.can(c, permission)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return renderMessage(c, http.StatusForbidden, "error.forbidden", "roles.error.forbidden")
+			}
+			return next(c)
+		}
+	}
+}
+
+type UserRolesDTO struct {
+	ID       string
+	Username string
+	// Roles holds the IDs of the roles of the user.
+	Roles map[string]bool
+	Self  bool
+}
+
+// GetRoles lists the roles of the site with what they allow, and the users
+// with the roles they have.
+func (h *Handler) GetRoles(c echo.Context) error {
+	return h.renderRoles(c, "")
+}
+
+func (h *Handler) renderRoles(c echo.Context, errorMessage string) error {
+	ctx := c.Request().Context()
+	siteID := CurrentSite(c).ID
+	roles, err := h.Roles.List(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	users, err := h.Users.List(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	userRoles, err := h.Roles.ListUserRoles(ctx, siteID)
+	if err != nil {
+		return err
+	}
+
+	dtos := []UserRolesDTO{}
+	for _, u := range users {
+		dto := UserRolesDTO{ID: u.ID, Username: u.Username, Roles: map[string]bool{}, Self: u.ID == h.getUserID(c)}
+		for _, id := range userRoles[u.ID] {
+			dto.Roles[id] = true
+		}
+		dtos = append(dtos, dto)
+	}
+	status := http.StatusOK
+	if errorMessage != "" {
+		status = http.StatusBadRequest
+	}
+	return c.Render(status, "admin-roles.html", struct {
+		Roles []domain.Role
+		Users []UserRolesDTO
+		Error string
+	}{
+		Roles: roles,
+		Users: dtos,
+		Error: errorMessage,
+	})
+}
+
+// SetUserRoles replaces the roles of a user with the ones checked in the
+// form. Admins cannot take away their own permission to manage roles, so a
+// site always keeps someone able to give it back.
+func (h *Handler) SetUserRoles(c echo.Context) error {
+	ctx := c.Request().Context()
+	siteID := CurrentSite(c).ID
+	user, err := h.Users.GetByID(ctx, c.Param("id"))
+	if err != nil || user.SiteID != siteID {
+		return echo.ErrNotFound
+	}
+
+	form, err := c.FormParams()
+	if err != nil {
+		return err
+	}
+	roleIDs := form["role"]
+	if user.ID == h.getUserID(c) {
+		roles, err := h.Roles.List(ctx, siteID)
+		if err != nil {
+			return err
+		}
+		keeps := slices.ContainsFunc(roles, func(r domain.Role) bool {
+			return slices.Contains(roleIDs, r.ID) && r.Allows(domain.PermissionManageRoles)
+		})
+		if !keeps {
+			return h.renderRoles(c, "roles.error.self")
+		}
+	}
+
+	err = h.Roles.SetUserRoles(ctx, siteID, user.ID, roleIDs)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/roles")
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"backyard/domain"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// sessionDuration is how long a login lasts without logging in again.
+const sessionDuration = time.Hour * 24 * 7
+
+// touchInterval limits how often the last seen time of a session is written.
+const touchInterval = time.Minute
+
+const sessionContextKey = "session"
+
+func (h *Handler) isLoggedIn(c echo.Context) bool {
+	return h.getUserID(c) != ""
+}
+
+// getUserID returns the ID of the logged in user, or an empty string if the
+// request has no live session nor an access token allowed on the route.
+func (h *Handler) getUserID(c echo.Context) string {
+	session, ok := h.currentSession(c)
+	if !ok {
+		return h.tokenUserID(c)
+	}
+	return session.UserID
+}
+
+// currentSession returns the session referenced by the authorization cookie,
+// if it is live. The result is kept in the context, so the database is only
+// queried once per request.
+func (h *Handler) currentSession(c echo.Context) (domain.Session, bool) {
+	if session, ok := c.Get(sessionContextKey).(*domain.Session); ok {
+		return *session, session.ID != ""
+	}
+	session := h.lookupSession(c)
+	c.Set(sessionContextKey, &session)
+	return session, session.ID != ""
+}
+
+// parseToken returns the claims of a JWT signed with the JWT secret, if it
+// has not expired.
+func (h *Handler) parseToken(value string) (jwt.MapClaims, bool) {
+	token, err := jwt.Parse(value, func(token *jwt.Token) (interface{}, error) {
+		// SigningMethodHMAC implements the HMAC-SHA family of signing methods.
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return []byte(h.JWTSecret), nil
+	})
+	if err != nil {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, false
+	}
+	expiration, ok := claims["expiration"].(float64)
+	// check if the token has expired
+	if !ok || time.Now().Compare(time.Unix((int64(expiration)), 0)) > 0 {
+		return nil, false
+	}
+	return claims, true
+}
+
+func (h *Handler) lookupSession(c echo.Context) domain.Session {
+	// Scripts sending an access token only act with its scopes
+	if h.JWTSecret == "" || bearerToken(c) != "" {
+		return domain.Session{}
+	}
+
+	cookie, err := c.Cookie("Authorization")
+	if err != nil {
+		return domain.Session{}
+	}
+	claims, ok := h.parseToken(cookie.Value)
+	if !ok {
+		return domain.Session{}
+	}
+
+	// Tokens issued before sessions existed are no longer accepted
+	sessionID, ok := claims["sessionID"].(string)
+	if !ok {
+		return domain.Session{}
+	}
+	userID, ok := claims["userID"].(string)
+	if !ok {
+		return domain.Session{}
+	}
+	session, err := h.Sessions.GetByID(c.Request().Context(), CurrentSite(c).ID, sessionID)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			LogError(c, err)
+		}
+		return domain.Session{}
+	}
+	now := time.Now()
+	if session.UserID != userID || !session.Live(now) {
+		return domain.Session{}
+	}
+	if now.Sub(session.LastSeenAt) > touchInterval {
+		if err := h.Sessions.Touch(c.Request().Context(), session.SiteID, session.ID, now); err != nil {
+			LogError(c, err)
+		}
+		session.LastSeenAt = now
+	}
+	return session
+}
+
+// startSession records a new session for the user on this device and sets
+// the authorization cookie referencing it.
+func (h *Handler) startSession(c echo.Context, user domain.User) error {
+	session := domain.Session{
+		ID:        uuid.NewString(),
+		SiteID:    user.SiteID,
+		UserID:    user.ID,
+		UserAgent: c.Request().UserAgent(),
+		IP:        c.RealIP(),
+		ExpiresAt: time.Now().Add(sessionDuration),
+	}
+	cookie, err := h.authorizationCookie(session)
+	if err != nil {
+		return err
+	}
+	err = h.Sessions.Create(c.Request().Context(), session)
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie(cookie)
+	c.Set(sessionContextKey, &session)
+	return nil
+}
+
+func (h *Handler) authorizationCookie(session domain.Session) (*http.Cookie, error) {
+	if h.JWTSecret == "" {
+		return nil, errors.New("missing secret")
+	}
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["userID"] = session.UserID
+	claims["siteID"] = session.SiteID
+	claims["sessionID"] = session.ID
+	claims["expiration"] = session.ExpiresAt.Unix()
+	signedData, err := token.SignedString([]byte(h.JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	return h.newCookie("Authorization", signedData, session.ExpiresAt), nil
+}
+
+func (h *Handler) clearAuthorizationCookie(c echo.Context) {
+	c.SetCookie(h.newCookie("Authorization", "", time.Now().Add(-1*time.Second)))
+}
+
+type SessionDTO struct {
+	ID         string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	Current    bool
+}
+
+// GetSessions lists the devices the user is logged in on.
+func (h *Handler) GetSessions(c echo.Context) error {
+	current, ok := h.currentSession(c)
+	if !ok {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	return h.renderSessions(c, current, "")
+}
+
+func (h *Handler) renderSessions(c echo.Context, current domain.Session, errorMessage string) error {
+	sessions, err := h.Sessions.ListByUser(c.Request().Context(), current.SiteID, current.UserID)
+	if err != nil {
+		return err
+	}
+	dtos := []SessionDTO{}
+	for _, s := range sessions {
+		dtos = append(dtos, SessionDTO{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			Current:    s.ID == current.ID,
+		})
+	}
+	return c.Render(http.StatusOK, "user-sessions.html", struct {
+		Sessions []SessionDTO
+		// Error is the message key of the last error
+		Error string
+	}{
+		Sessions: dtos,
+		Error:    errorMessage,
+	})
+}
+
+// RevokeSession logs one of the user's devices out.
+func (h *Handler) RevokeSession(c echo.Context) error {
+	current, ok := h.currentSession(c)
+	if !ok {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	err := h.Sessions.Revoke(c.Request().Context(), current.SiteID, current.UserID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	if c.Param("id") == current.ID {
+		h.clearAuthorizationCookie(c)
+		return c.Redirect(http.StatusFound, "/")
+	}
+	return c.Redirect(http.StatusFound, "/settings/sessions")
+}
+
+// RevokeAllSessions logs the user out on every device, this one included.
+func (h *Handler) RevokeAllSessions(c echo.Context) error {
+	current, ok := h.currentSession(c)
+	if !ok {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	err := h.Sessions.RevokeAll(c.Request().Context(), current.SiteID, current.UserID, "")
+	if err != nil {
+		return err
+	}
+	h.clearAuthorizationCookie(c)
+	return c.Redirect(http.StatusFound, "/")
+}
@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/i18n"
+	"backyard/theme"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Theme returns the name of the theme to render the request with: the one
+// the logged in user picked, or else the one of the site.
+func (h *Handler) Theme(c echo.Context) string {
+	if userID := h.getUserID(c); userID != "" {
+		user, err := h.Users.GetByID(c.Request().Context(), userID)
+		if err == nil && slices.Contains(h.Themes, user.Theme) {
+			return user.Theme
+		}
+	}
+	config, err := h.Configs.GetActive(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return theme.Default
+	}
+	return config.Theme
+}
+
+// settingsUser returns the logged in user, and whether the username in the
+// URL is theirs. Users can only see and change their own settings.
+func (h *Handler) settingsUser(c echo.Context) (domain.User, bool, error) {
+	user, err := h.Users.GetByID(c.Request().Context(), h.getUserID(c))
+	if err != nil {
+		return domain.User{}, false, err
+	}
+	return user, user.Username == c.Param("username"), nil
+}
+
+// notOwnSettings answers requests for the settings of someone else. Pages are
+// redirected to the settings of the user, which also follows renames.
+func notOwnSettings(c echo.Context, user domain.User) error {
+	if c.Request().Method == http.MethodGet {
+		return c.Redirect(http.StatusFound, "/"+user.Username+strings.TrimPrefix(c.Request().URL.Path, "/"+c.Param("username")))
+	}
+	return renderMessage(c, http.StatusForbidden, "error.forbidden", "settings.error.forbidden")
+}
+
+// GetSettings shows the account settings of the logged in user.
+func (h *Handler) GetSettings(c echo.Context) error {
+	if h.getUserID(c) == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	user, own, err := h.settingsUser(c)
+	if err != nil {
+		return err
+	}
+	if !own {
+		return notOwnSettings(c, user)
+	}
+	return h.renderSettings(c, user, "")
+}
+
+func (h *Handler) renderSettings(c echo.Context, user domain.User, errorMessage string) error {
+	addr := ""
+	if user.Email != nil {
+		addr = *user.Email
+	}
+	status := http.StatusOK
+	if errorMessage != "" {
+		status = http.StatusBadRequest
+	}
+	return c.Render(status, "user-settings.html", struct {
+		Username      string
+		Email         string
+		EmailVerified bool
+		Locale        string
+		Locales       []string
+		Theme         string
+		Themes        []string
+		// Error is the message key of the last error
+		Error string
+	}{
+		Username:      user.Username,
+		Email:         addr,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Locale:        user.Locale,
+		Locales:       i18n.Locales(),
+		Theme:         user.Theme,
+		Themes:        h.Themes,
+		Error:         errorMessage,
+	})
+}
+
+// SaveSettings changes the username, email and display preferences of the
+// logged in user. A new email is sent a link to verify it, and the old
+// username keeps redirecting to the new one. Changing the email needs the
+// current password.
+func (h *Handler) SaveSettings(c echo.Context) error {
+	if h.getUserID(c) == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	ctx := c.Request().Context()
+	user, own, err := h.settingsUser(c)
+	if err != nil {
+		return err
+	}
+	if !own {
+		return notOwnSettings(c, user)
+	}
+
+	locale := c.FormValue("locale")
+	userTheme := c.FormValue("theme")
+	if (locale != "" && !i18n.Supported(locale)) || (userTheme != "" && !slices.Contains(h.Themes, userTheme)) {
+		return c.HTML(http.StatusBadRequest, T(c, "error.bad_request"))
+	}
+	username := strings.TrimSpace(c.FormValue("username"))
+	if username == "" {
+		return h.renderSettings(c, user, "settings.error.empty_username")
+	}
+	if username != user.Username {
+		if !usernamePattern.MatchString(username) {
+			return h.renderSettings(c, user, "error.username_invalid")
+		}
+		if h.usernameReserved(username) {
+			return h.renderSettings(c, user, "error.username_reserved")
+		}
+		taken, err := h.Users.UsernameExists(ctx, user.SiteID, username)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return h.renderSettings(c, user, "error.username_taken")
+		}
+	}
+	addr, err := normalizeEmail(c.FormValue("email"))
+	if err != nil {
+		return h.renderSettings(c, user, "error.invalid_email")
+	}
+	emailChanged := user.Email == nil || addr != *user.Email
+	if emailChanged {
+		// Whoever controls the email can reset the password, so changing it
+		// needs the password like changing the password does
+		if err := h.checkCurrentPassword(c, user); err != nil {
+			message, ok := currentPasswordMessage(err)
+			if !ok {
+				return err
+			}
+			return h.renderSettings(c, user, message)
+		}
+		taken, err := h.Users.EmailExists(ctx, user.SiteID, addr)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return h.renderSettings(c, user, "error.email_taken")
+		}
+	}
+
+	if username != user.Username {
+		err = h.Users.SetUsername(ctx, user.ID, username)
+		if err != nil {
+			return err
+		}
+		user.Username = username
+	}
+	if locale != user.Locale {
+		err = h.Users.SetLocale(ctx, user.ID, locale)
+		if err != nil {
+			return err
+		}
+		user.Locale = locale
+	}
+	if userTheme != user.Theme {
+		err = h.Users.SetTheme(ctx, user.ID, userTheme)
+		if err != nil {
+			return err
+		}
+	}
+	if emailChanged {
+		err = h.Users.SetEmail(ctx, user.ID, addr)
+		if err != nil {
+			return err
+		}
+		user.Email = &addr
+		err = h.sendVerificationEmail(c, user)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Redirect(http.StatusFound, "/"+user.Username+"/settings")
+}
+
+// ChangePassword sets a new password after checking the current one. Every
+// other session of the user is revoked, in case the password was changed
+// because someone else knew it.
+func (h *Handler) ChangePassword(c echo.Context) error {
+	current, ok := h.currentSession(c)
+	if !ok {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	user, own, err := h.settingsUser(c)
+	if err != nil {
+		return err
+	}
+	if !own {
+		return notOwnSettings(c, user)
+	}
+	if err := h.checkCurrentPassword(c, user); err != nil {
+		message, ok := currentPasswordMessage(err)
+		if !ok {
+			return err
+		}
+		return h.renderSettings(c, user, message)
+	}
+	password := c.FormValue("new_password")
+	if len(password) == 0 {
+		return h.renderSettings(c, user, "sessions.error.empty_password")
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	err = h.Users.SetPassword(c.Request().Context(), user.ID, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	err = h.Sessions.RevokeAll(c.Request().Context(), current.SiteID, current.UserID, current.ID)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/"+user.Username+"/settings")
+}
+
+// GetDeleteAccountForm asks users to confirm they want to delete their own
+// account.
+func (h *Handler) GetDeleteAccountForm(c echo.Context) error {
+	if h.getUserID(c) == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	user, own, err := h.settingsUser(c)
+	if err != nil {
+		return err
+	}
+	if !own {
+		return notOwnSettings(c, user)
+	}
+	return h.renderDeleteAccount(c, user, "")
+}
+
+func (h *Handler) renderDeleteAccount(c echo.Context, user domain.User, errorMessage string) error {
+	posts, err := h.Posts.CountByAuthor(c.Request().Context(), user.SiteID, true)
+	if err != nil {
+		return err
+	}
+	status := http.StatusOK
+	if errorMessage != "" {
+		status = http.StatusBadRequest
+	}
+	return c.Render(status, "user-delete.html", struct {
+		Username string
+		Posts    int
+		Error    string
+	}{
+		Username: user.Username,
+		Posts:    posts[user.ID],
+		Error:    errorMessage,
+	})
+}
+
+// deleteAccount deletes the account of the logged in user with their posts,
+// once they typed their username to confirm it. The last user able to manage
+// roles cannot leave, so the site keeps someone able to give them out.
+func (h *Handler) deleteAccount(c echo.Context, user domain.User) error {
+	if c.FormValue("confirm") != user.Username {
+		return h.renderDeleteAccount(c, user, "settings.error.confirm")
+	}
+	last, err := h.lastRoleManager(c, user)
+	if err != nil {
+		return err
+	}
+	if last {
+		return h.renderDeleteAccount(c, user, "settings.error.last_admin")
+	}
+
+	err = h.removeUser(c, user, "")
+	if err != nil {
+		return err
+	}
+	h.clearAuthorizationCookie(c)
+	return c.Redirect(http.StatusFound, "/")
+}
+
+// lastRoleManager reports if user is the only user of the site allowed to
+// manage roles.
+func (h *Handler) lastRoleManager(c echo.Context, user domain.User) (bool, error) {
+	roles, err := h.Roles.List(c.Request().Context(), user.SiteID)
+	if err != nil {
+		return false, err
+	}
+	managers := map[string]bool{}
+	for _, r := range roles {
+		managers[r.ID] = r.Allows(domain.PermissionManageRoles)
+	}
+	userRoles, err := h.Roles.ListUserRoles(c.Request().Context(), user.SiteID)
+	if err != nil {
+		return false, err
+	}
+	manager := false
+	for userID, ids := range userRoles {
+		if !slices.ContainsFunc(ids, func(id string) bool { return managers[id] }) {
+			continue
+		}
+		if userID != user.ID {
+			return false, nil
+		}
+		manager = true
+	}
+	return manager, nil
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"backyard/domain"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSaveSettingsEmailNeedsPassword(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "password")
+	mailer := h.Mailer.(*testMailer)
+
+	save := func(form url.Values) (int, string) {
+		t.Helper()
+		c, rec := newTestContext(http.MethodPut, "/alice/settings", form, sessionCookie(t, h, alice))
+		c.SetParamNames("username")
+		c.SetParamValues("alice")
+		if err := h.SaveSettings(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, rec.Body.String()
+	}
+
+	for _, password := range []string{"", "wrong"} {
+		status, body := save(url.Values{"username": {"alice"}, "email": {"new@example.com"}, "current_password": {password}})
+		if status != http.StatusBadRequest || !strings.Contains(body, "sessions.error.wrong_password") {
+			t.Errorf("password %q: status %d, %s", password, status, body)
+		}
+	}
+	user, err := h.Users.GetByID(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *user.Email != "alice@example.com" || len(mailer.Sent()) != 0 {
+		t.Fatalf("email changed to %s without the password, %d emails sent", *user.Email, len(mailer.Sent()))
+	}
+
+	// Other settings do not need it
+	if status, body := save(url.Values{"username": {"alice"}, "email": {"alice@example.com"}, "theme": {""}}); status != http.StatusFound {
+		t.Errorf("saving without changing the email: status %d, %s", status, body)
+	}
+
+	if status, body := save(url.Values{"username": {"alice"}, "email": {"new@example.com"}, "current_password": {"password"}}); status != http.StatusFound {
+		t.Fatalf("changing the email with the password: status %d, %s", status, body)
+	}
+	user, err = h.Users.GetByID(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *user.Email != "new@example.com" || user.EmailVerifiedAt != nil {
+		t.Errorf("email after changing it: %s, verified at %v", *user.Email, user.EmailVerifiedAt)
+	}
+	if sent := mailer.Sent(); len(sent) != 1 || sent[0].To != "new@example.com" {
+		t.Errorf("emails sent: %+v", sent)
+	}
+}
+
+func TestInvalidUsernames(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "password")
+
+	for _, username := range []string{"a/b", "a?b", "a#b", "a b", ".", "..", "-a"} {
+		c, rec := newTestContext(http.MethodPut, "/alice/settings", url.Values{"username": {username}, "email": {"alice@example.com"}}, sessionCookie(t, h, alice))
+		c.SetParamNames("username")
+		c.SetParamValues("alice")
+		if err := h.SaveSettings(c); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "error.username_invalid") {
+			t.Errorf("renaming to %q: status %d, %s", username, rec.Code, rec.Body)
+		}
+
+		c, rec = newTestContext(http.MethodPost, "/signup", url.Values{"username": {username}, "email": {"bob@example.com"}, "password": {"password"}})
+		if err := h.NewUser(c); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("signing up as %q: status %d", username, rec.Code)
+		}
+	}
+
+	c, rec := newTestContext(http.MethodPut, "/alice/settings", url.Values{"username": {"Alice_B.2-x"}, "email": {"alice@example.com"}}, sessionCookie(t, h, alice))
+	c.SetParamNames("username")
+	c.SetParamValues("alice")
+	if err := h.SaveSettings(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusFound {
+		t.Errorf("renaming to Alice_B.2-x: status %d, %s", rec.Code, rec.Body)
+	}
+}
+
+func TestChangePasswordLocksOutAfterWrongPasswords(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "password")
+	session := sessionCookie(t, h, alice)
+
+	change := func(ip string, current string) (int, string) {
+		t.Helper()
+		form := url.Values{"current_password": {current}, "new_password": {"new password"}}
+		c, rec := newTestContext(http.MethodPut, "/alice/settings/password", form, session)
+		c.Request().RemoteAddr = ip + ":1234"
+		c.SetParamNames("username")
+		c.SetParamValues("alice")
+		if err := h.ChangePassword(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, rec.Body.String()
+	}
+
+	// Every guess comes from another IP address, so only the username
+	// lockout applies
+	for i := range maxLoginFailures {
+		status, body := change(fmt.Sprintf("192.0.2.%d", i+1), "wrong")
+		if status != http.StatusBadRequest || !strings.Contains(body, "sessions.error.wrong_password") {
+			t.Fatalf("wrong password %d: status %d, %s", i+1, status, body)
+		}
+	}
+	if status, body := change("198.51.100.1", "password"); !strings.Contains(body, "error.too_many_attempts") {
+		t.Errorf("right password after the lockout: status %d, %s", status, body)
+	}
+	user, err := h.Users.GetByID(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password != alice.Password {
+		t.Error("the password changed during the lockout")
+	}
+	events, err := h.Logins.ListEvents(context.Background(), domain.DefaultSiteID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := 0
+	for _, event := range events {
+		if event.Event == domain.LoginEventFailure && event.UserID == alice.ID {
+			failures++
+		}
+	}
+	if failures != maxLoginFailures {
+		t.Errorf("%d failure events, want %d", failures, maxLoginFailures)
+	}
+}
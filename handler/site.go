@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"backyard/domain"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const siteContextKey = "site"
+const domainUserContextKey = "domainUserID"
+
+// SiteMiddleware resolves the site from the request Host header and stores it
+// in the context for the handlers. A verified user domain is served by the
+// site of its user, and hosts without a site of their own are served by the
+// default site.
+func (h *Handler) SiteMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		host := hostname(c.Request().Host)
+		site, err := h.Sites.GetByHostname(c.Request().Context(), host)
+		if errors.Is(err, domain.ErrNotFound) {
+			if userDomain, domainErr := h.UserDomains.GetVerified(c.Request().Context(), host); domainErr == nil {
+				c.Set(domainUserContextKey, userDomain.UserID)
+				site, err = h.Sites.GetByID(c.Request().Context(), userDomain.SiteID)
+			} else {
+				site, err = h.Sites.GetByID(c.Request().Context(), domain.DefaultSiteID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		c.Set(siteContextKey, site)
+		return next(c)
+	}
+}
+
+// CurrentSite returns the site the request is for.
+func CurrentSite(c echo.Context) domain.Site {
+	if site, ok := c.Get(siteContextKey).(domain.Site); ok {
+		return site
+	}
+	return domain.Site{ID: domain.DefaultSiteID}
+}
+
+// domainUserID returns the user whose custom domain the request is for, or an
+// empty string for site hosts.
+func domainUserID(c echo.Context) string {
+	userID, _ := c.Get(domainUserContextKey).(string)
+	return userID
+}
+
+// hostname strips the port from a Host header and lowercases it.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
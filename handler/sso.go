@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/sso"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ssoLoginDuration is how long users have to log in at the identity provider.
+const ssoLoginDuration = 10 * time.Minute
+
+func (h *Handler) ssoRedirectURL(c echo.Context) string {
+	return h.siteURL(c) + "/login/sso/callback"
+}
+
+// startSSOLogin redirects to the identity provider, remembering the request
+// in a short lived cookie. linkUserID is the user adding the identity to their
+// account, or empty to log in with it.
+func (h *Handler) startSSOLogin(c echo.Context, linkUserID string) error {
+	request := sso.NewRequest()
+	authURL, err := h.SSO.AuthCodeURL(c.Request().Context(), h.ssoRedirectURL(c), request)
+	if err != nil {
+		LogError(c, err)
+		return renderMessage(c, http.StatusBadGateway, "sso.title", "sso.error.unavailable")
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["userID"] = linkUserID
+	claims["siteID"] = CurrentSite(c).ID
+	claims["purpose"] = "sso"
+	claims["state"] = request.State
+	claims["nonce"] = request.Nonce
+	claims["verifier"] = request.Verifier
+	expires := time.Now().Add(ssoLoginDuration)
+	claims["expiration"] = expires.Unix()
+	signedData, err := token.SignedString([]byte(h.JWTSecret))
+	if err != nil {
+		return err
+	}
+	c.SetCookie(h.newCookie("SSO", signedData, expires))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// ssoRequest returns the request started by startSSOLogin, if the state the
+// provider redirected back with matches, and the user linking the identity.
+func (h *Handler) ssoRequest(c echo.Context) (sso.Request, string, bool) {
+	cookie, err := c.Cookie("SSO")
+	if err != nil {
+		return sso.Request{}, "", false
+	}
+	c.SetCookie(h.newCookie("SSO", "", time.Now().Add(-1*time.Second)))
+	claims, ok := h.parseToken(cookie.Value)
+	if !ok || claims["purpose"] != "sso" || claims["siteID"] != CurrentSite(c).ID {
+		return sso.Request{}, "", false
+	}
+	request := sso.Request{}
+	request.State, _ = claims["state"].(string)
+	request.Nonce, _ = claims["nonce"].(string)
+	request.Verifier, _ = claims["verifier"].(string)
+	if request.State == "" || request.State != c.QueryParam("state") {
+		return sso.Request{}, "", false
+	}
+	userID, _ := claims["userID"].(string)
+	return request, userID, true
+}
+
+// StartSSOLogin sends the visitor to log in at the identity provider.
+func (h *Handler) StartSSOLogin(c echo.Context) error {
+	if h.SSO == nil {
+		return echo.ErrNotFound
+	}
+	return h.startSSOLogin(c, "")
+}
+
+// SSOCallback is where the identity provider redirects back to. It logs in
+// the user linked to the identity, links it to the user that asked to, or
+// creates a user for it when auto-provisioning is on and sign-up is open.
+func (h *Handler) SSOCallback(c echo.Context) error {
+	if h.SSO == nil {
+		return echo.ErrNotFound
+	}
+	request, linkUserID, ok := h.ssoRequest(c)
+	if !ok {
+		return renderMessage(c, http.StatusBadRequest, "sso.title", "sso.error.expired")
+	}
+	if c.QueryParam("error") != "" {
+		return renderMessage(c, http.StatusUnauthorized, "sso.title", "sso.error.denied")
+	}
+	claims, err := h.SSO.Exchange(c.Request().Context(), h.ssoRedirectURL(c), request, c.QueryParam("code"))
+	if err != nil {
+		LogError(c, err)
+		return renderMessage(c, http.StatusBadGateway, "sso.title", "sso.error.failed")
+	}
+
+	ctx := c.Request().Context()
+	identity, err := h.Identities.GetBySubject(ctx, CurrentSite(c).ID, claims.Issuer, claims.Subject)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	found := err == nil
+
+	if linkUserID != "" {
+		if h.getUserID(c) != linkUserID {
+			return renderMessage(c, http.StatusBadRequest, "sso.title", "sso.error.expired")
+		}
+		if found && identity.UserID != linkUserID {
+			return renderMessage(c, http.StatusConflict, "sso.title", "sso.error.linked_elsewhere")
+		}
+		if !found {
+			err = h.Identities.Create(ctx, domain.Identity{
+				ID:      uuid.NewString(),
+				SiteID:  CurrentSite(c).ID,
+				UserID:  linkUserID,
+				Issuer:  claims.Issuer,
+				Subject: claims.Subject,
+				Email:   claims.Email,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return c.Redirect(http.StatusFound, "/settings/sso")
+	}
+
+	var user domain.User
+	if found {
+		user, err = h.Users.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return err
+		}
+	} else {
+		if !h.SSO.Config.AutoProvision {
+			return renderMessage(c, http.StatusForbidden, "sso.title", "sso.error.not_linked")
+		}
+		// Provisioning signs up, so it is only allowed when anyone can sign
+		// up. Identities carry no invite code.
+		config, err := h.Configs.GetActive(ctx, CurrentSite(c).ID)
+		if err != nil {
+			return err
+		}
+		if h.signupMode(c, config) != domain.SignupOpen {
+			return renderMessage(c, http.StatusForbidden, "sso.title", "error.signup_disabled")
+		}
+		user, identity, err = h.provisionSSOUser(c, claims)
+		if err != nil {
+			return err
+		}
+	}
+	err = h.Identities.RecordLogin(ctx, identity.ID, claims.Email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	twoFactor, err := h.TwoFactor.Get(ctx, user.ID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	if twoFactor.Enabled() {
+		return h.startTwoFactorLogin(c, user)
+	}
+	err = h.finishLogin(c, user)
+	if errors.Is(err, errAccountSuspended) {
+		return renderMessage(c, http.StatusForbidden, "sso.title", "error.suspended")
+	}
+	if errors.Is(err, errPasswordResetRequired) {
+		return renderMessage(c, http.StatusForbidden, "sso.title", "error.password_reset_required")
+	}
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
+
+var notUsernameChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// ssoUsername returns a free username for a provisioned user, based on the
+// one they have at the identity provider. Reserved usernames get a number
+// like taken ones.
+func (h *Handler) ssoUsername(c echo.Context, claims sso.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Trim(notUsernameChars.ReplaceAllString(strings.ToLower(base), "-"), "-.")
+	if base == "" {
+		base = "user"
+	}
+	username := base
+	for n := 2; ; n++ {
+		taken, err := h.Users.UsernameExists(c.Request().Context(), CurrentSite(c).ID, username)
+		if err != nil {
+			return "", err
+		}
+		if !taken && !h.usernameReserved(username) {
+			return username, nil
+		}
+		username = fmt.Sprintf("%s%d", base, n)
+	}
+}
+
+// provisionSSOUser creates a user for an identity logging in for the first
+// time. The user has no usable password, and gets the email of the provider
+// if it verified it and no other user has it.
+func (h *Handler) provisionSSOUser(c echo.Context, claims sso.Claims) (domain.User, domain.Identity, error) {
+	ctx := c.Request().Context()
+	username, err := h.ssoUsername(c, claims)
+	if err != nil {
+		return domain.User{}, domain.Identity{}, err
+	}
+	password, err := randomToken(32)
+	if err != nil {
+		return domain.User{}, domain.Identity{}, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return domain.User{}, domain.Identity{}, err
+	}
+	user := domain.User{
+		ID:       uuid.NewString(),
+		SiteID:   CurrentSite(c).ID,
+		Username: username,
+		Password: string(hashedPassword),
+	}
+
+	addr := ""
+	if claims.EmailVerified {
+		if normalized, err := normalizeEmail(claims.Email); err == nil {
+			taken, err := h.Users.EmailExists(ctx, user.SiteID, normalized)
+			if err != nil {
+				return domain.User{}, domain.Identity{}, err
+			}
+			if !taken {
+				addr = normalized
+				user.Email = &addr
+			}
+		}
+	}
+	if err := h.Users.Create(ctx, user); err != nil {
+		return domain.User{}, domain.Identity{}, err
+	}
+	if err := h.Roles.Assign(ctx, user.SiteID, user.ID, domain.RoleDefault); err != nil {
+		return domain.User{}, domain.Identity{}, err
+	}
+	if addr != "" {
+		if err := h.Users.SetEmailVerified(ctx, user.ID, addr); err != nil {
+			return domain.User{}, domain.Identity{}, err
+		}
+	}
+
+	identity := domain.Identity{
+		ID:      uuid.NewString(),
+		SiteID:  user.SiteID,
+		UserID:  user.ID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+	if err := h.Identities.Create(ctx, identity); err != nil {
+		return domain.User{}, domain.Identity{}, err
+	}
+	h.userSignedUp(c, user)
+	return user, identity, nil
+}
+
+// GetIdentities lists the identities linked to the user, with the button to
+// link one.
+func (h *Handler) GetIdentities(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	if h.SSO == nil {
+		return echo.ErrNotFound
+	}
+	identities, err := h.Identities.ListByUser(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "user-sso.html", struct {
+		Provider   string
+		Identities []domain.Identity
+	}{
+		Provider:   h.SSO.Config.Name,
+		Identities: identities,
+	})
+}
+
+// LinkIdentity sends the user to the identity provider to link their account
+// there to this one.
+func (h *Handler) LinkIdentity(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	if h.SSO == nil {
+		return echo.ErrNotFound
+	}
+	return h.startSSOLogin(c, userID)
+}
+
+// UnlinkIdentity removes an identity of the user, which can no longer be
+// used to log in.
+func (h *Handler) UnlinkIdentity(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	err := h.Identities.Delete(c.Request().Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/settings/sso")
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/sso"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ssoTest is a handler logging in with a mock identity provider served by an
+// httptest.Server.
+type ssoTest struct {
+	h        *Handler
+	provider *httptest.Server
+}
+
+func newSSOTest(t *testing.T, autoProvision bool) *ssoTest {
+	t.Helper()
+	var mock *sso.MockProvider
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(provider.Close)
+	mock, err := sso.NewMockProvider(provider.URL, "backyard", "client secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t)
+	h.SSO = sso.NewProvider(sso.Config{
+		Issuer:        provider.URL,
+		ClientID:      "backyard",
+		ClientSecret:  "client secret",
+		Name:          "Mock",
+		AutoProvision: autoProvision,
+	})
+	return &ssoTest{h: h, provider: provider}
+}
+
+// start calls start, which should redirect to the provider, and returns the
+// URL of its login page and the cookie remembering the request.
+func (s *ssoTest) start(t *testing.T, start echo.HandlerFunc, cookies ...*http.Cookie) (*url.URL, *http.Cookie) {
+	t.Helper()
+	c, rec := newTestContext(http.MethodGet, "/login/sso", nil, cookies...)
+	if err := start(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusFound {
+		t.Fatalf("starting the login: status %d, %s", rec.Code, rec.Body)
+	}
+	authURL, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL.String(), s.provider.URL+"/authorize?") {
+		t.Fatalf("redirected to %s instead of the provider", authURL)
+	}
+	cookie := responseCookie(rec, "SSO")
+	if cookie == nil {
+		t.Fatal("no SSO cookie")
+	}
+	return authURL, cookie
+}
+
+// authorize logs in at the provider as username and returns the callback URL
+// it redirects back to.
+func (s *ssoTest) authorize(t *testing.T, authURL *url.URL, username string, email string) *url.URL {
+	t.Helper()
+	client := s.provider.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.PostForm(authURL.String(), url.Values{"username": {username}, "email": {email}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("logging in at the provider: status %d", res.StatusCode)
+	}
+	callback, err := res.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Path != "/login/sso/callback" {
+		t.Fatalf("the provider redirected back to %s", callback)
+	}
+	return callback
+}
+
+// callback calls SSOCallback with the query the provider redirected back
+// with.
+func (s *ssoTest) callback(t *testing.T, callback *url.URL, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	c, rec := newTestContext(http.MethodGet, callback.RequestURI(), nil, cookies...)
+	if err := s.h.SSOCallback(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// login goes through the whole login at the provider as username.
+func (s *ssoTest) login(t *testing.T, username string, email string) *httptest.ResponseRecorder {
+	t.Helper()
+	authURL, cookie := s.start(t, s.h.StartSSOLogin)
+	return s.callback(t, s.authorize(t, authURL, username, email), cookie)
+}
+
+// loggedInUser returns the ID of the user the response logged in, or an
+// empty string.
+func (s *ssoTest) loggedInUser(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	cookie := responseCookie(rec, "Authorization")
+	if cookie == nil {
+		return ""
+	}
+	c, _ := newTestContext(http.MethodGet, "/", nil, cookie)
+	return s.h.getUserID(c)
+}
+
+func expectMessage(t *testing.T, rec *httptest.ResponseRecorder, status int, message string) {
+	t.Helper()
+	if rec.Code != status || !strings.Contains(rec.Body.String(), message) {
+		t.Errorf("status %d, %s, want %d with %s", rec.Code, rec.Body, status, message)
+	}
+	if rec.Code == http.StatusFound || responseCookie(rec, "Authorization") != nil {
+		t.Error("logged in")
+	}
+}
+
+func TestSSOLinkAndLogin(t *testing.T) {
+	s := newSSOTest(t, false)
+	alice := createTestUser(t, s.h, "alice", "password")
+	session := sessionCookie(t, s.h, alice)
+
+	// Identities not linked to anyone do not log in without auto-provisioning
+	rec := s.login(t, "alice-at-provider", "")
+	expectMessage(t, rec, http.StatusForbidden, "sso.error.not_linked")
+
+	authURL, cookie := s.start(t, s.h.LinkIdentity, session)
+	rec = s.callback(t, s.authorize(t, authURL, "alice-at-provider", ""), session, cookie)
+	if rec.Code != http.StatusFound || rec.Header().Get(echo.HeaderLocation) != "/settings/sso" {
+		t.Fatalf("linking: status %d, %s", rec.Code, rec.Body)
+	}
+	identities, err := s.h.Identities.ListByUser(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Subject != "mock|alice-at-provider" || identities[0].Issuer != s.provider.URL {
+		t.Fatalf("identities of alice = %+v", identities)
+	}
+
+	rec = s.login(t, "alice-at-provider", "")
+	if rec.Code != http.StatusFound || s.loggedInUser(t, rec) != alice.ID {
+		t.Errorf("login with the linked identity: status %d, logged in as %q", rec.Code, s.loggedInUser(t, rec))
+	}
+}
+
+func TestSSOLinkIdentityOfAnotherUser(t *testing.T) {
+	s := newSSOTest(t, false)
+	alice := createTestUser(t, s.h, "alice", "password")
+	bob := createTestUser(t, s.h, "bob", "password")
+
+	authURL, cookie := s.start(t, s.h.LinkIdentity, sessionCookie(t, s.h, bob))
+	s.callback(t, s.authorize(t, authURL, "shared", ""), sessionCookie(t, s.h, bob), cookie)
+
+	session := sessionCookie(t, s.h, alice)
+	authURL, cookie = s.start(t, s.h.LinkIdentity, session)
+	rec := s.callback(t, s.authorize(t, authURL, "shared", ""), session, cookie)
+	expectMessage(t, rec, http.StatusConflict, "sso.error.linked_elsewhere")
+
+	// The link cookie of one user does not link to another one
+	authURL, cookie = s.start(t, s.h.LinkIdentity, session)
+	rec = s.callback(t, s.authorize(t, authURL, "alice-at-provider", ""), sessionCookie(t, s.h, bob), cookie)
+	expectMessage(t, rec, http.StatusBadRequest, "sso.error.expired")
+}
+
+func TestSSOCallbackRejectsStateMismatch(t *testing.T) {
+	s := newSSOTest(t, true)
+
+	authURL, cookie := s.start(t, s.h.StartSSOLogin)
+	callback := s.authorize(t, authURL, "alice", "")
+	query := callback.Query()
+	query.Set("state", "forged")
+	callback.RawQuery = query.Encode()
+	expectMessage(t, s.callback(t, callback, cookie), http.StatusBadRequest, "sso.error.expired")
+
+	// Nor is a callback without the cookie of the login accepted
+	authURL, _ = s.start(t, s.h.StartSSOLogin)
+	expectMessage(t, s.callback(t, s.authorize(t, authURL, "alice", "")), http.StatusBadRequest, "sso.error.expired")
+}
+
+func TestSSOCallbackRejectsNonceMismatch(t *testing.T) {
+	s := newSSOTest(t, true)
+
+	// The provider puts the nonce it was sent in the ID token
+	authURL, cookie := s.start(t, s.h.StartSSOLogin)
+	query := authURL.Query()
+	query.Set("nonce", "forged")
+	authURL.RawQuery = query.Encode()
+	rec := s.callback(t, s.authorize(t, authURL, "alice", ""), cookie)
+	expectMessage(t, rec, http.StatusBadGateway, "sso.error.failed")
+}
+
+func TestSSOCallbackChecksPKCE(t *testing.T) {
+	s := newSSOTest(t, true)
+
+	// A code issued for another challenge cannot be exchanged with the
+	// verifier of the login
+	authURL, cookie := s.start(t, s.h.StartSSOLogin)
+	if authURL.Query().Get("code_challenge_method") != "S256" || authURL.Query().Get("code_challenge") == "" {
+		t.Fatalf("login without a PKCE challenge: %s", authURL)
+	}
+	query := authURL.Query()
+	query.Set("code_challenge", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+	authURL.RawQuery = query.Encode()
+	rec := s.callback(t, s.authorize(t, authURL, "alice", ""), cookie)
+	expectMessage(t, rec, http.StatusBadGateway, "sso.error.failed")
+
+	// Nor can a code be exchanged twice
+	authURL, cookie = s.start(t, s.h.StartSSOLogin)
+	callback := s.authorize(t, authURL, "alice", "")
+	if rec := s.callback(t, callback, cookie); rec.Code != http.StatusFound {
+		t.Fatalf("login: status %d, %s", rec.Code, rec.Body)
+	}
+	expectMessage(t, s.callback(t, callback, cookie), http.StatusBadGateway, "sso.error.failed")
+}
+
+func TestSSOAutoProvision(t *testing.T) {
+	s := newSSOTest(t, true)
+	createTestUser(t, s.h, "alice", "password")
+
+	rec := s.login(t, "Alice", "alice.provider@example.com")
+	userID := s.loggedInUser(t, rec)
+	if rec.Code != http.StatusFound || userID == "" {
+		t.Fatalf("first login: status %d, %s", rec.Code, rec.Body)
+	}
+	user, err := s.h.Users.GetByID(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The username of the provider is taken here, and the email is verified
+	// by the provider
+	if user.Username != "alice2" || user.Email == nil || *user.Email != "alice.provider@example.com" || user.EmailVerifiedAt == nil {
+		t.Errorf("provisioned user = %+v", user)
+	}
+	if ok, err := s.h.Roles.HasPermission(context.Background(), userID, domain.PermissionCreatePosts); err != nil || !ok {
+		t.Errorf("provisioned user without the default role: %v, %v", ok, err)
+	}
+
+	// The next login is the same user
+	rec = s.login(t, "Alice", "alice.provider@example.com")
+	if s.loggedInUser(t, rec) != userID {
+		t.Errorf("second login as %q, want %q", s.loggedInUser(t, rec), userID)
+	}
+	users, err := s.h.Users.List(context.Background(), domain.DefaultSiteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("%d users, want 2", len(users))
+	}
+}
+
+func TestSSOAutoProvisionNeedsOpenSignup(t *testing.T) {
+	for _, mode := range []string{domain.SignupClosed, domain.SignupInvite} {
+		s := newSSOTest(t, true)
+		config, err := s.h.Configs.GetActive(context.Background(), domain.DefaultSiteID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.ID = uuid.NewString()
+		config.SignupMode = mode
+		if err := s.h.Configs.Save(context.Background(), config); err != nil {
+			t.Fatal(err)
+		}
+
+		expectMessage(t, s.login(t, "alice", ""), http.StatusForbidden, "error.signup_disabled")
+		users, err := s.h.Users.List(context.Background(), domain.DefaultSiteID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 0 {
+			t.Errorf("signup %s: provisioned %+v", mode, users)
+		}
+	}
+}
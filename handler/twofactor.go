@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/totp"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// twoFactorLoginDuration is how long users have to enter their code after
+	// their password.
+	twoFactorLoginDuration = 5 * time.Minute
+	recoveryCodeCount      = 10
+)
+
+// startTwoFactorLogin remembers, in a short lived cookie, that the user
+// entered the right password, and asks for their code.
+func (h *Handler) startTwoFactorLogin(c echo.Context, user domain.User) error {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["userID"] = user.ID
+	claims["siteID"] = user.SiteID
+	claims["purpose"] = "two_factor"
+	expires := time.Now().Add(twoFactorLoginDuration)
+	claims["expiration"] = expires.Unix()
+	signedData, err := token.SignedString([]byte(h.JWTSecret))
+	if err != nil {
+		return err
+	}
+	c.SetCookie(h.newCookie("TwoFactor", signedData, expires))
+	return c.Redirect(http.StatusFound, "/login/2fa")
+}
+
+// twoFactorLoginUser returns the user that entered the right password and
+// has to enter their code.
+func (h *Handler) twoFactorLoginUser(c echo.Context) (domain.User, bool) {
+	cookie, err := c.Cookie("TwoFactor")
+	if err != nil {
+		return domain.User{}, false
+	}
+	claims, ok := h.parseToken(cookie.Value)
+	if !ok || claims["purpose"] != "two_factor" || claims["siteID"] != CurrentSite(c).ID {
+		return domain.User{}, false
+	}
+	userID, ok := claims["userID"].(string)
+	if !ok {
+		return domain.User{}, false
+	}
+	user, err := h.Users.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		return domain.User{}, false
+	}
+	return user, true
+}
+
+func (h *Handler) GetTwoFactorLoginForm(c echo.Context) error {
+	if _, ok := h.twoFactorLoginUser(c); !ok {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	return c.Render(http.StatusOK, "user-login-2fa.html", nil)
+}
+
+// TwoFactorLogin is the second login step, after the password, for users
+// with two-factor authentication. It takes either a code of their
+// authenticator app or one of their recovery codes.
+func (h *Handler) TwoFactorLogin(c echo.Context) error {
+	user, ok := h.twoFactorLoginUser(c)
+	if !ok {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	if err := h.checkLoginAllowed(c, user.Username); err != nil {
+		return loginError(c, err)
+	}
+	twoFactor, err := h.TwoFactor.Get(c.Request().Context(), user.ID)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && !twoFactor.Enabled()) {
+		// An admin turned it off since the password was checked, so the
+		// login starts over
+		c.SetCookie(h.newCookie("TwoFactor", "", time.Now().Add(-1*time.Second)))
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	if err != nil {
+		return err
+	}
+	ok, err = h.checkTwoFactorCode(c, twoFactor, c.FormValue("code"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		err := h.recordLoginFailure(c, user.Username, user.ID)
+		if errors.Is(err, errLoginFailed) {
+			return c.HTML(http.StatusBadRequest, T(c, "twofactor.error.wrong_code"))
+		}
+		return loginError(c, err)
+	}
+
+	c.SetCookie(h.newCookie("TwoFactor", "", time.Now().Add(-1*time.Second)))
+	err = h.finishLogin(c, user)
+	if err != nil {
+		return loginError(c, err)
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
+
+// checkTwoFactorCode reports if code is a valid code of the authenticator app
+// or an unused recovery code. Either is only accepted once.
+func (h *Handler) checkTwoFactorCode(c echo.Context, twoFactor domain.TwoFactor, code string) (bool, error) {
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+	var err error
+	if ok {
+		err = h.TwoFactor.UseStep(c.Request().Context(), twoFactor.UserID, step)
+	} else {
+		err = h.TwoFactor.UseRecoveryCode(c.Request().Context(), twoFactor.UserID, domain.HashToken(normalizeRecoveryCode(code)))
+	}
+	if errors.Is(err, domain.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// newRecoveryCodes returns fresh recovery codes, formatted to be shown to the
+// user, and their hashes to be stored.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := []string{}
+	hashes := []string{}
+	for range recoveryCodeCount {
+		code, err := randomToken(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, domain.HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+type TwoFactorDTO struct {
+	Enabled        bool
+	RemainingCodes int
+	// QRCode and Secret set up the authenticator app while enrolling.
+	QRCode template.HTML
+	Secret string
+	// RecoveryCodes are only shown right after generating them.
+	RecoveryCodes []string
+	// Error is the message key of the last error
+	Error string
+}
+
+// GetTwoFactorForm shows the two-factor authentication status of the user,
+// or the QR code to enroll their authenticator app.
+func (h *Handler) GetTwoFactorForm(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	return h.renderTwoFactorForm(c, userID, nil, "")
+}
+
+func (h *Handler) renderTwoFactorForm(c echo.Context, userID string, recoveryCodes []string, errorMessage string) error {
+	ctx := c.Request().Context()
+	user, err := h.Users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	twoFactor, err := h.TwoFactor.Get(ctx, userID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+
+	dto := TwoFactorDTO{
+		Enabled:       twoFactor.Enabled(),
+		RecoveryCodes: recoveryCodes,
+		Error:         errorMessage,
+	}
+	if twoFactor.Enabled() {
+		dto.RemainingCodes, err = h.TwoFactor.CountRecoveryCodes(ctx, userID)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Pending secrets are kept, so reloading the page does not invalidate
+		// an already scanned QR code
+		if twoFactor.Secret == "" {
+			twoFactor.UserID = userID
+			twoFactor.Secret, err = totp.GenerateSecret()
+			if err != nil {
+				return err
+			}
+			if err := h.TwoFactor.SavePending(ctx, twoFactor); err != nil {
+				return err
+			}
+		}
+		config, err := h.Configs.GetActive(ctx, CurrentSite(c).ID)
+		if err != nil {
+			return err
+		}
+		svg, err := totp.QRCodeSVG(totp.URI(config.Title, user.Username, twoFactor.Secret))
+		if err != nil {
+			return err
+		}
+		dto.QRCode = template.HTML(svg)
+		dto.Secret = twoFactor.Secret
+	}
+	return c.Render(http.StatusOK, "user-2fa.html", dto)
+}
+
+// EnableTwoFactor turns two-factor authentication on once the user enters a
+// code of the authenticator app they enrolled, and shows their recovery codes.
+func (h *Handler) EnableTwoFactor(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	twoFactor, err := h.TwoFactor.Get(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+	if twoFactor.Enabled() {
+		return c.Redirect(http.StatusFound, "/settings/2fa")
+	}
+	step, ok := totp.Validate(twoFactor.Secret, c.FormValue("code"), time.Now())
+	if !ok {
+		return h.renderTwoFactorForm(c, userID, nil, "twofactor.error.wrong_code")
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	err = h.TwoFactor.Enable(c.Request().Context(), userID, hashes)
+	if err != nil {
+		return err
+	}
+	err = h.TwoFactor.UseStep(c.Request().Context(), userID, step)
+	if err != nil {
+		return err
+	}
+	return h.renderTwoFactorForm(c, userID, codes, "")
+}
+
+// checkTwoFactorPassword checks the current password of the form to change
+// the two-factor authentication of the user. It renders the form with the
+// error and returns false if the password is not right.
+func (h *Handler) checkTwoFactorPassword(c echo.Context, userID string) (bool, error) {
+	user, err := h.Users.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		return false, err
+	}
+	if err := h.checkCurrentPassword(c, user); err != nil {
+		message, ok := currentPasswordMessage(err)
+		if !ok {
+			return false, err
+		}
+		return false, h.renderTwoFactorForm(c, userID, nil, message)
+	}
+	return true, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking the
+// password.
+func (h *Handler) DisableTwoFactor(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	ok, err := h.checkTwoFactorPassword(c, userID)
+	if !ok {
+		return err
+	}
+	err = h.TwoFactor.Delete(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/settings/2fa")
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking the
+// password, and shows the new ones.
+func (h *Handler) RegenerateRecoveryCodes(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	ok, err := h.checkTwoFactorPassword(c, userID)
+	if !ok {
+		return err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	err = h.TwoFactor.ReplaceRecoveryCodes(c.Request().Context(), userID, hashes)
+	if err != nil {
+		return err
+	}
+	return h.renderTwoFactorForm(c, userID, codes, "")
+}
+
+// ResetTwoFactor lets the admin turn off two-factor authentication for a
+// user that lost their authenticator app and recovery codes.
+func (h *Handler) ResetTwoFactor(c echo.Context) error {
+	user, err := h.Users.GetByUsername(c.Request().Context(), CurrentSite(c).ID, c.FormValue("username"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	err = h.TwoFactor.Delete(c.Request().Context(), user.ID)
+	if err != nil {
+		return err
+	}
+	err = h.addLoginEvent(c, user.Username, user.ID, domain.LoginEventTwoFactorReset)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/lockouts")
+}
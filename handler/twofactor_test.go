@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/totp"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enableTestTwoFactor turns two-factor authentication on for the user and
+// returns its secret and recovery codes.
+func enableTestTwoFactor(t *testing.T, h *Handler, user domain.User) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.TwoFactor.SavePending(ctx, domain.TwoFactor{UserID: user.ID, Secret: secret}); err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.TwoFactor.Enable(ctx, user.ID, hashes); err != nil {
+		t.Fatal(err)
+	}
+	return secret, codes
+}
+
+// twoFactorCookie returns the cookie of a user that entered the right
+// password and has to enter their code.
+func twoFactorCookie(t *testing.T, h *Handler, user domain.User) *http.Cookie {
+	t.Helper()
+	c, rec := newTestContext(http.MethodPost, "/login", url.Values{})
+	if err := h.startTwoFactorLogin(c, user); err != nil {
+		t.Fatal(err)
+	}
+	cookie := responseCookie(rec, "TwoFactor")
+	if cookie == nil {
+		t.Fatal("no TwoFactor cookie")
+	}
+	return cookie
+}
+
+// twoFactorLogin posts code to the second login step from ip.
+func twoFactorLogin(t *testing.T, h *Handler, cookie *http.Cookie, ip string, code string) (int, string) {
+	t.Helper()
+	c, rec := newTestContext(http.MethodPost, "/login/2fa", url.Values{"code": {code}}, cookie)
+	c.Request().RemoteAddr = ip + ":1234"
+	if err := h.TwoFactorLogin(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code == http.StatusFound && responseCookie(rec, "Authorization") == nil {
+		t.Fatal("logged in without an Authorization cookie")
+	}
+	return rec.Code, rec.Body.String()
+}
+
+func TestTwoFactorLoginRejectsReplayedCode(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	secret, _ := enableTestTwoFactor(t, h, user)
+	cookie := twoFactorCookie(t, h, user)
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := twoFactorLogin(t, h, cookie, "192.0.2.1", code); status != http.StatusFound {
+		t.Fatalf("first use of the code: status %d, %s", status, body)
+	}
+	if status, _ := twoFactorLogin(t, h, cookie, "192.0.2.1", code); status != http.StatusBadRequest {
+		t.Errorf("replayed code: status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// Codes of earlier steps are not accepted either, even within the skew
+	earlier, err := totp.Code(secret, totp.Step(time.Now())-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := twoFactorLogin(t, h, cookie, "192.0.2.1", earlier); status != http.StatusBadRequest {
+		t.Errorf("code of an earlier step: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestTwoFactorLoginRecoveryCodeIsSingleUse(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	_, codes := enableTestTwoFactor(t, h, user)
+	cookie := twoFactorCookie(t, h, user)
+
+	// Recovery codes are accepted however they are typed
+	typed := " " + strings.ToUpper(codes[3]) + " "
+	if status, body := twoFactorLogin(t, h, cookie, "192.0.2.1", typed); status != http.StatusFound {
+		t.Fatalf("first use of the recovery code: status %d, %s", status, body)
+	}
+	if status, _ := twoFactorLogin(t, h, cookie, "192.0.2.1", codes[3]); status != http.StatusBadRequest {
+		t.Errorf("reused recovery code: status %d, want %d", status, http.StatusBadRequest)
+	}
+	remaining, err := h.TwoFactor.CountRecoveryCodes(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != recoveryCodeCount-1 {
+		t.Errorf("remaining recovery codes = %d, want %d", remaining, recoveryCodeCount-1)
+	}
+	if status, body := twoFactorLogin(t, h, cookie, "192.0.2.1", codes[4]); status != http.StatusFound {
+		t.Errorf("another recovery code: status %d, %s", status, body)
+	}
+}
+
+func TestTwoFactorLoginLocksOutAfterWrongCodes(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	secret, codes := enableTestTwoFactor(t, h, user)
+	cookie := twoFactorCookie(t, h, user)
+
+	// Every attempt comes from another IP address, so only the username
+	// lockout applies
+	for i := range maxLoginFailures {
+		status, _ := twoFactorLogin(t, h, cookie, fmt.Sprintf("192.0.2.%d", i+1), "000000")
+		if status != http.StatusBadRequest {
+			t.Fatalf("wrong code %d: status %d, want %d", i+1, status, http.StatusBadRequest)
+		}
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := twoFactorLogin(t, h, cookie, "198.51.100.1", code); status != http.StatusTooManyRequests {
+		t.Errorf("right code after the lockout: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+	if status, _ := twoFactorLogin(t, h, cookie, "198.51.100.1", codes[0]); status != http.StatusTooManyRequests {
+		t.Errorf("recovery code after the lockout: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+	failure, err := h.Logins.GetFailures(context.Background(), domain.DefaultSiteID, user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !failure.Locked(time.Now()) {
+		t.Error("the username is not locked out")
+	}
+}
+
+func TestEnableTwoFactorUsesTheStep(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.TwoFactor.SavePending(context.Background(), domain.TwoFactor{UserID: user.ID, Secret: secret}); err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, rec := newTestContext(http.MethodPost, "/settings/2fa", url.Values{"code": {code}}, sessionCookie(t, h, user))
+	if err := h.EnableTwoFactor(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enabling: status %d", rec.Code)
+	}
+
+	// The code that enabled it cannot log in too
+	cookie := twoFactorCookie(t, h, user)
+	if status, _ := twoFactorLogin(t, h, cookie, "192.0.2.1", code); status != http.StatusBadRequest {
+		t.Errorf("code used to enable: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestTwoFactorLoginAfterReset(t *testing.T) {
+	h := newTestHandler(t)
+	user := createTestUser(t, h, "alice", "password")
+	secret, _ := enableTestTwoFactor(t, h, user)
+	cookie := twoFactorCookie(t, h, user)
+	if err := h.TwoFactor.Delete(context.Background(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, rec := newTestContext(http.MethodPost, "/login/2fa", url.Values{"code": {code}}, cookie)
+	if err := h.TwoFactorLogin(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login" {
+		t.Errorf("status %d to %q, want %d to /login", rec.Code, rec.Header().Get("Location"), http.StatusFound)
+	}
+	if cookie := responseCookie(rec, "TwoFactor"); cookie == nil || cookie.Value != "" || cookie.Expires.After(time.Now()) {
+		t.Errorf("the TwoFactor cookie was not cleared: %+v", cookie)
+	}
+	if responseCookie(rec, "Authorization") != nil {
+		t.Error("logged in")
+	}
+}
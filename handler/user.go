@@ -2,13 +2,11 @@ package handler
 
 import (
 	"backyard/domain"
-	"database/sql"
 	"errors"
-	"fmt"
+	"html/template"
 	"net/http"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -20,127 +18,221 @@ func (h *Handler) Login(c echo.Context) error {
 	formPassword := c.FormValue("password")
 
 	if len(formUsername) == 0 || len(formPassword) == 0 {
-		return c.HTML(http.StatusBadRequest, "Bad request")
+		return c.HTML(http.StatusBadRequest, T(c, "error.bad_request"))
 	}
 
-	user := new(domain.User)
-	user.Username = formUsername
-
-	row := h.DB.QueryRow("select user_id, password, email from users where username = $1", user.Username)
-	if row.Err() != nil {
-		fmt.Println(row.Err().Error())
-		return c.HTML(http.StatusInternalServerError, "Internal server error")
-	}
-
-	var storedPassword string
-	err := row.Scan(&user.ID, &storedPassword, &user.Email)
+	user, err := h.checkPassword(c, formUsername, formPassword)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.HTML(http.StatusBadRequest, "Wrong username or password")
-		}
-		return c.HTML(http.StatusInternalServerError, "Internal server error")
+		return loginError(c, err)
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(formPassword))
-	if err != nil {
+	if user.SuspendedAt != nil {
+		return loginError(c, errAccountSuspended)
+	}
+	if user.PasswordResetRequired {
+		return loginError(c, errPasswordResetRequired)
+	}
+	twoFactor, err := h.TwoFactor.Get(c.Request().Context(), user.ID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
 		return err
 	}
-	if err != nil {
-		return c.HTML(http.StatusBadRequest, "Invalid credentials")
+	if twoFactor.Enabled() {
+		return h.startTwoFactorLogin(c, user)
 	}
-	cookie, err := authorizationCookie(user.ID, h.JWTSecret)
+	err = h.finishLogin(c, user)
 	if err != nil {
-		return err
+		return loginError(c, err)
 	}
-
-	c.SetCookie(cookie)
 	return c.Redirect(http.StatusFound, "/")
 
 }
+
+// signupDisabled renders the response for a sign-up to a closed site.
+func signupDisabled(c echo.Context) error {
+	return c.HTML(http.StatusForbidden, "<h1>"+template.HTMLEscapeString(T(c, "error.forbidden"))+"</h1><p>"+template.HTMLEscapeString(T(c, "error.signup_disabled"))+"</p>")
+}
+
 func (h *Handler) NewUser(c echo.Context) error {
-	if h.Environment != "dev" && !h.EnableSignup {
-		return c.HTML(http.StatusForbidden, "<h1>Forbidden!</h1><p>Sign up has been disabled.</p>")
+	site := CurrentSite(c)
+	config, err := h.Configs.GetActive(c.Request().Context(), site.ID)
+	if err != nil {
+		return err
+	}
+	mode := h.signupMode(c, config)
+	if mode == domain.SignupClosed {
+		return signupDisabled(c)
+	}
+	// Invite codes are optional on open sites, but still record who invited whom
+	inviteCode := c.FormValue("invite")
+	if mode == domain.SignupInvite || inviteCode != "" {
+		message, err := h.checkInvite(c, inviteCode)
+		if err != nil {
+			return err
+		}
+		if message != "" {
+			return renderMessage(c, http.StatusForbidden, "signup.title", message)
+		}
 	}
 
 	user := domain.User{
 		ID:       uuid.NewString(),
+		SiteID:   site.ID,
 		Username: c.FormValue("username"),
 	}
 
-	row := h.DB.QueryRow("SELECT COUNT(username) as count FROM users WHERE username = $1", user.Username)
-	if row.Err() != nil {
-		panic(row.Err().Error())
+	if !usernamePattern.MatchString(user.Username) {
+		return c.HTML(http.StatusBadRequest, T(c, "error.username_invalid"))
 	}
-
-	var count int
-	row.Scan(&count)
-	if count != 0 {
-		return c.HTML(http.StatusConflict, "Username already taken")
+	if h.usernameReserved(user.Username) {
+		return c.HTML(http.StatusConflict, T(c, "error.username_reserved"))
 	}
-
-	password := c.FormValue("password")
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	taken, err := h.Users.UsernameExists(c.Request().Context(), site.ID, user.Username)
 	if err != nil {
 		return err
 	}
+	if taken {
+		return c.HTML(http.StatusConflict, T(c, "error.username_taken"))
+	}
 
-	result, err := h.DB.Exec("insert into users (user_id, username, password, created_at, updated_at) values ($1, $2, $3, $4, $5)", user.ID, user.Username, hashedPassword, time.Now().UTC(), time.Now().UTC())
+	addr, err := normalizeEmail(c.FormValue("email"))
+	if err != nil {
+		return c.HTML(http.StatusBadRequest, T(c, "error.invalid_email"))
+	}
+	taken, err = h.Users.EmailExists(c.Request().Context(), site.ID, addr)
 	if err != nil {
 		return err
 	}
+	if taken {
+		return c.HTML(http.StatusConflict, T(c, "error.email_taken"))
+	}
+	user.Email = &addr
 
-	affected, err := result.RowsAffected()
+	password := c.FormValue("password")
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
-	if affected == 0 {
-		return c.HTML(http.StatusInternalServerError, "User not created")
+	user.Password = string(hashedPassword)
+
+	err = h.Users.SignUp(c.Request().Context(), domain.SignUp{User: user, Role: domain.RoleDefault, InviteCode: inviteCode}, time.Now())
+	if errors.Is(err, domain.ErrNotFound) {
+		return renderMessage(c, http.StatusForbidden, "signup.title", "invites.error.invalid")
 	}
+	if err != nil {
+		return err
+	}
+
+	h.userSignedUp(c, user)
 
-	cookie, err := authorizationCookie(user.ID, h.JWTSecret)
+	err = h.startSession(c, user)
 	if err != nil {
 		return err
 	}
 
-	c.SetCookie(cookie)
+	// The account works without a verified email, so a mail server hiccup
+	// does not fail the sign-up
+	if err := h.sendVerificationEmail(c, user); err != nil {
+		LogError(c, err)
+	}
 
 	return c.Redirect(http.StatusFound, "/")
 }
 func (h *Handler) Logout(c echo.Context) error {
-	cookie := new(http.Cookie)
-	cookie.Name = "Authorization"
-	cookie.Value = ""
-	cookie.Path = "/"
-
-	cookie.Expires = time.Now().Add(-1 * time.Second)
-	c.SetCookie(cookie)
+	if session, ok := h.currentSession(c); ok {
+		err := h.Sessions.Revoke(c.Request().Context(), session.SiteID, session.UserID, session.ID)
+		if err != nil {
+			return err
+		}
+	}
+	h.clearAuthorizationCookie(c)
 	return c.Redirect(http.StatusFound, "/")
 }
+
+// GetNewUserForm shows the sign-up form. On invite-only sites it is only
+// shown with a usable invite code in the invite query parameter.
 func (h *Handler) GetNewUserForm(c echo.Context) error {
-	return c.Render(http.StatusOK, "user-signup.html", nil)
+	config, err := h.Configs.GetActive(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	mode := h.signupMode(c, config)
+	if mode == domain.SignupClosed {
+		return signupDisabled(c)
+	}
+	inviteCode := c.QueryParam("invite")
+	if mode == domain.SignupInvite || inviteCode != "" {
+		message, err := h.checkInvite(c, inviteCode)
+		if err != nil {
+			return err
+		}
+		if message != "" {
+			return renderMessage(c, http.StatusForbidden, "signup.title", message)
+		}
+	}
+	return c.Render(http.StatusOK, "user-signup.html", struct {
+		Invite string
+	}{
+		Invite: inviteCode,
+	})
 }
 func (h *Handler) GetLoginForm(c echo.Context) error {
-	return c.Render(http.StatusOK, "user-login.html", nil)
+	ssoName := ""
+	if h.SSO != nil {
+		ssoName = h.SSO.Config.Name
+	}
+	return c.Render(http.StatusOK, "user-login.html", struct {
+		SSO string
+	}{
+		SSO: ssoName,
+	})
 }
 
-func authorizationCookie(ID string, secret string) (*http.Cookie, error) {
-	if secret == "" {
-		return nil, errors.New("missing secret")
+// GetUserProfile lists the posts of a user.
+func (h *Handler) GetUserProfile(c echo.Context) error {
+	user, err := h.Users.GetByUsername(c.Request().Context(), CurrentSite(c).ID, c.Param("username"))
+	if errors.Is(err, domain.ErrNotFound) {
+		// Links to renamed users keep working until someone takes the name
+		renamed, err := h.Users.GetByPreviousUsername(c.Request().Context(), CurrentSite(c).ID, c.Param("username"))
+		if errors.Is(err, domain.ErrNotFound) {
+			return echo.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return c.Redirect(http.StatusMovedPermanently, "/"+renamed.Username)
 	}
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["userID"] = ID
-	exp := time.Now().Add(time.Hour * 24 * 7)
-	claims["expiration"] = exp.Unix()
-	signedData, err := token.SignedString([]byte(secret))
 	if err != nil {
-		return nil, err
+		return err
 	}
+	if ownerID := domainUserID(c); ownerID != "" && ownerID != user.ID {
+		return echo.ErrNotFound
+	}
+	return h.renderProfile(c, user)
+}
 
-	cookie := new(http.Cookie)
-	cookie.Name = "Authorization"
-	cookie.Value = signedData
-	cookie.Expires = exp
-	cookie.Path = "/"
-
-	return cookie, nil
+func (h *Handler) renderProfile(c echo.Context, user domain.User) error {
+	// Drafts are only listed to their author
+	viewerID := h.getUserID(c)
+	dbPosts, err := h.Posts.ListByAuthor(c.Request().Context(), CurrentSite(c).ID, user.ID, viewerID == user.ID)
+	if err != nil {
+		return err
+	}
+	posts := []PostDTO{}
+	for _, p := range dbPosts {
+		posts = append(posts, newPostDTO(p))
+	}
+	canonical := h.canonicalURL(c, user.ID, "/")
+	if domainUserID(c) == "" && canonical == "" {
+		canonical = c.Scheme() + "://" + c.Request().Host + "/" + user.Username
+	}
+	return c.Render(http.StatusOK, "user-profile.html", struct {
+		Username  string
+		Posts     []PostDTO
+		LoggedIn  bool
+		Canonical string
+	}{
+		Username:  user.Username,
+		Posts:     posts,
+		LoggedIn:  viewerID != "",
+		Canonical: canonical,
+	})
 }
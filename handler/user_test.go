@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"backyard/domain"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSignUpWithInvite(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "password")
+	ctx := context.Background()
+	invite := domain.Invite{
+		Code:      "welcome",
+		SiteID:    domain.DefaultSiteID,
+		CreatedBy: alice.ID,
+		MaxUses:   1,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := h.Invites.Create(ctx, invite); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"username": {"bob"}, "email": {"bob@example.com"}, "password": {"password"}, "invite": {invite.Code}}
+	c, rec := newTestContext(http.MethodPost, "/signup", form)
+	if err := h.NewUser(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusFound {
+		t.Fatalf("signing up: status %d", rec.Code)
+	}
+	bob, err := h.Users.GetByUsername(ctx, domain.DefaultSiteID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles, err := h.Roles.ListByUser(ctx, bob.ID)
+	if err != nil || len(roles) != 1 || roles[0].Name != domain.RoleDefault {
+		t.Errorf("roles of bob: %+v, %v", roles, err)
+	}
+	invitees, err := h.Invites.ListInvitees(ctx, domain.DefaultSiteID)
+	if err != nil || len(invitees) != 1 || invitees[0].UserID != bob.ID || invitees[0].InviterID != alice.ID {
+		t.Errorf("invitees: %+v, %v", invitees, err)
+	}
+
+	// Like someone else signing up with the code between its check and its use
+	carol := domain.User{ID: uuid.NewString(), SiteID: domain.DefaultSiteID, Username: "carol"}
+	err = h.Users.SignUp(ctx, domain.SignUp{User: carol, Role: domain.RoleDefault, InviteCode: invite.Code}, time.Now())
+	if !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("signing up with a used up invite: %v, want %v", err, domain.ErrNotFound)
+	}
+	if _, err := h.Users.GetByID(ctx, carol.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("user created with a used up invite: %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"backyard/domain"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AdminUserDTO struct {
+	ID            string
+	Username      string
+	Email         string
+	EmailVerified bool
+	Roles         []string
+	Posts         int
+	CreatedAt     time.Time
+	LastLoginAt   *time.Time
+	Suspended     bool
+	// PasswordResetRequired is set until the user chooses a new password.
+	PasswordResetRequired bool
+	Self                  bool
+}
+
+// GetUsers lists the users of the site to the admin, with their activity.
+// They can be searched by username or email, and filtered by status and role.
+func (h *Handler) GetUsers(c echo.Context) error {
+	return h.renderUsers(c, "")
+}
+
+func (h *Handler) renderUsers(c echo.Context, errorMessage string) error {
+	ctx := c.Request().Context()
+	siteID := CurrentSite(c).ID
+	filter := domain.UserFilter{
+		SiteID: siteID,
+		Query:  c.QueryParam("q"),
+		Status: c.QueryParam("status"),
+	}
+	role := c.QueryParam("role")
+
+	users, err := h.Users.Search(ctx, filter)
+	if err != nil {
+		return err
+	}
+	roles, err := h.Roles.List(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	roleNames := map[string]string{}
+	for _, r := range roles {
+		roleNames[r.ID] = r.Name
+	}
+	userRoles, err := h.Roles.ListUserRoles(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	posts, err := h.Posts.CountByAuthor(ctx, siteID, true)
+	if err != nil {
+		return err
+	}
+	lastLogins, err := h.Logins.LastLogins(ctx, siteID)
+	if err != nil {
+		return err
+	}
+
+	dtos := []AdminUserDTO{}
+	for _, u := range users {
+		names := []string{}
+		for _, id := range userRoles[u.ID] {
+			names = append(names, roleNames[id])
+		}
+		if role != "" && !slices.Contains(names, role) {
+			continue
+		}
+		dto := AdminUserDTO{
+			ID:                    u.ID,
+			Username:              u.Username,
+			EmailVerified:         u.EmailVerifiedAt != nil,
+			Roles:                 names,
+			Posts:                 posts[u.ID],
+			CreatedAt:             u.CreatedAt,
+			Suspended:             u.SuspendedAt != nil,
+			PasswordResetRequired: u.PasswordResetRequired,
+			Self:                  u.ID == h.getUserID(c),
+		}
+		if u.Email != nil {
+			dto.Email = *u.Email
+		}
+		if at, ok := lastLogins[u.ID]; ok {
+			dto.LastLoginAt = &at
+		}
+		dtos = append(dtos, dto)
+	}
+
+	status := http.StatusOK
+	if errorMessage != "" {
+		status = http.StatusBadRequest
+	}
+	return c.Render(status, "admin-users.html", struct {
+		Users  []AdminUserDTO
+		Roles  []domain.Role
+		Query  string
+		Status string
+		Role   string
+		Error  string
+	}{
+		Users:  dtos,
+		Roles:  roles,
+		Query:  filter.Query,
+		Status: filter.Status,
+		Role:   role,
+		Error:  errorMessage,
+	})
+}
+
+// managedUser checks the lookup of the user an admin action is about, which
+// must be a user of the site. Admins cannot act on themselves, so they do not
+// lock themselves out by mistake.
+func (h *Handler) managedUser(c echo.Context, user domain.User, err error) (domain.User, string, error) {
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && user.SiteID != CurrentSite(c).ID) {
+		return domain.User{}, "", echo.ErrNotFound
+	}
+	if err != nil {
+		return domain.User{}, "", err
+	}
+	if user.ID == h.getUserID(c) {
+		return domain.User{}, "users.error.self", nil
+	}
+	return user, "", nil
+}
+
+// SuspendUser keeps a user from logging in, and logs them out everywhere.
+func (h *Handler) SuspendUser(c echo.Context) error {
+	user, err := h.Users.GetByID(c.Request().Context(), c.Param("id"))
+	user, errorMessage, err := h.managedUser(c, user, err)
+	if err != nil {
+		return err
+	}
+	if errorMessage != "" {
+		return h.renderUsers(c, errorMessage)
+	}
+	now := time.Now()
+	err = h.Users.SetSuspended(c.Request().Context(), user.ID, &now)
+	if err != nil {
+		return err
+	}
+	err = h.Sessions.RevokeAll(c.Request().Context(), user.SiteID, user.ID, "")
+	if err != nil {
+		return err
+	}
+	err = h.addLoginEvent(c, user.Username, user.ID, domain.LoginEventSuspend)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+// UnsuspendUser lets a suspended user log in again.
+func (h *Handler) UnsuspendUser(c echo.Context) error {
+	user, err := h.Users.GetByID(c.Request().Context(), c.Param("id"))
+	user, errorMessage, err := h.managedUser(c, user, err)
+	if err != nil {
+		return err
+	}
+	if errorMessage != "" {
+		return h.renderUsers(c, errorMessage)
+	}
+	err = h.Users.SetSuspended(c.Request().Context(), user.ID, nil)
+	if err != nil {
+		return err
+	}
+	err = h.addLoginEvent(c, user.Username, user.ID, domain.LoginEventUnsuspend)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+// ForcePasswordReset stops the password of a user from working until they
+// choose a new one, and logs them out everywhere. Users with a verified email
+// are sent a link to choose it, the others have to ask for one.
+func (h *Handler) ForcePasswordReset(c echo.Context) error {
+	user, err := h.Users.GetByID(c.Request().Context(), c.Param("id"))
+	user, errorMessage, err := h.managedUser(c, user, err)
+	if err != nil {
+		return err
+	}
+	if errorMessage != "" {
+		return h.renderUsers(c, errorMessage)
+	}
+	err = h.Users.SetPasswordResetRequired(c.Request().Context(), user.ID, true)
+	if err != nil {
+		return err
+	}
+	err = h.Sessions.RevokeAll(c.Request().Context(), user.SiteID, user.ID, "")
+	if err != nil {
+		return err
+	}
+	if user.Email != nil && user.EmailVerifiedAt != nil {
+		token, err := h.newUserToken(c.Request().Context(), user, domain.TokenResetPassword, *user.Email, resetPasswordTokenDuration)
+		if err != nil {
+			return err
+		}
+		err = h.sendEmail(h.mailContext(c), user, "reset-password", *user.Email, h.siteURL(c)+"/password/reset?token="+token)
+		if err != nil {
+			return err
+		}
+	}
+	err = h.addLoginEvent(c, user.Username, user.ID, domain.LoginEventPasswordReset)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+// GetDeleteUserForm asks the admin to confirm deleting a user, and what to
+// do with their posts.
+func (h *Handler) GetDeleteUserForm(c echo.Context) error {
+	user, err := h.Users.GetByID(c.Request().Context(), c.Param("id"))
+	user, errorMessage, err := h.managedUser(c, user, err)
+	if err != nil {
+		return err
+	}
+	if errorMessage != "" {
+		return h.renderUsers(c, errorMessage)
+	}
+	users, err := h.Users.List(c.Request().Context(), user.SiteID)
+	if err != nil {
+		return err
+	}
+	others := []string{}
+	for _, u := range users {
+		if u.ID != user.ID {
+			others = append(others, u.Username)
+		}
+	}
+	posts, err := h.Posts.CountByAuthor(c.Request().Context(), user.SiteID, true)
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "admin-user-delete.html", struct {
+		Username string
+		Posts    int
+		Others   []string
+		// Self is the username of the admin, preselected to take the posts.
+		Self string
+	}{
+		Username: user.Username,
+		Posts:    posts[user.ID],
+		Others:   others,
+		Self:     h.currentUsername(c),
+	})
+}
+
+// DeleteUser deletes a user with everything that is only theirs. Their posts
+// and images are deleted too, or given to another user if the posts form
+// value is "reassign". Users deleting their own account are sent to
+// deleteAccount instead, everyone else needs to be allowed to manage users.
+func (h *Handler) DeleteUser(c echo.Context) error {
+	if h.getUserID(c) == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	current, own, err := h.settingsUser(c)
+	if err != nil {
+		return err
+	}
+	if own {
+		return h.deleteAccount(c, current)
+	}
+	allowed, err := h.can(c, domain.PermissionManageUsers)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return renderMessage(c, http.StatusForbidden, "error.forbidden", "roles.error.forbidden")
+	}
+
+	ctx := c.Request().Context()
+	siteID := CurrentSite(c).ID
+	user, err := h.Users.GetByUsername(ctx, siteID, c.Param("username"))
+	user, errorMessage, err := h.managedUser(c, user, err)
+	if err != nil {
+		return err
+	}
+	if errorMessage != "" {
+		return h.renderUsers(c, errorMessage)
+	}
+
+	reassignTo := ""
+	switch c.FormValue("posts") {
+	case "reassign":
+		to, err := h.Users.GetByUsername(ctx, siteID, c.FormValue("to"))
+		if errors.Is(err, domain.ErrNotFound) || (err == nil && to.ID == user.ID) {
+			return h.renderUsers(c, "users.error.reassign")
+		}
+		if err != nil {
+			return err
+		}
+		reassignTo = to.ID
+	case "delete":
+	default:
+		return c.HTML(http.StatusBadRequest, T(c, "error.bad_request"))
+	}
+
+	err = h.removeUser(c, user, reassignTo)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+// removeUser deletes the user, giving their posts and images to reassignTo or
+// deleting them too if it is empty. The deleted posts trigger their webhooks
+// like when deleted one by one.
+func (h *Handler) removeUser(c echo.Context, user domain.User, reassignTo string) error {
+	ctx := c.Request().Context()
+	posts := []domain.Post{}
+	if reassignTo == "" {
+		var err error
+		posts, err = h.Posts.ListByAuthor(ctx, user.SiteID, user.ID, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := h.addLoginEvent(c, user.Username, user.ID, domain.LoginEventDelete)
+	if err != nil {
+		return err
+	}
+	err = h.Users.Delete(ctx, user.ID, reassignTo)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		h.postChanged(c, p, domain.Post{})
+	}
+	return nil
+}
+
+// currentUsername returns the username of the logged in user, or an empty
+// string.
+func (h *Handler) currentUsername(c echo.Context) string {
+	user, err := h.Users.GetByID(c.Request().Context(), h.getUserID(c))
+	if err != nil {
+		return ""
+	}
+	return user.Username
+}
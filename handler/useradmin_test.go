@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"backyard/domain"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestContent adds a post and an image of the user.
+func createTestContent(t *testing.T, h *Handler, user domain.User) (domain.Post, domain.Image) {
+	t.Helper()
+	post := domain.Post{
+		ID:      uuid.NewString(),
+		SiteID:  user.SiteID,
+		Title:   "Post of " + user.Username,
+		Content: "Hello",
+		Access:  domain.Access{UserID: user.ID, Relation: domain.RelationAuthor},
+	}
+	if err := h.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	image := domain.Image{ID: uuid.NewString(), SiteID: user.SiteID, UserID: user.ID, Filename: "a.png", ContentType: "image/png"}
+	if err := h.Images.Create(context.Background(), image); err != nil {
+		t.Fatal(err)
+	}
+	return post, image
+}
+
+// deleteUser posts the form deleting username as admin.
+func deleteUser(t *testing.T, h *Handler, admin domain.User, username string, form url.Values) int {
+	t.Helper()
+	c, rec := newTestContext(http.MethodPost, "/"+username+"/delete", form, sessionCookie(t, h, admin))
+	c.SetParamNames("username")
+	c.SetParamValues(username)
+	if err := h.DeleteUser(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code
+}
+
+func newTestAdmin(t *testing.T, h *Handler) domain.User {
+	t.Helper()
+	admin := createTestUser(t, h, "admin", "password")
+	if err := h.Roles.Assign(context.Background(), domain.DefaultSiteID, admin.ID, domain.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	return admin
+}
+
+func TestDeleteUserReassignsContent(t *testing.T) {
+	h := newTestHandler(t)
+	admin := newTestAdmin(t, h)
+	alice := createTestUser(t, h, "alice", "password")
+	bob := createTestUser(t, h, "bob", "password")
+	post, image := createTestContent(t, h, alice)
+
+	if status := deleteUser(t, h, admin, "alice", url.Values{"posts": {"reassign"}, "to": {"bob"}}); status != http.StatusFound {
+		t.Fatalf("deleting: status %d", status)
+	}
+	ctx := context.Background()
+	if _, err := h.Users.GetByID(ctx, alice.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("alice was not deleted: %v", err)
+	}
+	post, err := h.Posts.GetByID(ctx, domain.DefaultSiteID, post.ID)
+	if err != nil || post.Access.UserID != bob.ID {
+		t.Errorf("post after reassigning: %+v, %v", post.Access, err)
+	}
+	image, err = h.Images.GetByID(ctx, domain.DefaultSiteID, image.ID)
+	if err != nil || image.UserID != bob.ID {
+		t.Errorf("image after reassigning: %q, %v", image.UserID, err)
+	}
+}
+
+func TestDeleteUserDeletesContent(t *testing.T) {
+	h := newTestHandler(t)
+	admin := newTestAdmin(t, h)
+	alice := createTestUser(t, h, "alice", "password")
+	post, image := createTestContent(t, h, alice)
+	createTestPost(t, h, alice, "Draft", true)
+	other, _ := createTestContent(t, h, admin)
+	w := createTestWebhook(t, h)
+
+	// Content cannot be given to the deleted user, nor is it deleted then
+	if status := deleteUser(t, h, admin, "alice", url.Values{"posts": {"reassign"}, "to": {"alice"}}); status != http.StatusBadRequest {
+		t.Fatalf("reassigning to the deleted user: status %d", status)
+	}
+	ctx := context.Background()
+	if _, err := h.Posts.GetByID(ctx, domain.DefaultSiteID, post.ID); err != nil {
+		t.Fatalf("post after a refused deletion: %v", err)
+	}
+
+	if status := deleteUser(t, h, admin, "alice", url.Values{"posts": {"delete"}}); status != http.StatusFound {
+		t.Fatalf("deleting: status %d", status)
+	}
+	if _, err := h.Users.GetByID(ctx, alice.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("alice was not deleted: %v", err)
+	}
+	if _, err := h.Posts.GetByID(ctx, domain.DefaultSiteID, post.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("post of alice was not deleted: %v", err)
+	}
+	if _, err := h.Images.GetByID(ctx, domain.DefaultSiteID, image.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("image of alice was not deleted: %v", err)
+	}
+	if _, err := h.Posts.GetByID(ctx, domain.DefaultSiteID, other.ID); err != nil {
+		t.Errorf("post of someone else: %v", err)
+	}
+	// Only the published post was on the site
+	deliveries, err := h.Webhooks.ListDeliveries(ctx, w.ID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Event != domain.EventPostDeleted || !strings.Contains(string(deliveries[0].Payload), post.ID) {
+		t.Errorf("deliveries after deleting alice: %+v", deliveries)
+	}
+}
+
+func TestDeleteOwnAccount(t *testing.T) {
+	h := newTestHandler(t)
+	newTestAdmin(t, h)
+	alice := createTestUser(t, h, "alice", "password")
+	post, image := createTestContent(t, h, alice)
+
+	if status := deleteUser(t, h, alice, "alice", url.Values{"confirm": {"alice"}}); status != http.StatusFound {
+		t.Fatalf("deleting: status %d", status)
+	}
+	ctx := context.Background()
+	if _, err := h.Users.GetByID(ctx, alice.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("alice was not deleted: %v", err)
+	}
+	if _, err := h.Posts.GetByID(ctx, domain.DefaultSiteID, post.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("post was not deleted: %v", err)
+	}
+	if _, err := h.Images.GetByID(ctx, domain.DefaultSiteID, image.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("image was not deleted: %v", err)
+	}
+}
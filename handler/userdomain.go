@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"backyard/domain"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var domainRegexp = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9-]{2,63}$`)
+
+type UserDomainDTO struct {
+	Domain         string
+	Verified       bool
+	TXTRecordName  string
+	TXTRecordValue string
+	// Error is the message key of the last error
+	Error string
+}
+
+func (h *Handler) GetDomainForm(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	return h.renderDomainForm(c, userID, "")
+}
+
+func (h *Handler) renderDomainForm(c echo.Context, userID string, errorMessage string) error {
+	dto := UserDomainDTO{Error: errorMessage}
+	d, err := h.UserDomains.GetByUser(c.Request().Context(), userID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	if err == nil {
+		dto.Domain = d.Domain
+		dto.Verified = d.Verified()
+		dto.TXTRecordName = d.TXTRecordName()
+		dto.TXTRecordValue = d.TXTRecordValue()
+	}
+	return c.Render(http.StatusOK, "user-domain.html", dto)
+}
+
+// SaveDomain attaches a domain to the logged in user. The domain is not served
+// until its ownership is verified.
+func (h *Handler) SaveDomain(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	formDomain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(c.FormValue("domain"))), ".")
+	if formDomain == "" {
+		err := h.UserDomains.Delete(c.Request().Context(), userID)
+		if err != nil {
+			return err
+		}
+		return c.Redirect(http.StatusFound, "/settings/domain")
+	}
+	if !domainRegexp.MatchString(formDomain) {
+		return h.renderDomainForm(c, userID, "domain.error.invalid")
+	}
+	if _, err := h.Sites.GetByHostname(c.Request().Context(), formDomain); err == nil {
+		return h.renderDomainForm(c, userID, "domain.error.in_use")
+	}
+
+	token, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	err = h.UserDomains.Save(c.Request().Context(), domain.UserDomain{
+		Domain: formDomain,
+		UserID: userID,
+		SiteID: CurrentSite(c).ID,
+		Token:  token,
+	})
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/settings/domain")
+}
+
+// VerifyDomain checks the DNS TXT record of the user domain and starts serving
+// the domain when it is found.
+func (h *Handler) VerifyDomain(c echo.Context) error {
+	userID := h.getUserID(c)
+	if userID == "" {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	d, err := h.UserDomains.GetByUser(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+	if d.Verified() {
+		return c.Redirect(http.StatusFound, "/settings/domain")
+	}
+	if _, err := h.UserDomains.GetVerified(c.Request().Context(), d.Domain); err == nil {
+		return h.renderDomainForm(c, userID, "domain.error.in_use")
+	}
+	if err := d.Verify(c.Request().Context(), h.Resolver); err != nil {
+		return h.renderDomainForm(c, userID, "domain.error.not_found")
+	}
+	err = h.UserDomains.MarkVerified(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/settings/domain")
+}
+
+// canonicalURL returns the URL of path on the verified custom domain of the
+// user, or an empty string when the user has none.
+func (h *Handler) canonicalURL(c echo.Context, userID string, path string) string {
+	if userID == "" {
+		return ""
+	}
+	d, err := h.UserDomains.GetByUser(c.Request().Context(), userID)
+	if err != nil || !d.Verified() {
+		return ""
+	}
+	return c.Scheme() + "://" + d.Domain + path
+}
@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"backyard/domain"
+	"backyard/webhook"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// maxListedDeliveries is how many of the latest deliveries the page of a
+// webhook shows.
+const maxListedDeliveries = 50
+
+// WebhookPayload is the body of the requests sent to webhooks. Data is the
+// post or the user as the JSON API shows them.
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	Site      string    `json:"site"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// triggerWebhooks queues a delivery of the event for every webhook of the site
+// subscribed to it. Webhooks are best effort, so errors are logged instead of
+// failing the request that caused the event.
+func (h *Handler) triggerWebhooks(c echo.Context, event string, data any) {
+	if err := h.queueDeliveries(c, event, data); err != nil {
+		LogError(c, err)
+	}
+}
+
+func (h *Handler) queueDeliveries(c echo.Context, event string, data any) error {
+	ctx := c.Request().Context()
+	webhooks, err := h.Webhooks.List(ctx, CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(WebhookPayload{
+		Event:     event,
+		Site:      h.siteURL(c),
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	queued := false
+	for _, w := range webhooks {
+		if !w.Subscribes(event) {
+			continue
+		}
+		now := time.Now()
+		err = h.Webhooks.CreateDelivery(ctx, domain.WebhookDelivery{
+			ID:            uuid.NewString(),
+			SiteID:        w.SiteID,
+			WebhookID:     w.ID,
+			Event:         event,
+			Payload:       payload,
+			Status:        domain.DeliveryPending,
+			NextAttemptAt: &now,
+		})
+		if err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued && h.WebhookDispatcher != nil {
+		h.WebhookDispatcher.Notify()
+	}
+	return nil
+}
+
+// postChanged triggers the webhooks of a post being created, edited or
+// deleted. before is empty for new posts, and after for deleted ones. Drafts
+// are private, so they only trigger events once published, and a post turned
+// back into a draft is gone from the site as if it was deleted.
+func (h *Handler) postChanged(c echo.Context, before domain.Post, after domain.Post) {
+	if after.ID == "" || after.Draft {
+		if before.ID != "" && !before.Draft {
+			h.triggerWebhooks(c, domain.EventPostDeleted, h.apiPost(c, before))
+		}
+		return
+	}
+	event := domain.EventPostUpdated
+	if before.ID == "" || before.Draft {
+		event = domain.EventPostPublished
+	}
+	// Reload the post for the author and dates the repository sets
+	p, err := h.Posts.GetByID(c.Request().Context(), after.SiteID, after.ID)
+	if err != nil {
+		LogError(c, err)
+		return
+	}
+	h.triggerWebhooks(c, event, h.apiPost(c, p))
+}
+
+// userSignedUp triggers the webhooks of a new user.
+func (h *Handler) userSignedUp(c echo.Context, user domain.User) {
+	// Reload the user for the sign-up date the repository sets
+	user, err := h.Users.GetByID(c.Request().Context(), user.ID)
+	if err != nil {
+		LogError(c, err)
+		return
+	}
+	h.triggerWebhooks(c, domain.EventUserSignedUp, h.apiUser(c, user, nil))
+}
+
+type WebhookDTO struct {
+	ID        string
+	URL       string
+	Secret    string
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+}
+
+func newWebhookDTO(w domain.Webhook) WebhookDTO {
+	return WebhookDTO{
+		ID:        w.ID,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Events:    w.Events,
+		Active:    w.Active,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+// GetWebhooks lists the webhooks of the site, with a form to add one.
+func (h *Handler) GetWebhooks(c echo.Context) error {
+	return h.renderWebhooks(c, "")
+}
+
+func (h *Handler) renderWebhooks(c echo.Context, errorMessage string) error {
+	webhooks, err := h.Webhooks.List(c.Request().Context(), CurrentSite(c).ID)
+	if err != nil {
+		return err
+	}
+	dtos := []WebhookDTO{}
+	for _, w := range webhooks {
+		dtos = append(dtos, newWebhookDTO(w))
+	}
+	status := http.StatusOK
+	if errorMessage != "" {
+		status = http.StatusBadRequest
+	}
+	return c.Render(status, "admin-webhooks.html", struct {
+		Webhooks []WebhookDTO
+		Events   []string
+		Error    string
+	}{
+		Webhooks: dtos,
+		Events:   domain.Events,
+		Error:    errorMessage,
+	})
+}
+
+// webhookForm reads the URL and events of the webhook form. It returns the
+// message key of the error when they are not valid.
+func webhookForm(c echo.Context) (string, []string, string, error) {
+	rawURL := strings.TrimSpace(c.FormValue("url"))
+	if err := webhook.CheckURL(rawURL); errors.Is(err, webhook.ErrPrivateAddress) {
+		return "", nil, "webhooks.error.private_url", nil
+	} else if err != nil {
+		return "", nil, "webhooks.error.url", nil
+	}
+	form, err := c.FormParams()
+	if err != nil {
+		return "", nil, "", err
+	}
+	events := []string{}
+	for _, event := range domain.Events {
+		if slices.Contains(form["event"], event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return "", nil, "webhooks.error.events", nil
+	}
+	return rawURL, events, "", nil
+}
+
+// CreateWebhook adds a webhook with a new random secret.
+func (h *Handler) CreateWebhook(c echo.Context) error {
+	rawURL, events, errorMessage, err := webhookForm(c)
+	if err != nil {
+		return err
+	}
+	if errorMessage != "" {
+		return h.renderWebhooks(c, errorMessage)
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	id := uuid.NewString()
+	err = h.Webhooks.Create(c.Request().Context(), domain.Webhook{
+		ID:     id,
+		SiteID: CurrentSite(c).ID,
+		URL:    rawURL,
+		Secret: secret,
+		Events: events,
+		Active: true,
+	})
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/webhooks/"+id)
+}
+
+func (h *Handler) getWebhook(c echo.Context) (domain.Webhook, error) {
+	w, err := h.Webhooks.GetByID(c.Request().Context(), CurrentSite(c).ID, c.Param("id"))
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.Webhook{}, echo.ErrNotFound
+	}
+	return w, err
+}
+
+type WebhookDeliveryDTO struct {
+	ID             string
+	Event          string
+	Status         string
+	Attempts       int
+	NextAttemptAt  *time.Time
+	LastAttemptAt  *time.Time
+	ResponseStatus int
+	Error          string
+	CreatedAt      time.Time
+}
+
+// GetWebhook shows a webhook with the log of its latest deliveries.
+func (h *Handler) GetWebhook(c echo.Context) error {
+	w, err := h.getWebhook(c)
+	if err != nil {
+		return err
+	}
+	return h.renderWebhook(c, w, "")
+}
+
+func (h *Handler) renderWebhook(c echo.Context, w domain.Webhook, errorMessage string) error {
+	deliveries, err := h.Webhooks.ListDeliveries(c.Request().Context(), w.ID, maxListedDeliveries)
+	if err != nil {
+		return err
+	}
+	dtos := []WebhookDeliveryDTO{}
+	for _, d := range deliveries {
+		dtos = append(dtos, WebhookDeliveryDTO{
+			ID:             d.ID,
+			Event:          d.Event,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			NextAttemptAt:  d.NextAttemptAt,
+			LastAttemptAt:  d.LastAttemptAt,
+			ResponseStatus: d.ResponseStatus,
+			Error:          d.Error,
+			CreatedAt:      d.CreatedAt,
+		})
+	}
+	subscribed := map[string]bool{}
+	for _, event := range w.Events {
+		subscribed[event] = true
+	}
+	status := http.StatusOK
+	if errorMessage != "" {
+		status = http.StatusBadRequest
+	}
+	return c.Render(status, "admin-webhook.html", struct {
+		Webhook WebhookDTO
+		Events  []string
+		// Subscribed has the events of the webhook as keys
+		Subscribed map[string]bool
+		Deliveries []WebhookDeliveryDTO
+		Error      string
+	}{
+		Webhook:    newWebhookDTO(w),
+		Events:     domain.Events,
+		Subscribed: subscribed,
+		Deliveries: dtos,
+		Error:      errorMessage,
+	})
+}
+
+// UpdateWebhook changes the URL, events and active state of a webhook.
+func (h *Handler) UpdateWebhook(c echo.Context) error {
+	w, err := h.getWebhook(c)
+	if err != nil {
+		return err
+	}
+	rawURL, events, errorMessage, err := webhookForm(c)
+	if err != nil {
+		return err
+	}
+	if errorMessage != "" {
+		return h.renderWebhook(c, w, errorMessage)
+	}
+	w.URL = rawURL
+	w.Events = events
+	w.Active = c.FormValue("active") == "on"
+	err = h.Webhooks.Update(c.Request().Context(), w)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/webhooks/"+w.ID)
+}
+
+// DeleteWebhook deletes a webhook and its delivery log.
+func (h *Handler) DeleteWebhook(c echo.Context) error {
+	err := h.Webhooks.Delete(c.Request().Context(), CurrentSite(c).ID, c.Param("id"))
+	if errors.Is(err, domain.ErrNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/admin/webhooks")
+}
+
+// RedeliverWebhook sends the payload of a past delivery again, as a new
+// delivery with its own attempts.
+func (h *Handler) RedeliverWebhook(c echo.Context) error {
+	w, err := h.getWebhook(c)
+	if err != nil {
+		return err
+	}
+	d, err := h.Webhooks.GetDelivery(c.Request().Context(), w.ID, c.Param("delivery"))
+	if errors.Is(err, domain.ErrNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = h.Webhooks.CreateDelivery(c.Request().Context(), domain.WebhookDelivery{
+		ID:            uuid.NewString(),
+		SiteID:        w.SiteID,
+		WebhookID:     w.ID,
+		Event:         d.Event,
+		Payload:       d.Payload,
+		Status:        domain.DeliveryPending,
+		NextAttemptAt: &now,
+	})
+	if err != nil {
+		return err
+	}
+	if h.WebhookDispatcher != nil {
+		h.WebhookDispatcher.Notify()
+	}
+	return c.Redirect(http.StatusFound, "/admin/webhooks/"+w.ID)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"backyard/domain"
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestWebhook adds a webhook of the default site for every event.
+func createTestWebhook(t *testing.T, h *Handler) domain.Webhook {
+	t.Helper()
+	w := domain.Webhook{
+		ID:     uuid.NewString(),
+		SiteID: domain.DefaultSiteID,
+		URL:    "https://example.com/hook",
+		Secret: "secret",
+		Events: domain.Events,
+		Active: true,
+	}
+	if err := h.Webhooks.Create(context.Background(), w); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestPostChangedEvents(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "password")
+	w := createTestWebhook(t, h)
+	post := domain.Post{
+		ID:     uuid.NewString(),
+		SiteID: domain.DefaultSiteID,
+		Title:  "Hello",
+		Draft:  true,
+		Access: domain.Access{UserID: alice.ID, Relation: domain.RelationAuthor},
+	}
+	if err := h.Posts.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	published := post
+	published.Draft = false
+
+	tests := []struct {
+		name   string
+		before domain.Post
+		after  domain.Post
+		event  string
+	}{
+		{"new draft", domain.Post{}, post, ""},
+		{"draft edited", post, post, ""},
+		{"draft published", post, published, domain.EventPostPublished},
+		{"post edited", published, published, domain.EventPostUpdated},
+		{"post unpublished", published, post, domain.EventPostDeleted},
+		{"draft deleted", post, domain.Post{}, ""},
+		{"post deleted", published, domain.Post{}, domain.EventPostDeleted},
+	}
+	for _, tt := range tests {
+		if err := h.Posts.Update(context.Background(), tt.after); tt.after.ID != "" && err != nil {
+			t.Fatal(err)
+		}
+		before, err := h.Webhooks.ListDeliveries(context.Background(), w.ID, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, _ := newTestContext(http.MethodPost, "/", nil)
+		h.postChanged(c, tt.before, tt.after)
+		deliveries, err := h.Webhooks.ListDeliveries(context.Background(), w.ID, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events := []string{}
+		for _, d := range deliveries[:len(deliveries)-len(before)] {
+			events = append(events, d.Event)
+		}
+		want := []string{}
+		if tt.event != "" {
+			want = append(want, tt.event)
+		}
+		if !slices.Equal(events, want) {
+			t.Errorf("%s: events %v, want %v", tt.name, events, want)
+		}
+	}
+}
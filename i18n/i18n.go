@@ -0,0 +1,152 @@
+// Package i18n translates the user interface and formats dates for a locale.
+//
+// Every locale is a flat JSON catalog in locales/ mapping message keys to
+// fmt format strings. Messages missing from a catalog fall back to the
+// default locale, and then to the key itself.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the locale used when nothing else matches.
+const Default = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+var catalogs = map[string]map[string]string{}
+
+func init() {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Errorf("invalid catalog %s: %v", entry.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(entry.Name(), ".json")] = catalog
+	}
+}
+
+// Locales returns the supported locales, sorted.
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supported reports whether there is a catalog for locale.
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// T returns the message for key in locale, formatted with args.
+func T(locale string, key string, args ...any) string {
+	message, ok := catalogs[locale][key]
+	if !ok {
+		message, ok = catalogs[Default][key]
+	}
+	if !ok {
+		message = key
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Plural returns the message for key+".one" when n is 1, or key+".other"
+// otherwise, formatted with n.
+func Plural(locale string, key string, n int) string {
+	if n == 1 {
+		return T(locale, key+".one", n)
+	}
+	return T(locale, key+".other", n)
+}
+
+// Match returns the supported locale preferred in an Accept-Language header, or
+// an empty string if none is supported.
+func Match(acceptLanguage string) string {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+	preferences := []preference{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if tag != "" && quality > 0 {
+			preferences = append(preferences, preference{strings.ToLower(tag), quality})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+	for _, p := range preferences {
+		if Supported(p.tag) {
+			return p.tag
+		}
+		// es-AR is served with es
+		if base, _, ok := strings.Cut(p.tag, "-"); ok && Supported(base) {
+			return base
+		}
+	}
+	return ""
+}
+
+// FormatDate formats the day of t following the date.layout message of locale.
+func FormatDate(locale string, t time.Time) string {
+	return strings.NewReplacer(
+		"{day}", strconv.Itoa(t.Day()),
+		"{month}", T(locale, "date.month."+strconv.Itoa(int(t.Month()))),
+		"{year}", strconv.Itoa(t.Year()),
+	).Replace(T(locale, "date.layout"))
+}
+
+// FormatDateTime formats the day and time of t.
+func FormatDateTime(locale string, t time.Time) string {
+	return FormatDate(locale, t) + " " + t.Format("15:04")
+}
+
+// FormatRelative describes how long ago t was, falling back to the date for
+// times older than a week.
+func FormatRelative(locale string, t time.Time, now time.Time) string {
+	elapsed := now.Sub(t)
+	switch {
+	case elapsed < time.Minute:
+		return T(locale, "time.just_now")
+	case elapsed < time.Hour:
+		return Plural(locale, "time.minutes_ago", int(elapsed/time.Minute))
+	case elapsed < 24*time.Hour:
+		return Plural(locale, "time.hours_ago", int(elapsed/time.Hour))
+	case elapsed < 7*24*time.Hour:
+		return Plural(locale, "time.days_ago", int(elapsed/(24*time.Hour)))
+	default:
+		return FormatDate(locale, t)
+	}
+}
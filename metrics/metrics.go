@@ -0,0 +1,217 @@
+// Package metrics collects measurements of the process and writes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of latency
+// histograms.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics written by WriteTo.
+type Registry struct {
+	mu         sync.Mutex
+	histograms []*Histogram
+	gauges     []gaugeFunc
+	start      time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{start: time.Now()}
+}
+
+// NewHistogram adds a histogram with the given label names.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: buckets, labels: labels, series: map[string]*series{}}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.histograms = append(r.histograms, h)
+	return h
+}
+
+// GaugeFunc adds a gauge whose values are read by fn on every scrape. fn maps
+// values of the label to their gauge value. An empty label makes a gauge
+// without labels, read from the empty key.
+func (r *Registry) GaugeFunc(name string, help string, label string, fn func(ctx context.Context) (map[string]float64, error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges = append(r.gauges, gaugeFunc{name: name, help: help, label: label, fn: fn})
+}
+
+type gaugeFunc struct {
+	name  string
+	help  string
+	label string
+	fn    func(ctx context.Context) (map[string]float64, error)
+}
+
+// Histogram counts observations, like request durations, in buckets.
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	labels  []string
+	mu      sync.Mutex
+	// series is keyed by the label values joined with a zero byte
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	// counts has the number of observations of each bucket, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds value to the series with the label values, given in the order
+// of the label names.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\x00")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(h.labels, s.labelValues, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelSet(h.labels, s.labelValues), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelSet(h.labels, s.labelValues), s.count)
+	}
+}
+
+// WriteTo writes every metric of the registry, followed by the Go runtime
+// statistics. Gauges that fail to be read are left out, and the first error
+// is returned after writing the rest.
+func (r *Registry) WriteTo(ctx context.Context, w io.Writer) error {
+	r.mu.Lock()
+	histograms := slices.Clone(r.histograms)
+	gauges := slices.Clone(r.gauges)
+	r.mu.Unlock()
+
+	for _, h := range histograms {
+		h.write(w)
+	}
+	var firstErr error
+	for _, g := range gauges {
+		values, err := g.fn(ctx)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("reading %s: %w", g.name, err)
+			}
+			continue
+		}
+		writeGauge(w, g.name, g.help, g.label, values)
+	}
+	r.writeRuntime(w)
+	return firstErr
+}
+
+func (r *Registry) writeRuntime(w io.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	writeGauge(w, "go_info", "Version of Go the process was built with.", "version", map[string]float64{runtime.Version(): 1})
+	writeGauge(w, "go_goroutines", "Number of goroutines that currently exist.", "", map[string]float64{"": float64(runtime.NumGoroutine())})
+	writeGauge(w, "go_threads", "Number of OS threads created.", "", map[string]float64{"": float64(threads)})
+	writeGauge(w, "go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "", map[string]float64{"": float64(stats.Alloc)})
+	writeGauge(w, "go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "", map[string]float64{"": float64(stats.HeapInuse)})
+	writeGauge(w, "go_memstats_heap_objects", "Number of allocated objects.", "", map[string]float64{"": float64(stats.HeapObjects)})
+	writeGauge(w, "go_memstats_sys_bytes", "Number of bytes obtained from the system.", "", map[string]float64{"": float64(stats.Sys)})
+	writeGauge(w, "go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of the last garbage collection.", "", map[string]float64{"": float64(stats.LastGC) / 1e9})
+	writeCounter(w, "go_gc_cycles_total", "Number of completed garbage collection cycles.", float64(stats.NumGC))
+	writeCounter(w, "go_gc_pause_seconds_total", "Total time the garbage collector stopped the program.", float64(stats.PauseTotalNs)/1e9)
+	writeGauge(w, "process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "", map[string]float64{"": float64(r.start.Unix())})
+}
+
+func writeGauge(w io.Writer, name string, help string, label string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		labels := ""
+		if label != "" {
+			labels = labelSet([]string{label}, []string{key})
+		}
+		fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(values[key]))
+	}
+}
+
+func writeCounter(w io.Writer, name string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", name, help, name, name, formatFloat(value))
+}
+
+// labelSet formats names and values as {name="value",...}, followed by the
+// extra name and value pairs.
+func labelSet(names []string, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// NewDBConnector returns a connector opening connections to dsn with drv,
+// which observe in h how long each query and statement takes, labeled with
+// the operation: query or exec. For queries, the time is until the first rows
+// are ready.
+func NewDBConnector(drv driver.Driver, dsn string, h *Histogram) driver.Connector {
+	return connector{driver: drv, dsn: dsn, histogram: h}
+}
+
+type connector struct {
+	driver    driver.Driver
+	dsn       string
+	histogram *Histogram
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{Conn: conn, histogram: c.histogram}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// timedConn times the queries of the connection it wraps, and passes
+// everything else through. Returning driver.ErrSkip makes database/sql fall
+// back to what it does for drivers without the feature.
+type timedConn struct {
+	driver.Conn
+	histogram *Histogram
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.histogram.Observe(time.Since(start).Seconds(), "query")
+	return rows, err
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	c.histogram.Observe(time.Since(start).Seconds(), "exec")
+	return result, err
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	// Begin is deprecated, but the only way to start a transaction on
+	// drivers without BeginTx
+	return c.Conn.Begin()
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *timedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
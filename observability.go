@@ -0,0 +1,224 @@
+package main
+
+import (
+	"backyard/domain"
+	"backyard/handler"
+	"backyard/metrics"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// readyTimeout is how long the readiness check waits for the database.
+const readyTimeout = 2 * time.Second
+
+// observability holds the metrics exposed on /metrics.
+type observability struct {
+	registry *metrics.Registry
+	// requests is labeled with the method, route and status of each request
+	requests *metrics.Histogram
+	// queries is labeled with the operation: query or exec
+	queries *metrics.Histogram
+}
+
+func newObservability() *observability {
+	registry := metrics.NewRegistry()
+	return &observability{
+		registry: registry,
+		requests: registry.NewHistogram("http_request_duration_seconds", "Duration of HTTP requests in seconds.", metrics.DefaultBuckets, "method", "route", "status"),
+		queries:  registry.NewHistogram("db_query_duration_seconds", "Duration of database queries in seconds.", metrics.DefaultBuckets, "operation"),
+	}
+}
+
+// setupLogger makes slog log text lines in the dev environment, easier to
+// read in a terminal, and JSON lines in the others.
+func setupLogger(env string) {
+	var h slog.Handler = slog.NewJSONHandler(os.Stdout, nil)
+	if env == DEV_ENV {
+		h = slog.NewTextHandler(os.Stdout, nil)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// countContent adds the gauges of how many posts and users there are, read
+// from the repositories on every scrape.
+func (o *observability) countContent(posts domain.PostRepository, users domain.UserRepository) {
+	o.registry.GaugeFunc("backyard_posts", "Number of posts of every site.", "status", func(ctx context.Context) (map[string]float64, error) {
+		published, drafts, err := posts.CountAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"published": float64(published), "draft": float64(drafts)}, nil
+	})
+	o.registry.GaugeFunc("backyard_users", "Number of users of every site.", "", func(ctx context.Context) (map[string]float64, error) {
+		count, err := users.CountAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"": float64(count)}, nil
+	})
+}
+
+// requestMetrics observes how long each request takes. Requests are labeled
+// with their route instead of their path, so there is a series per route.
+func (o *observability) requestMetrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil && !c.Response().Committed {
+				// Let the error handler write the response, so its status is known
+				c.Error(err)
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			o.requests.Observe(time.Since(start).Seconds(), c.Request().Method, route, strconv.Itoa(c.Response().Status))
+			return err
+		}
+	}
+}
+
+// requestLogger logs a line for every request, with the ID given by the
+// RequestID middleware and the user it was made by. Server errors are logged
+// as errors, everything else as information. Only the path is logged, as the
+// query of links sent by email has tokens to verify emails and reset
+// passwords.
+func requestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogStatus:    true,
+		LogURIPath:   true,
+		LogMethod:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogRequestID: true,
+		LogRoutePath: true,
+		LogError:     true,
+		HandleError:  true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			if v.Status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			attrs := []slog.Attr{
+				slog.String("request_id", v.RequestID),
+				slog.String("method", v.Method),
+				slog.String("path", v.URIPath),
+				slog.String("route", v.RoutePath),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+			if userID := handler.RequestUserID(c); userID != "" {
+				attrs = append(attrs, slog.String("user_id", userID))
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			slog.LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
+
+// opsHandler serves /healthz, /readyz and /metrics, on a listener of their
+// own so they are not public. /healthz only tells the process is up, while
+// /readyz also checks the database is reachable and its schema has the
+// latest migration.
+func (o *observability) opsHandler(db *sql.DB, m *migrate.Migrate, latest uint) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		readiness(w, r, db, m, latest)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if err := o.registry.WriteTo(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error writing metrics", "error", err)
+		}
+	})
+	return mux
+}
+
+// readiness answers whether the database and its schema are ready. The
+// errors are only logged, the response just tells which check failed.
+func readiness(w http.ResponseWriter, r *http.Request, db *sql.DB, m *migrate.Migrate, latest uint) {
+	checks := map[string]string{"database": "ok", "migrations": "ok"}
+	ready := true
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		slog.ErrorContext(ctx, "Error pinging the database", "error", err)
+		checks["database"] = "unreachable"
+		ready = false
+	}
+	version, dirty, err := m.Version()
+	switch {
+	case err != nil:
+		slog.ErrorContext(ctx, "Error reading the schema version", "error", err)
+		checks["migrations"] = "the schema version cannot be read"
+		ready = false
+	case dirty:
+		checks["migrations"] = "a migration failed halfway"
+		ready = false
+	case version != latest:
+		checks["migrations"] = "the schema is not at the latest migration"
+		ready = false
+	}
+
+	status := http.StatusOK
+	checks["status"] = "ok"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		checks["status"] = "unavailable"
+	}
+	writeJSON(w, status, checks)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error writing response", "error", err)
+	}
+}
+
+// latestMigration returns the version of the last embedded migration.
+func latestMigration() (uint, error) {
+	src, err := iofs.New(embedded, "db/migrations")
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
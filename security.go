@@ -0,0 +1,104 @@
+package main
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// securityConfig holds the hardening settings that differ per environment.
+type securityConfig struct {
+	// SecureCookies marks cookies to be only sent over HTTPS. Development
+	// servers are usually reached on plain http://localhost.
+	SecureCookies bool
+	// HSTSMaxAge is how many seconds browsers must only use HTTPS for the
+	// host, 0 to not send the header.
+	HSTSMaxAge int
+}
+
+func securityConfigFor(env string) securityConfig {
+	switch env {
+	case DEV_ENV:
+		return securityConfig{}
+	case STG_ENV:
+		return securityConfig{SecureCookies: true, HSTSMaxAge: 60 * 60 * 24}
+	default:
+		return securityConfig{SecureCookies: true, HSTSMaxAge: 60 * 60 * 24 * 365}
+	}
+}
+
+// contentSecurityPolicy only allows resources from the same origin, except
+// images that posts may embed from other HTTPS sites. Pages have no scripts
+// nor inline styles.
+const contentSecurityPolicy = "default-src 'self'; img-src 'self' https: data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+func securityHeaders(config securityConfig) echo.MiddlewareFunc {
+	return middleware.SecureWithConfig(middleware.SecureConfig{
+		ContentTypeNosniff: "nosniff",
+		XFrameOptions:      "DENY",
+		HSTSMaxAge:         config.HSTSMaxAge,
+		// Subdomains may be other people's sites without HTTPS
+		HSTSExcludeSubdomains: true,
+		ContentSecurityPolicy: contentSecurityPolicy,
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+	})
+}
+
+const (
+	csrfFormField = "csrf"
+	// csrfHeader carries the token on the requests made by scripts.
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfProtection checks that every request that is not GET, HEAD, OPTIONS
+// or TRACE carries the token of the _csrf cookie in the csrf form field or
+// the X-CSRF-Token header. Requests with an access token are left out, as
+// browsers never add the Authorization header on their own.
+func csrfProtection(config securityConfig) echo.MiddlewareFunc {
+	return middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper: func(c echo.Context) bool {
+			return strings.HasPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		},
+		TokenLookup:    "form:" + csrfFormField + ",header:" + csrfHeader,
+		CookieName:     "_csrf",
+		CookiePath:     "/",
+		CookieHTTPOnly: true,
+		CookieSecure:   config.SecureCookies,
+		CookieSameSite: http.SameSiteLaxMode,
+	})
+}
+
+// csrfField returns the hidden form input carrying the CSRF token of the
+// request.
+func csrfField(c echo.Context) template.HTML {
+	token, _ := c.Get(middleware.DefaultCSRFConfig.ContextKey).(string)
+	return template.HTML(`<input type="hidden" name="` + csrfFormField + `" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+// ipExtractor returns how the client IP of requests is found, which the login
+// throttle, sessions and login events rely on. Without trusted proxies it is
+// the address of the connection, as any client can send X-Forwarded-For.
+// trustedProxies is a comma separated list of CIDR ranges whose
+// X-Forwarded-For headers are believed.
+func ipExtractor(trustedProxies string) (echo.IPExtractor, error) {
+	if strings.TrimSpace(trustedProxies) == "" {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range strings.Split(trustedProxies, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	cryptotls "crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Environment variables with the file descriptors a process handing off its
+// listener passes to the new one.
+const (
+	listenerFDEnv = "BACKYARD_LISTENER_FD"
+	// opsListenerFDEnv is the listener of the operational endpoints, if any.
+	opsListenerFDEnv = "BACKYARD_OPS_LISTENER_FD"
+	// readyFDEnv is the write end of a pipe the new process writes to once it
+	// serves requests.
+	readyFDEnv = "BACKYARD_READY_FD"
+)
+
+// handOffTimeout is how long the new process has to get ready, migrations
+// included, before the handoff is given up.
+const handOffTimeout = time.Minute
+
+// listen returns the listener handed off by the previous process in the fdEnv
+// environment variable, or a new one on addr.
+func listen(addr string, fdEnv string) (net.Listener, error) {
+	fd := os.Getenv(fdEnv)
+	if fd == "" {
+		return net.Listen("tcp", addr)
+	}
+	os.Unsetenv(fdEnv)
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", fdEnv, err)
+	}
+	f := os.NewFile(uintptr(n), "listener")
+	// FileListener works on a copy of the file descriptor
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// notifyReady tells the process that handed off its listener, if any, that
+// this one serves requests, so it can stop.
+func notifyReady() {
+	fd := os.Getenv(readyFDEnv)
+	if fd == "" {
+		return
+	}
+	os.Unsetenv(readyFDEnv)
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		slog.Error("Invalid ready file descriptor", "error", err)
+		return
+	}
+	f := os.NewFile(uintptr(n), "ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		slog.Error("Error notifying the previous process", "error", err)
+	}
+}
+
+// fileOf returns a copy of the file descriptor of l.
+func fileOf(l net.Listener) (*os.File, error) {
+	filer, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.New("the listener has no file descriptor")
+	}
+	return filer.File()
+}
+
+// handOff starts the executable again with the same arguments, serving on the
+// socket of l, and of ops if not nil, and returns once the new process is
+// ready. If it exits or does not get ready in time, an error is returned and
+// this process keeps serving.
+func handOff(l net.Listener, ops net.Listener) error {
+	listenerFile, err := fileOf(l)
+	if err != nil {
+		return err
+	}
+	defer listenerFile.Close()
+	var opsFile *os.File
+	if ops != nil {
+		opsFile, err = fileOf(ops)
+		if err != nil {
+			return err
+		}
+		defer opsFile.Close()
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles start at file descriptor 3, after the standard ones
+	cmd.Env = append(os.Environ(), listenerFDEnv+"=3", readyFDEnv+"=4")
+	cmd.ExtraFiles = []*os.File{listenerFile, readyWriter}
+	if opsFile != nil {
+		cmd.Env = append(cmd.Env, opsListenerFDEnv+"=5")
+		cmd.ExtraFiles = append(cmd.ExtraFiles, opsFile)
+	}
+	err = cmd.Start()
+	// Only the new process keeps the write end open, so reading fails once it
+	// exits
+	readyWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyReader.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Wait()
+			return fmt.Errorf("the new process exited before getting ready: %w", err)
+		}
+		slog.Info("Listener handed off", "pid", cmd.Process.Pid)
+		return nil
+	case <-time.After(handOffTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return errors.New("the new process did not get ready in time")
+	}
+}
+
+// gracefulServer serves requests on a listener that can be handed off to a
+// new process, and shuts down without dropping the requests of the
+// connections it accepted.
+type gracefulServer struct {
+	echo   *echo.Echo
+	server *http.Server
+	// listener is the socket handed off on SIGHUP
+	listener net.Listener
+	// accepting is closed first when shutting down, to stop accepting
+	// connections
+	accepting *onceCloseListener
+	serveErr  chan error
+	// ops serves the operational endpoints on opsListener, handed off too,
+	// when they are served
+	ops         *http.Server
+	opsListener net.Listener
+
+	mu sync.Mutex
+	// fresh has the connections whose first request was not read yet.
+	// Shutdown drops the requests it reads after starting, so they are waited
+	// for before calling it.
+	fresh map[net.Conn]struct{}
+}
+
+// freshConnectionsWait is how long shutting down waits for the first request
+// of the connections just accepted. Browsers open connections in advance that
+// may not send any.
+const freshConnectionsWait = time.Second
+
+// newGracefulServer serves e on l, with TLS if tlsConfig is not nil.
+func newGracefulServer(e *echo.Echo, l net.Listener, tlsConfig *cryptotls.Config) *gracefulServer {
+	g := &gracefulServer{
+		echo:      e,
+		server:    e.Server,
+		listener:  l,
+		accepting: &onceCloseListener{Listener: l},
+		// One error for each server
+		serveErr: make(chan error, 2),
+		fresh:    map[net.Conn]struct{}{},
+	}
+	if tlsConfig == nil {
+		e.Listener = g.accepting
+	} else {
+		g.server = e.TLSServer
+		g.server.TLSConfig = tlsConfig
+		e.TLSListener = cryptotls.NewListener(g.accepting, tlsConfig)
+	}
+	g.server.ConnState = g.connState
+	return g
+}
+
+func (g *gracefulServer) connState(conn net.Conn, state http.ConnState) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if state == http.StateNew {
+		g.fresh[conn] = struct{}{}
+	} else {
+		delete(g.fresh, conn)
+	}
+}
+
+// ServeOps serves the operational endpoints with handler on l, once started.
+func (g *gracefulServer) ServeOps(l net.Listener, handler http.Handler) {
+	g.opsListener = l
+	g.ops = &http.Server{Handler: handler}
+}
+
+// Start serves requests in the background.
+func (g *gracefulServer) Start() {
+	go func() {
+		err := g.echo.StartServer(g.server)
+		if !errors.Is(err, http.ErrServerClosed) {
+			g.serveErr <- err
+		}
+	}()
+	if g.ops != nil {
+		go func() {
+			err := g.ops.Serve(g.opsListener)
+			if !errors.Is(err, http.ErrServerClosed) {
+				g.serveErr <- err
+			}
+		}()
+	}
+}
+
+// WaitForSignals blocks until SIGINT or SIGTERM is received, the server
+// fails, or SIGHUP hands the listener off to a new process. Failed handoffs
+// are logged and the server goes on.
+func (g *gracefulServer) WaitForSignals() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case err := <-g.serveErr:
+			return err
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				slog.Info("Shutting down", "signal", sig.String())
+				return nil
+			}
+			slog.Info("Handing off the listener to a new process")
+			if err := handOff(g.listener, g.opsListener); err != nil {
+				slog.Error("Error handing off the listener", "error", err)
+				continue
+			}
+			return nil
+		}
+	}
+}
+
+// Shutdown stops accepting connections and waits for the requests in flight
+// until ctx is done.
+func (g *gracefulServer) Shutdown(ctx context.Context) error {
+	if err := g.accepting.Close(); err != nil {
+		return err
+	}
+	wait, cancel := context.WithTimeout(ctx, freshConnectionsWait)
+	defer cancel()
+	for g.freshConnections() > 0 && wait.Err() == nil {
+		select {
+		case <-wait.Done():
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err := g.echo.Shutdown(ctx); err != nil {
+		return err
+	}
+	// The operational endpoints answer until the requests are drained
+	if g.ops != nil {
+		return g.ops.Shutdown(ctx)
+	}
+	return nil
+}
+
+func (g *gracefulServer) freshConnections() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.fresh)
+}
+
+// onceCloseListener can be closed before the server closes it again on
+// shutdown, which would fail otherwise.
+type onceCloseListener struct {
+	net.Listener
+	once sync.Once
+	err  error
+}
+
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() { l.err = l.Listener.Close() })
+	return l.err
+}
+
+// shutdown drains the requests of g, and waits for the background goroutines
+// tracked by background, the long running ones told to stop with
+// stopBackground, all within timeout. The database is closed last, as both
+// may still write to it.
+func shutdown(g *gracefulServer, timeout time.Duration, stopBackground func(), background *sync.WaitGroup, db *sql.DB) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopBackground()
+	if err := g.Shutdown(ctx); err != nil {
+		slog.Error("Error draining requests", "error", err)
+	}
+	// Only requests start background work, so none starts once they are
+	// drained
+	backgroundDone := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(backgroundDone)
+	}()
+	select {
+	case <-backgroundDone:
+	case <-ctx.Done():
+		slog.Error("Background goroutines did not stop in time")
+	}
+	if err := db.Close(); err != nil {
+		slog.Error("Error closing the database", "error", err)
+	}
+	slog.Info("Stopped")
+}
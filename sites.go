@@ -0,0 +1,102 @@
+package main
+
+import (
+	"backyard/domain"
+	"backyard/handler"
+	"backyard/theme"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// addSite creates a site for hostname together with its first configuration,
+// its default roles and an admin user, and prints the admin credentials.
+func addSite(h *handler.Handler, hostname string) error {
+	ctx := context.Background()
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+	if _, err := h.Sites.GetByHostname(ctx, hostname); err == nil {
+		return fmt.Errorf("site %s already exists", hostname)
+	}
+	defaultConfig, err := h.Configs.GetActive(ctx, domain.DefaultSiteID)
+	if err != nil {
+		return err
+	}
+
+	passwordBytes := make([]byte, 18)
+	if _, err := rand.Read(passwordBytes); err != nil {
+		return err
+	}
+	password := base64.RawURLEncoding.EncodeToString(passwordBytes)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	site := domain.Site{ID: uuid.NewString(), Hostname: hostname}
+	admin := domain.User{
+		ID:       uuid.NewString(),
+		SiteID:   site.ID,
+		Username: "admin",
+		Password: string(hashedPassword),
+	}
+	roles := []domain.Role{}
+	for _, role := range domain.DefaultRoles {
+		role.ID = uuid.NewString()
+		role.SiteID = site.ID
+		roles = append(roles, role)
+	}
+	err = h.Sites.Provision(ctx, domain.NewSite{
+		Site:  site,
+		Admin: admin,
+		Roles: roles,
+		Config: domain.Config{
+			ID:              uuid.NewString(),
+			SiteID:          site.ID,
+			BackyardVersion: defaultConfig.BackyardVersion,
+			Title:           hostname,
+			Footer:          "powered by backyard",
+			Theme:           theme.Default,
+			Locale:          defaultConfig.Locale,
+			SignupMode:      domain.SignupClosed,
+			Inviters:        domain.InvitersAdmin,
+			AdminUserID:     admin.ID,
+			CreatedBy:       admin.ID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Site %s created. Admin username: %s, password: %s\n", hostname, admin.Username, password)
+	return nil
+}
+
+// hostPolicy only allows certificates for the configured sites, the verified
+// user domains and the given extra hosts, usually the ones the default site is
+// served on.
+func hostPolicy(sites domain.SiteRepository, userDomains domain.UserDomainRepository, hosts ...string) autocert.HostPolicy {
+	return func(ctx context.Context, host string) error {
+		for _, allowed := range hosts {
+			if allowed != "" && host == allowed {
+				return nil
+			}
+		}
+		if host == "" {
+			return errors.New("acme/autocert: empty host")
+		}
+		if _, err := sites.GetByHostname(ctx, host); err == nil {
+			return nil
+		}
+		if _, err := userDomains.GetVerified(ctx, host); err == nil {
+			return nil
+		}
+		return fmt.Errorf("acme/autocert: host %q not configured", host)
+	}
+}
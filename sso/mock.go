@@ -0,0 +1,210 @@
+package sso
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// MockProvider is an identity provider for development and tests. Its login
+// page asks for any username and email and vouches for them, without
+// passwords.
+type MockProvider struct {
+	// Issuer is the URL the provider is served at.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	claims    Claims
+	nonce     string
+	challenge string
+	redirect  string
+	expires   time.Time
+}
+
+const mockKeyID = "mock"
+
+func NewMockProvider(issuer string, clientID string, clientSecret string) (*MockProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &MockProvider{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		codes:        map[string]mockCode{},
+	}, nil
+}
+
+func (m *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		m.discovery(w)
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r)
+	case "/jwks":
+		m.jwks(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (m *MockProvider) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                m.Issuer,
+		"authorization_endpoint":                m.Issuer + "/authorize",
+		"token_endpoint":                        m.Issuer + "/token",
+		"jwks_uri":                              m.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *MockProvider) jwks(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+var mockLoginPage = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<title>Mock identity provider</title>
+<h1>Mock identity provider</h1>
+<form method="POST">
+<input name="username" placeholder="Username" required><br>
+<input name="email" type="email" placeholder="Email"><br>
+<button type="submit">Log in</button>
+</form>
+`))
+
+// authorize shows the login page, and redirects back to the client with a
+// code for the identity entered in it.
+func (m *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != m.ClientID || query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodPost {
+		mockLoginPage.Execute(w, nil)
+		return
+	}
+
+	username := r.FormValue("username")
+	if username == "" {
+		http.Error(w, "missing username", http.StatusBadRequest)
+		return
+	}
+	code := oauth2.GenerateVerifier()
+	m.mu.Lock()
+	m.codes[code] = mockCode{
+		claims: Claims{
+			Subject:           "mock|" + username,
+			Email:             r.FormValue("email"),
+			EmailVerified:     r.FormValue("email") != "",
+			PreferredUsername: username,
+			Name:              username,
+		},
+		nonce:     query.Get("nonce"),
+		challenge: query.Get("code_challenge"),
+		redirect:  query.Get("redirect_uri"),
+		expires:   time.Now().Add(time.Minute),
+	}
+	m.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token trades a code for a signed ID token, checking the client
+// credentials and the PKCE verifier.
+func (m *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+	if clientID != m.ClientID || clientSecret != m.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	m.mu.Lock()
+	code, ok := m.codes[r.FormValue("code")]
+	delete(m.codes, r.FormValue("code"))
+	m.mu.Unlock()
+	challenge := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || time.Now().After(code.expires) || r.FormValue("grant_type") != "authorization_code" ||
+		r.FormValue("redirect_uri") != code.redirect || base64.RawURLEncoding.EncodeToString(challenge[:]) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                m.Issuer,
+		"sub":                code.claims.Subject,
+		"aud":                m.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              code.nonce,
+		"email":              code.claims.Email,
+		"email_verified":     code.claims.EmailVerified,
+		"preferred_username": code.claims.PreferredUsername,
+		"name":               code.claims.Name,
+	})
+	token.Header["kid"] = mockKeyID
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": oauth2.GenerateVerifier(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
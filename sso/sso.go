@@ -0,0 +1,133 @@
+// Package sso logs users in with an external OpenID Connect identity
+// provider, using the authorization code flow with PKCE.
+package sso
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Config identifies backyard to the identity provider.
+type Config struct {
+	// Issuer is the URL the discovery document is fetched from, with
+	// /.well-known/openid-configuration appended.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Name is the provider name shown on the login button.
+	Name string
+	// AutoProvision creates an account the first time someone logs in with
+	// an identity not linked to any user.
+	AutoProvision bool
+}
+
+// Claims are the facts about the user asserted by the ID token.
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// Provider is a configured identity provider. Its discovery document is
+// fetched on first use, so backyard starts even if the provider is down.
+type Provider struct {
+	Config Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewProvider(config Config) *Provider {
+	return &Provider{Config: config}
+}
+
+func (p *Provider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, p.Config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *Provider) oauth2Config(provider *oidc.Provider, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.Config.ClientID,
+		ClientSecret: p.Config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+}
+
+// Request is a login started with the identity provider. It is kept by the
+// browser until the provider redirects back.
+type Request struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewRequest returns a login with fresh random values.
+func NewRequest() Request {
+	return Request{
+		State:    oauth2.GenerateVerifier(),
+		Nonce:    oauth2.GenerateVerifier(),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+}
+
+// AuthCodeURL returns the URL of the provider login page, which redirects
+// back to redirectURL.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURL string, r Request) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(provider, redirectURL).AuthCodeURL(r.State, oidc.Nonce(r.Nonce), oauth2.S256ChallengeOption(r.Verifier)), nil
+}
+
+var ErrNonce = errors.New("ID token nonce does not match")
+
+// Exchange trades the code the provider redirected back with for an ID
+// token, and returns its claims once its signature, issuer, audience, expiry
+// and nonce are verified.
+func (p *Provider) Exchange(ctx context.Context, redirectURL string, r Request, code string) (Claims, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	token, err := p.oauth2Config(provider, redirectURL).Exchange(ctx, code, oauth2.VerifierOption(r.Verifier))
+	if err != nil {
+		return Claims{}, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Claims{}, errors.New("token response has no ID token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.Config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return Claims{}, err
+	}
+	if idToken.Nonce != r.Nonce {
+		return Claims{}, ErrNonce
+	}
+	claims := Claims{}
+	if err := idToken.Claims(&claims); err != nil {
+		return Claims{}, err
+	}
+	return claims, nil
+}
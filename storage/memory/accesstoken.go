@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type AccessTokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[string]domain.AccessToken
+}
+
+func NewAccessTokenRepository() *AccessTokenRepository {
+	return &AccessTokenRepository{tokens: map[string]domain.AccessToken{}}
+}
+
+func (r *AccessTokenRepository) ListByUser(ctx context.Context, siteID string, userID string) ([]domain.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tokens := []domain.AccessToken{}
+	for _, t := range r.tokens {
+		if t.SiteID == siteID && t.UserID == userID && t.RevokedAt == nil {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (r *AccessTokenRepository) GetByHash(ctx context.Context, siteID string, hash string) (domain.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, t := range r.tokens {
+		if t.SiteID == siteID && t.Hash == hash && t.RevokedAt == nil {
+			return t, nil
+		}
+	}
+	return domain.AccessToken{}, domain.ErrNotFound
+}
+
+func (r *AccessTokenRepository) Create(ctx context.Context, t domain.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.Scopes = slices.Clone(t.Scopes)
+	t.CreatedAt = time.Now().UTC()
+	r.tokens[t.ID] = t
+	return nil
+}
+
+func (r *AccessTokenRepository) Touch(ctx context.Context, id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	usedAt = usedAt.UTC()
+	t.LastUsedAt = &usedAt
+	r.tokens[id] = t
+	return nil
+}
+
+func (r *AccessTokenRepository) Revoke(ctx context.Context, siteID string, userID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[id]
+	if !ok || t.SiteID != siteID || t.UserID != userID || t.RevokedAt != nil {
+		return domain.ErrNotFound
+	}
+	now := time.Now().UTC()
+	t.RevokedAt = &now
+	r.tokens[id] = t
+	return nil
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sync"
+	"time"
+)
+
+type ConfigRepository struct {
+	mu      sync.RWMutex
+	configs []domain.Config
+}
+
+// NewConfigRepository returns a repository whose active configurations are
+// initial, usually one per site.
+func NewConfigRepository(initial ...domain.Config) *ConfigRepository {
+	now := time.Now().UTC()
+	configs := []domain.Config{}
+	for _, c := range initial {
+		c.Active = true
+		c.CreatedAt = now
+		c.UpdatedAt = now
+		configs = append(configs, c)
+	}
+	return &ConfigRepository{configs: configs}
+}
+
+func (r *ConfigRepository) GetActive(ctx context.Context, siteID string) (domain.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.configs) - 1; i >= 0; i-- {
+		if r.configs[i].SiteID == siteID && r.configs[i].Active {
+			return r.configs[i], nil
+		}
+	}
+	return domain.Config{}, domain.ErrNotFound
+}
+
+func (r *ConfigRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.configs {
+		if c.SiteID == siteID && c.ID == id {
+			return c, nil
+		}
+	}
+	return domain.Config{}, domain.ErrNotFound
+}
+
+func (r *ConfigRepository) List(ctx context.Context, siteID string) ([]domain.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	configs := []domain.Config{}
+	for i := len(r.configs) - 1; i >= 0; i-- {
+		if r.configs[i].SiteID == siteID {
+			configs = append(configs, r.configs[i])
+		}
+	}
+	return configs, nil
+}
+
+func (r *ConfigRepository) Save(ctx context.Context, c domain.Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for i := range r.configs {
+		if r.configs[i].SiteID == c.SiteID && r.configs[i].Active {
+			r.configs[i].Active = false
+			r.configs[i].UpdatedAt = now
+		}
+	}
+	c.Active = true
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	r.configs = append(r.configs, c)
+	return nil
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type IdentityRepository struct {
+	mu         sync.RWMutex
+	identities map[string]domain.Identity
+}
+
+func NewIdentityRepository() *IdentityRepository {
+	return &IdentityRepository{identities: map[string]domain.Identity{}}
+}
+
+func (r *IdentityRepository) GetBySubject(ctx context.Context, siteID string, issuer string, subject string) (domain.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, i := range r.identities {
+		if i.SiteID == siteID && i.Issuer == issuer && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return domain.Identity{}, domain.ErrNotFound
+}
+
+func (r *IdentityRepository) ListByUser(ctx context.Context, userID string) ([]domain.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	identities := []domain.Identity{}
+	for _, i := range r.identities {
+		if i.UserID == userID {
+			identities = append(identities, i)
+		}
+	}
+	sort.Slice(identities, func(a, b int) bool {
+		return identities[a].CreatedAt.Before(identities[b].CreatedAt)
+	})
+	return identities, nil
+}
+
+func (r *IdentityRepository) Create(ctx context.Context, i domain.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i.CreatedAt = time.Now().UTC()
+	i.LastLoginAt = nil
+	r.identities[i.ID] = i
+	return nil
+}
+
+func (r *IdentityRepository) RecordLogin(ctx context.Context, id string, email string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.identities[id]
+	if !ok {
+		return nil
+	}
+	at = at.UTC()
+	i.Email = email
+	i.LastLoginAt = &at
+	r.identities[id] = i
+	return nil
+}
+
+func (r *IdentityRepository) Delete(ctx context.Context, userID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.identities[id]
+	if !ok || i.UserID != userID {
+		return domain.ErrNotFound
+	}
+	delete(r.identities, id)
+	return nil
+}
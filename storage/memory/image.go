@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ImageRepository struct {
+	mu     sync.RWMutex
+	images map[string]domain.Image
+}
+
+func NewImageRepository() *ImageRepository {
+	return &ImageRepository{images: map[string]domain.Image{}}
+}
+
+func (r *ImageRepository) Create(ctx context.Context, i domain.Image) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i.CreatedAt = time.Now().UTC()
+	r.images[i.ID] = i
+	return nil
+}
+
+func (r *ImageRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Image, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i, ok := r.images[id]
+	if !ok || i.SiteID != siteID {
+		return domain.Image{}, domain.ErrNotFound
+	}
+	return i, nil
+}
+
+func (r *ImageRepository) List(ctx context.Context, siteID string) ([]domain.Image, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	images := []domain.Image{}
+	for _, i := range r.images {
+		if i.SiteID != siteID {
+			continue
+		}
+		i.Data = nil
+		images = append(images, i)
+	}
+	sort.Slice(images, func(a, b int) bool {
+		return images[a].CreatedAt.After(images[b].CreatedAt)
+	})
+	return images, nil
+}
+
+// removeUploader gives the images uploaded by userID to reassignTo, or deletes
+// them if it is empty.
+func (r *ImageRepository) removeUploader(siteID string, userID string, reassignTo string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, i := range r.images {
+		if i.SiteID != siteID || i.UserID != userID {
+			continue
+		}
+		if reassignTo == "" {
+			delete(r.images, id)
+		} else {
+			i.UserID = reassignTo
+			r.images[id] = i
+		}
+	}
+}
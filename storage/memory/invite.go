@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type InviteRepository struct {
+	mu       sync.RWMutex
+	invites  map[string]domain.Invite
+	invitees []domain.Invitee
+}
+
+func NewInviteRepository() *InviteRepository {
+	return &InviteRepository{invites: map[string]domain.Invite{}}
+}
+
+func (r *InviteRepository) GetByCode(ctx context.Context, siteID string, code string) (domain.Invite, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i, ok := r.invites[code]
+	if !ok || i.SiteID != siteID {
+		return domain.Invite{}, domain.ErrNotFound
+	}
+	return i, nil
+}
+
+func (r *InviteRepository) ListByCreator(ctx context.Context, siteID string, userID string) ([]domain.Invite, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	invites := []domain.Invite{}
+	for _, i := range r.invites {
+		if i.SiteID == siteID && i.CreatedBy == userID {
+			invites = append(invites, i)
+		}
+	}
+	sort.Slice(invites, func(a, b int) bool {
+		return invites[a].CreatedAt.After(invites[b].CreatedAt)
+	})
+	return invites, nil
+}
+
+func (r *InviteRepository) Create(ctx context.Context, i domain.Invite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i.Uses = 0
+	i.RevokedAt = nil
+	i.CreatedAt = time.Now().UTC()
+	r.invites[i.Code] = i
+	return nil
+}
+
+func (r *InviteRepository) Revoke(ctx context.Context, siteID string, userID string, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.invites[code]
+	if !ok || i.SiteID != siteID || i.CreatedBy != userID || i.RevokedAt != nil {
+		return domain.ErrNotFound
+	}
+	now := time.Now().UTC()
+	i.RevokedAt = &now
+	r.invites[code] = i
+	return nil
+}
+
+func (r *InviteRepository) Redeem(ctx context.Context, siteID string, code string, now time.Time) (domain.Invite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.invites[code]
+	if !ok || i.SiteID != siteID || !i.Usable(now) {
+		return domain.Invite{}, domain.ErrNotFound
+	}
+	i.Uses++
+	r.invites[code] = i
+	return i, nil
+}
+
+func (r *InviteRepository) AddInvitee(ctx context.Context, i domain.Invitee) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i.CreatedAt = time.Now().UTC()
+	r.invitees = append(r.invitees, i)
+	return nil
+}
+
+func (r *InviteRepository) ListInvitees(ctx context.Context, siteID string) ([]domain.Invitee, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	invitees := []domain.Invitee{}
+	for _, i := range r.invitees {
+		if i.SiteID == siteID {
+			invitees = append(invitees, i)
+		}
+	}
+	return invitees, nil
+}
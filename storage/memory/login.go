@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type LoginRepository struct {
+	mu       sync.RWMutex
+	failures map[[2]string]domain.LoginFailure
+	events   []domain.LoginEvent
+}
+
+func NewLoginRepository() *LoginRepository {
+	return &LoginRepository{failures: map[[2]string]domain.LoginFailure{}}
+}
+
+func (r *LoginRepository) GetFailures(ctx context.Context, siteID string, username string) (domain.LoginFailure, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	f, ok := r.failures[[2]string{siteID, username}]
+	if !ok {
+		return domain.LoginFailure{}, domain.ErrNotFound
+	}
+	return f, nil
+}
+
+func (r *LoginRepository) IncrementFailures(ctx context.Context, siteID string, username string) (domain.LoginFailure, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{siteID, username}
+	f, ok := r.failures[key]
+	if !ok {
+		f = domain.LoginFailure{SiteID: siteID, Username: username}
+	}
+	f.Failures++
+	f.UpdatedAt = time.Now().UTC()
+	r.failures[key] = f
+	return f, nil
+}
+
+func (r *LoginRepository) Lock(ctx context.Context, siteID string, username string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{siteID, username}
+	f, ok := r.failures[key]
+	if !ok {
+		return nil
+	}
+	until = until.UTC()
+	f.LockedUntil = &until
+	f.UpdatedAt = time.Now().UTC()
+	r.failures[key] = f
+	return nil
+}
+
+func (r *LoginRepository) ClearFailures(ctx context.Context, siteID string, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.failures, [2]string{siteID, username})
+	return nil
+}
+
+func (r *LoginRepository) ListLocked(ctx context.Context, siteID string) ([]domain.LoginFailure, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	failures := []domain.LoginFailure{}
+	for _, f := range r.failures {
+		if f.SiteID == siteID && f.Locked(now) {
+			failures = append(failures, f)
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].LockedUntil.After(*failures[j].LockedUntil)
+	})
+	return failures, nil
+}
+
+func (r *LoginRepository) AddEvent(ctx context.Context, e domain.LoginEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e.CreatedAt = time.Now().UTC()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *LoginRepository) ListEvents(ctx context.Context, siteID string, limit int) ([]domain.LoginEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []domain.LoginEvent{}
+	for i := len(r.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if r.events[i].SiteID == siteID {
+			events = append(events, r.events[i])
+		}
+	}
+	return events, nil
+}
+
+func (r *LoginRepository) LastLogins(ctx context.Context, siteID string) (map[string]time.Time, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	logins := map[string]time.Time{}
+	for _, e := range r.events {
+		if e.SiteID == siteID && e.Event == domain.LoginEventSuccess && e.UserID != "" && e.CreatedAt.After(logins[e.UserID]) {
+			logins[e.UserID] = e.CreatedAt
+		}
+	}
+	return logins, nil
+}
@@ -0,0 +1,24 @@
+// Package memory implements the domain repositories with in-memory maps. It is
+// meant for tests and is not persisted anywhere.
+package memory
+
+import "backyard/domain"
+
+var (
+	_ domain.PostRepository        = (*PostRepository)(nil)
+	_ domain.UserRepository        = (*UserRepository)(nil)
+	_ domain.ConfigRepository      = (*ConfigRepository)(nil)
+	_ domain.ImageRepository       = (*ImageRepository)(nil)
+	_ domain.SiteRepository        = (*SiteRepository)(nil)
+	_ domain.UserDomainRepository  = (*UserDomainRepository)(nil)
+	_ domain.SessionRepository     = (*SessionRepository)(nil)
+	_ domain.LoginRepository       = (*LoginRepository)(nil)
+	_ domain.UserTokenRepository   = (*UserTokenRepository)(nil)
+	_ domain.TwoFactorRepository   = (*TwoFactorRepository)(nil)
+	_ domain.PasskeyRepository     = (*PasskeyRepository)(nil)
+	_ domain.IdentityRepository    = (*IdentityRepository)(nil)
+	_ domain.InviteRepository      = (*InviteRepository)(nil)
+	_ domain.RoleRepository        = (*RoleRepository)(nil)
+	_ domain.AccessTokenRepository = (*AccessTokenRepository)(nil)
+	_ domain.WebhookRepository     = (*WebhookRepository)(nil)
+)
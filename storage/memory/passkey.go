@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type PasskeyRepository struct {
+	mu       sync.RWMutex
+	passkeys map[string]domain.Passkey
+}
+
+func NewPasskeyRepository() *PasskeyRepository {
+	return &PasskeyRepository{passkeys: map[string]domain.Passkey{}}
+}
+
+func (r *PasskeyRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Passkey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.passkeys[id]
+	if !ok || p.SiteID != siteID {
+		return domain.Passkey{}, domain.ErrNotFound
+	}
+	return p, nil
+}
+
+func (r *PasskeyRepository) ListByUser(ctx context.Context, userID string) ([]domain.Passkey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	passkeys := []domain.Passkey{}
+	for _, p := range r.passkeys {
+		if p.UserID == userID {
+			passkeys = append(passkeys, p)
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool {
+		return passkeys[i].CreatedAt.Before(passkeys[j].CreatedAt)
+	})
+	return passkeys, nil
+}
+
+func (r *PasskeyRepository) Create(ctx context.Context, p domain.Passkey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p.CreatedAt = time.Now().UTC()
+	p.LastUsedAt = nil
+	r.passkeys[p.ID] = p
+	return nil
+}
+
+func (r *PasskeyRepository) Use(ctx context.Context, id string, signCount uint32, backupState bool, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.passkeys[id]
+	if !ok {
+		return nil
+	}
+	usedAt = usedAt.UTC()
+	p.SignCount = signCount
+	p.BackupState = backupState
+	p.LastUsedAt = &usedAt
+	r.passkeys[id] = p
+	return nil
+}
+
+func (r *PasskeyRepository) Delete(ctx context.Context, userID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.passkeys[id]
+	if !ok || p.UserID != userID {
+		return domain.ErrNotFound
+	}
+	delete(r.passkeys, id)
+	return nil
+}
@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type PostRepository struct {
+	mu    sync.RWMutex
+	posts map[string]domain.Post
+	users *UserRepository
+}
+
+// NewPostRepository returns an empty repository. Authors usernames are looked
+// up in users, which may be nil.
+func NewPostRepository(users *UserRepository) *PostRepository {
+	return &PostRepository{posts: map[string]domain.Post{}, users: users}
+}
+
+func (r *PostRepository) withUsername(ctx context.Context, p domain.Post) domain.Post {
+	if r.users == nil {
+		return p
+	}
+	if u, err := r.users.GetByID(ctx, p.Access.UserID); err == nil {
+		p.Access.Username = u.Username
+	}
+	return p
+}
+
+func (r *PostRepository) List(ctx context.Context, siteID string, includeDrafts bool) ([]domain.Post, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	posts := []domain.Post{}
+	for _, p := range r.posts {
+		if p.SiteID != siteID || (p.Draft && !includeDrafts) {
+			continue
+		}
+		posts = append(posts, r.withUsername(ctx, p))
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].UpdatedAt.After(posts[j].UpdatedAt)
+	})
+	return posts, nil
+}
+
+func (r *PostRepository) ListByAuthor(ctx context.Context, siteID string, userID string, includeDrafts bool) ([]domain.Post, error) {
+	all, err := r.List(ctx, siteID, includeDrafts)
+	if err != nil {
+		return nil, err
+	}
+	posts := []domain.Post{}
+	for _, p := range all {
+		if p.Access.UserID == userID && p.Access.Relation == domain.RelationAuthor {
+			posts = append(posts, p)
+		}
+	}
+	return posts, nil
+}
+
+func (r *PostRepository) Search(ctx context.Context, filter domain.PostFilter) ([]domain.Post, error) {
+	all, err := r.List(ctx, filter.SiteID, true)
+	if err != nil {
+		return nil, err
+	}
+	posts := []domain.Post{}
+	for _, p := range all {
+		if matchesPostFilter(p, filter) {
+			posts = append(posts, p)
+		}
+	}
+	if filter.Limit > 0 {
+		posts = posts[min(filter.Offset, len(posts)):min(filter.Offset+filter.Limit, len(posts))]
+	}
+	return posts, nil
+}
+
+func (r *PostRepository) Count(ctx context.Context, filter domain.PostFilter) (int, error) {
+	filter.Limit = 0
+	posts, err := r.Search(ctx, filter)
+	return len(posts), err
+}
+
+func matchesPostFilter(p domain.Post, filter domain.PostFilter) bool {
+	authored := func(userID string) bool {
+		return p.Access.UserID == userID && p.Access.Relation == domain.RelationAuthor
+	}
+	if filter.AuthorID != "" && !authored(filter.AuthorID) {
+		return false
+	}
+	if filter.Tag != "" && !slices.Contains(p.Tags, filter.Tag) {
+		return false
+	}
+	return !p.Draft || filter.AllDrafts || (filter.DraftsOf != "" && authored(filter.DraftsOf))
+}
+
+func (r *PostRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Post, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.posts[id]
+	if !ok || p.SiteID != siteID {
+		return domain.Post{}, domain.ErrNotFound
+	}
+	return r.withUsername(ctx, p), nil
+}
+
+func (r *PostRepository) Create(ctx context.Context, p domain.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	p.Access.Relation = domain.RelationAuthor
+	p.Tags = slices.Clone(p.Tags)
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	r.posts[p.ID] = p
+	return nil
+}
+
+func (r *PostRepository) Update(ctx context.Context, p domain.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.posts[p.ID]
+	if !ok || stored.SiteID != p.SiteID {
+		return domain.ErrNotFound
+	}
+	stored.Title = p.Title
+	stored.Content = p.Content
+	stored.Draft = p.Draft
+	stored.Tags = slices.Clone(p.Tags)
+	stored.UpdatedAt = time.Now().UTC()
+	r.posts[p.ID] = stored
+	return nil
+}
+
+func (r *PostRepository) Delete(ctx context.Context, siteID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.posts[id]
+	if !ok || p.SiteID != siteID {
+		return domain.ErrNotFound
+	}
+	delete(r.posts, id)
+	return nil
+}
+
+func (r *PostRepository) ListTags(ctx context.Context, siteID string) ([]domain.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := map[string]int{}
+	for _, p := range r.posts {
+		if p.SiteID != siteID || p.Draft {
+			continue
+		}
+		for _, tag := range p.Tags {
+			counts[tag]++
+		}
+	}
+	tags := []domain.Tag{}
+	for name, count := range counts {
+		tags = append(tags, domain.Tag{Name: name, Posts: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+func (r *PostRepository) IsAuthor(ctx context.Context, postID string, userID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.posts[postID]
+	return ok && p.Access.UserID == userID && p.Access.Relation == domain.RelationAuthor, nil
+}
+
+func (r *PostRepository) CountAll(ctx context.Context) (int, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	published, drafts := 0, 0
+	for _, p := range r.posts {
+		if p.Draft {
+			drafts++
+		} else {
+			published++
+		}
+	}
+	return published, drafts, nil
+}
+
+func (r *PostRepository) CountByAuthor(ctx context.Context, siteID string, includeDrafts bool) (map[string]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := map[string]int{}
+	for _, p := range r.posts {
+		if p.SiteID == siteID && p.Access.Relation == domain.RelationAuthor && (includeDrafts || !p.Draft) {
+			counts[p.Access.UserID]++
+		}
+	}
+	return counts, nil
+}
+
+// removeAuthor gives the posts written by userID to reassignTo, or deletes
+// them if it is empty.
+func (r *PostRepository) removeAuthor(siteID string, userID string, reassignTo string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, p := range r.posts {
+		if p.SiteID != siteID || p.Access.UserID != userID || p.Access.Relation != domain.RelationAuthor {
+			continue
+		}
+		if reassignTo == "" {
+			delete(r.posts, id)
+		} else {
+			p.Access.UserID = reassignTo
+			r.posts[id] = p
+		}
+	}
+}
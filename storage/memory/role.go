@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type RoleRepository struct {
+	mu    sync.RWMutex
+	roles map[string]domain.Role
+	// userRoles holds the role IDs of each user ID.
+	userRoles map[string][]string
+}
+
+func NewRoleRepository() *RoleRepository {
+	return &RoleRepository{roles: map[string]domain.Role{}, userRoles: map[string][]string{}}
+}
+
+func sortRoles(roles []domain.Role) {
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+}
+
+func (r *RoleRepository) List(ctx context.Context, siteID string) ([]domain.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := []domain.Role{}
+	for _, role := range r.roles {
+		if role.SiteID == siteID {
+			roles = append(roles, role)
+		}
+	}
+	sortRoles(roles)
+	return roles, nil
+}
+
+func (r *RoleRepository) Create(ctx context.Context, role domain.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role.Permissions = slices.Clone(role.Permissions)
+	slices.Sort(role.Permissions)
+	role.CreatedAt = time.Now().UTC()
+	r.roles[role.ID] = role
+	return nil
+}
+
+func (r *RoleRepository) ListByUser(ctx context.Context, userID string) ([]domain.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := []domain.Role{}
+	for _, id := range r.userRoles[userID] {
+		roles = append(roles, r.roles[id])
+	}
+	sortRoles(roles)
+	return roles, nil
+}
+
+func (r *RoleRepository) HasPermission(ctx context.Context, userID string, permission string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, id := range r.userRoles[userID] {
+		if r.roles[id].Allows(permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *RoleRepository) Assign(ctx context.Context, siteID string, userID string, roleName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, role := range r.roles {
+		if role.SiteID == siteID && role.Name == roleName {
+			if !slices.Contains(r.userRoles[userID], role.ID) {
+				r.userRoles[userID] = append(r.userRoles[userID], role.ID)
+			}
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (r *RoleRepository) SetUserRoles(ctx context.Context, siteID string, userID string, roleIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := []string{}
+	for _, id := range roleIDs {
+		if role, ok := r.roles[id]; ok && role.SiteID == siteID && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	r.userRoles[userID] = ids
+	return nil
+}
+
+func (r *RoleRepository) ListUserRoles(ctx context.Context, siteID string) (map[string][]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	userRoles := map[string][]string{}
+	for userID, ids := range r.userRoles {
+		for _, id := range ids {
+			if r.roles[id].SiteID == siteID {
+				userRoles[userID] = append(userRoles[userID], id)
+			}
+		}
+	}
+	return userRoles, nil
+}
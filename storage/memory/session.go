@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type SessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]domain.Session
+}
+
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{sessions: map[string]domain.Session{}}
+}
+
+func (r *SessionRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.sessions[id]
+	if !ok || s.SiteID != siteID {
+		return domain.Session{}, domain.ErrNotFound
+	}
+	return s, nil
+}
+
+func (r *SessionRepository) ListByUser(ctx context.Context, siteID string, userID string) ([]domain.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now().UTC()
+	sessions := []domain.Session{}
+	for _, s := range r.sessions {
+		if s.SiteID == siteID && s.UserID == userID && s.Live(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (r *SessionRepository) Create(ctx context.Context, s domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	s.CreatedAt = now
+	s.LastSeenAt = now
+	s.RevokedAt = nil
+	r.sessions[s.ID] = s
+	return nil
+}
+
+func (r *SessionRepository) Touch(ctx context.Context, siteID string, id string, lastSeen time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || s.SiteID != siteID {
+		return nil
+	}
+	s.LastSeenAt = lastSeen.UTC()
+	r.sessions[id] = s
+	return nil
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, siteID string, userID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || s.SiteID != siteID || s.UserID != userID || s.RevokedAt != nil {
+		return domain.ErrNotFound
+	}
+	now := time.Now().UTC()
+	s.RevokedAt = &now
+	r.sessions[id] = s
+	return nil
+}
+
+func (r *SessionRepository) RevokeAll(ctx context.Context, siteID string, userID string, keepID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, s := range r.sessions {
+		if s.SiteID == siteID && s.UserID == userID && id != keepID && s.RevokedAt == nil {
+			s.RevokedAt = &now
+			r.sessions[id] = s
+		}
+	}
+	return nil
+}
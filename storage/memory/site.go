@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type SiteRepository struct {
+	mu      sync.RWMutex
+	sites   map[string]domain.Site
+	users   *UserRepository
+	roles   *RoleRepository
+	configs *ConfigRepository
+}
+
+// NewSiteRepository returns a repository holding only the default site.
+// Provision creates the admin, roles and configuration of new sites in users,
+// roles and configs.
+func NewSiteRepository(users *UserRepository, roles *RoleRepository, configs *ConfigRepository) *SiteRepository {
+	return &SiteRepository{
+		sites: map[string]domain.Site{
+			domain.DefaultSiteID: {ID: domain.DefaultSiteID},
+		},
+		users:   users,
+		roles:   roles,
+		configs: configs,
+	}
+}
+
+func (r *SiteRepository) GetByID(ctx context.Context, id string) (domain.Site, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.sites[id]
+	if !ok {
+		return domain.Site{}, domain.ErrNotFound
+	}
+	return s, nil
+}
+
+func (r *SiteRepository) GetByHostname(ctx context.Context, hostname string) (domain.Site, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.sites {
+		if s.Hostname == hostname {
+			return s, nil
+		}
+	}
+	return domain.Site{}, domain.ErrNotFound
+}
+
+func (r *SiteRepository) List(ctx context.Context) ([]domain.Site, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sites := []domain.Site{}
+	for _, s := range r.sites {
+		sites = append(sites, s)
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		return sites[i].Hostname < sites[j].Hostname
+	})
+	return sites, nil
+}
+
+func (r *SiteRepository) Create(ctx context.Context, s domain.Site) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	r.sites[s.ID] = s
+	return nil
+}
+
+// Provision checks the hostname is free before creating anything, as it is
+// the only reason creating them may fail.
+func (r *SiteRepository) Provision(ctx context.Context, s domain.NewSite) error {
+	if _, err := r.GetByHostname(ctx, s.Site.Hostname); err == nil {
+		return fmt.Errorf("site %s already exists", s.Site.Hostname)
+	}
+
+	s.Admin.SiteID = s.Site.ID
+	if err := r.users.Create(ctx, s.Admin); err != nil {
+		return err
+	}
+	for _, role := range s.Roles {
+		role.SiteID = s.Site.ID
+		if err := r.roles.Create(ctx, role); err != nil {
+			return err
+		}
+	}
+	if err := r.roles.Assign(ctx, s.Site.ID, s.Admin.ID, domain.RoleAdmin); err != nil {
+		return err
+	}
+	s.Config.SiteID = s.Site.ID
+	if err := r.configs.Save(ctx, s.Config); err != nil {
+		return err
+	}
+	return r.Create(ctx, s.Site)
+}
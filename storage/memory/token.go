@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sync"
+	"time"
+)
+
+type UserTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]domain.UserToken
+}
+
+func NewUserTokenRepository() *UserTokenRepository {
+	return &UserTokenRepository{tokens: map[string]domain.UserToken{}}
+}
+
+func (r *UserTokenRepository) Create(ctx context.Context, t domain.UserToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.CreatedAt = time.Now().UTC()
+	t.UsedAt = nil
+	r.tokens[t.Hash] = t
+	return nil
+}
+
+func (r *UserTokenRepository) Get(ctx context.Context, siteID string, purpose string, hash string) (domain.UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[hash]
+	if !ok || t.SiteID != siteID || t.Purpose != purpose || !t.Usable(time.Now()) {
+		return domain.UserToken{}, domain.ErrNotFound
+	}
+	return t, nil
+}
+
+func (r *UserTokenRepository) Consume(ctx context.Context, siteID string, purpose string, hash string) (domain.UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[hash]
+	if !ok || t.SiteID != siteID || t.Purpose != purpose || !t.Usable(time.Now()) {
+		return domain.UserToken{}, domain.ErrNotFound
+	}
+	now := time.Now().UTC()
+	t.UsedAt = &now
+	r.tokens[hash] = t
+	return t, nil
+}
@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sync"
+	"time"
+)
+
+type TwoFactorRepository struct {
+	mu sync.Mutex
+	// codes maps user IDs to their unused recovery code hashes.
+	codes   map[string]map[string]bool
+	secrets map[string]domain.TwoFactor
+}
+
+func NewTwoFactorRepository() *TwoFactorRepository {
+	return &TwoFactorRepository{
+		codes:   map[string]map[string]bool{},
+		secrets: map[string]domain.TwoFactor{},
+	}
+}
+
+func (r *TwoFactorRepository) Get(ctx context.Context, userID string) (domain.TwoFactor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.secrets[userID]
+	if !ok {
+		return domain.TwoFactor{}, domain.ErrNotFound
+	}
+	return t, nil
+}
+
+func (r *TwoFactorRepository) SavePending(ctx context.Context, t domain.TwoFactor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.EnabledAt = nil
+	t.LastStep = 0
+	t.CreatedAt = time.Now().UTC()
+	r.secrets[t.UserID] = t
+	return nil
+}
+
+func (r *TwoFactorRepository) Enable(ctx context.Context, userID string, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.secrets[userID]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	now := time.Now().UTC()
+	t.EnabledAt = &now
+	r.secrets[userID] = t
+	r.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (r *TwoFactorRepository) replaceRecoveryCodes(userID string, codeHashes []string) {
+	codes := map[string]bool{}
+	for _, hash := range codeHashes {
+		codes[hash] = true
+	}
+	r.codes[userID] = codes
+}
+
+func (r *TwoFactorRepository) Delete(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.secrets, userID)
+	delete(r.codes, userID)
+	return nil
+}
+
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID string, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.secrets[userID]
+	if !ok || t.LastStep >= step {
+		return domain.ErrNotFound
+	}
+	t.LastStep = step
+	r.secrets[userID] = t
+	return nil
+}
+
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID string, codeHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.codes[userID][codeHash] {
+		return domain.ErrNotFound
+	}
+	delete(r.codes[userID], codeHash)
+	return nil
+}
+
+func (r *TwoFactorRepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.codes[userID]), nil
+}
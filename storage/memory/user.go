@@ -0,0 +1,334 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type UserRepository struct {
+	mu    sync.RWMutex
+	users map[string]domain.User
+	// redirects holds the user ID each previous username, keyed by site ID
+	// and username, redirects to.
+	redirects map[[2]string]string
+	// posts and images hold the content Delete removes with users, if set.
+	posts  *PostRepository
+	images *ImageRepository
+	// roles and invites hold the roles and invites SignUp uses, if set.
+	roles   *RoleRepository
+	invites *InviteRepository
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{users: map[string]domain.User{}, redirects: map[[2]string]string{}}
+}
+
+// SetContent makes Delete give the posts and images of users away, or delete
+// them, like the database does.
+func (r *UserRepository) SetContent(posts *PostRepository, images *ImageRepository) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.posts = posts
+	r.images = images
+}
+
+// SetSignUp makes SignUp give roles and redeem invites.
+func (r *UserRepository) SetSignUp(roles *RoleRepository, invites *InviteRepository) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.roles = roles
+	r.invites = invites
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return domain.User{}, domain.ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *UserRepository) GetByUsername(ctx context.Context, siteID string, username string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.SiteID == siteID && u.Username == username {
+			return u, nil
+		}
+	}
+	return domain.User{}, domain.ErrNotFound
+}
+
+func (r *UserRepository) List(ctx context.Context, siteID string) ([]domain.User, error) {
+	return r.Search(ctx, domain.UserFilter{SiteID: siteID})
+}
+
+func (r *UserRepository) Search(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []domain.User{}
+	for _, u := range r.users {
+		if u.SiteID != filter.SiteID {
+			continue
+		}
+		if filter.Query != "" && !strings.Contains(u.Username, filter.Query) && (u.Email == nil || !strings.Contains(*u.Email, filter.Query)) {
+			continue
+		}
+		if (filter.Status == domain.UserStatusActive && u.SuspendedAt != nil) || (filter.Status == domain.UserStatusSuspended && u.SuspendedAt == nil) {
+			continue
+		}
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (r *UserRepository) UsernameExists(ctx context.Context, siteID string, username string) (bool, error) {
+	_, err := r.GetByUsername(ctx, siteID, username)
+	if err == domain.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, siteID string, email string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.SiteID == siteID && u.Email != nil && *u.Email == email {
+			return u, nil
+		}
+	}
+	return domain.User{}, domain.ErrNotFound
+}
+
+func (r *UserRepository) EmailExists(ctx context.Context, siteID string, email string) (bool, error) {
+	_, err := r.GetByEmail(ctx, siteID, email)
+	if err == domain.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *UserRepository) Create(ctx context.Context, u domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	r.users[u.ID] = u
+	return nil
+}
+
+// SignUp checks the invite and the role before creating the user, so nothing
+// is left behind when they cannot be used.
+func (r *UserRepository) SignUp(ctx context.Context, s domain.SignUp, now time.Time) error {
+	r.mu.RLock()
+	roles, invites := r.roles, r.invites
+	r.mu.RUnlock()
+
+	u := s.User
+	siteRoles, err := roles.List(ctx, u.SiteID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(siteRoles, func(role domain.Role) bool { return role.Name == s.Role }) {
+		return fmt.Errorf("site %s has no %s role", u.SiteID, s.Role)
+	}
+	var invite domain.Invite
+	if s.InviteCode != "" {
+		invite, err = invites.Redeem(ctx, u.SiteID, s.InviteCode, now)
+		if err != nil {
+			return err
+		}
+	}
+	if err := r.Create(ctx, u); err != nil {
+		return err
+	}
+	if err := roles.Assign(ctx, u.SiteID, u.ID, s.Role); err != nil {
+		return err
+	}
+	if s.InviteCode == "" {
+		return nil
+	}
+	return invites.AddInvitee(ctx, domain.Invitee{UserID: u.ID, SiteID: u.SiteID, InviterID: invite.CreatedBy, InviteCode: invite.Code})
+}
+
+func (r *UserRepository) SetLocale(ctx context.Context, id string, locale string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.Locale = locale
+	u.UpdatedAt = time.Now().UTC()
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) SetTheme(ctx context.Context, id string, theme string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.Theme = theme
+	u.UpdatedAt = time.Now().UTC()
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) SetEmail(ctx context.Context, id string, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.Email = &email
+	u.EmailVerifiedAt = nil
+	u.UpdatedAt = time.Now().UTC()
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) SetUsername(ctx context.Context, id string, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	delete(r.redirects, [2]string{u.SiteID, username})
+	r.redirects[[2]string{u.SiteID, u.Username}] = id
+	u.Username = username
+	u.UpdatedAt = time.Now().UTC()
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) GetByPreviousUsername(ctx context.Context, siteID string, username string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[r.redirects[[2]string{siteID, username}]]
+	if !ok {
+		return domain.User{}, domain.ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *UserRepository) SetPassword(ctx context.Context, id string, password string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.Password = password
+	u.PasswordResetRequired = false
+	u.UpdatedAt = time.Now().UTC()
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) SetPasswordResetRequired(ctx context.Context, id string, required bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.PasswordResetRequired = required
+	u.UpdatedAt = time.Now().UTC()
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) SetSuspended(ctx context.Context, id string, suspendedAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.SuspendedAt = suspendedAt
+	u.UpdatedAt = time.Now().UTC()
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string, reassignTo string) error {
+	r.mu.Lock()
+	u, ok := r.users[id]
+	if !ok {
+		r.mu.Unlock()
+		return domain.ErrNotFound
+	}
+	delete(r.users, id)
+	for key, userID := range r.redirects {
+		if userID == id {
+			delete(r.redirects, key)
+		}
+	}
+	posts, images := r.posts, r.images
+	// Posts look usernames up while locked, so they are changed after
+	// unlocking
+	r.mu.Unlock()
+
+	if posts != nil {
+		posts.removeAuthor(u.SiteID, id, reassignTo)
+	}
+	if images != nil {
+		images.removeUploader(u.SiteID, id, reassignTo)
+	}
+	return nil
+}
+
+func (r *UserRepository) SetEmailVerified(ctx context.Context, id string, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.Email == nil || *u.Email != email {
+		return domain.ErrNotFound
+	}
+	now := time.Now().UTC()
+	u.EmailVerifiedAt = &now
+	u.UpdatedAt = now
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) CountAll(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.users), nil
+}
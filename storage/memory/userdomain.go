@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"sync"
+	"time"
+)
+
+type UserDomainRepository struct {
+	mu      sync.RWMutex
+	domains map[string]domain.UserDomain
+}
+
+func NewUserDomainRepository() *UserDomainRepository {
+	return &UserDomainRepository{domains: map[string]domain.UserDomain{}}
+}
+
+func (r *UserDomainRepository) GetByUser(ctx context.Context, userID string) (domain.UserDomain, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d, ok := r.domains[userID]
+	if !ok {
+		return domain.UserDomain{}, domain.ErrNotFound
+	}
+	return d, nil
+}
+
+func (r *UserDomainRepository) GetVerified(ctx context.Context, hostname string) (domain.UserDomain, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, d := range r.domains {
+		if d.Domain == hostname && d.Verified() {
+			return d, nil
+		}
+	}
+	return domain.UserDomain{}, domain.ErrNotFound
+}
+
+func (r *UserDomainRepository) Save(ctx context.Context, d domain.UserDomain) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d.VerifiedAt = nil
+	d.CreatedAt = time.Now().UTC()
+	r.domains[d.UserID] = d
+	return nil
+}
+
+func (r *UserDomainRepository) MarkVerified(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.domains[userID]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	for _, other := range r.domains {
+		if other.UserID != userID && other.Domain == d.Domain && other.Verified() {
+			return domain.ErrDomainNotVerified
+		}
+	}
+	now := time.Now().UTC()
+	d.VerifiedAt = &now
+	r.domains[userID] = d
+	return nil
+}
+
+func (r *UserDomainRepository) Delete(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.domains, userID)
+	return nil
+}
@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"backyard/domain"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type WebhookRepository struct {
+	mu         sync.RWMutex
+	webhooks   map[string]domain.Webhook
+	deliveries map[string]domain.WebhookDelivery
+}
+
+func NewWebhookRepository() *WebhookRepository {
+	return &WebhookRepository{webhooks: map[string]domain.Webhook{}, deliveries: map[string]domain.WebhookDelivery{}}
+}
+
+func (r *WebhookRepository) List(ctx context.Context, siteID string) ([]domain.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := []domain.Webhook{}
+	for _, w := range r.webhooks {
+		if w.SiteID == siteID {
+			w.Events = slices.Clone(w.Events)
+			webhooks = append(webhooks, w)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	w, ok := r.webhooks[id]
+	if !ok || w.SiteID != siteID {
+		return domain.Webhook{}, domain.ErrNotFound
+	}
+	w.Events = slices.Clone(w.Events)
+	return w, nil
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, w domain.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w.Events = slices.Clone(w.Events)
+	w.CreatedAt = time.Now().UTC()
+	r.webhooks[w.ID] = w
+	return nil
+}
+
+func (r *WebhookRepository) Update(ctx context.Context, w domain.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.webhooks[w.ID]
+	if !ok || existing.SiteID != w.SiteID {
+		return domain.ErrNotFound
+	}
+	existing.URL = w.URL
+	existing.Events = slices.Clone(w.Events)
+	existing.Active = w.Active
+	r.webhooks[w.ID] = existing
+	return nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, siteID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.webhooks[id]
+	if !ok || w.SiteID != siteID {
+		return domain.ErrNotFound
+	}
+	delete(r.webhooks, id)
+	for deliveryID, d := range r.deliveries {
+		if d.WebhookID == id {
+			delete(r.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, d domain.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d.Payload = slices.Clone(d.Payload)
+	d.CreatedAt = time.Now().UTC()
+	r.deliveries[d.ID] = d
+	return nil
+}
+
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, webhookID string, limit int) ([]domain.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deliveries := []domain.WebhookDelivery{}
+	for _, d := range r.deliveries {
+		if d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) GetDelivery(ctx context.Context, webhookID string, id string) (domain.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d, ok := r.deliveries[id]
+	if !ok || d.WebhookID != webhookID {
+		return domain.WebhookDelivery{}, domain.ErrNotFound
+	}
+	return d, nil
+}
+
+func (r *WebhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deliveries := []domain.WebhookDelivery{}
+	for _, d := range r.deliveries {
+		if d.Status == domain.DeliveryPending && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(*deliveries[j].NextAttemptAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	next := now.Add(lease)
+	for i, d := range deliveries {
+		d.NextAttemptAt = &next
+		r.deliveries[d.ID] = d
+		deliveries[i] = d
+	}
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, d domain.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.deliveries[d.ID]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	existing.Status = d.Status
+	existing.Attempts = d.Attempts
+	existing.NextAttemptAt = d.NextAttemptAt
+	existing.LastAttemptAt = d.LastAttemptAt
+	existing.ResponseStatus = d.ResponseStatus
+	existing.Error = d.Error
+	r.deliveries[d.ID] = existing
+	return nil
+}
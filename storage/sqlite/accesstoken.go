@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type AccessTokenRepository struct {
+	DB *sql.DB
+}
+
+func NewAccessTokenRepository(db *sql.DB) *AccessTokenRepository {
+	return &AccessTokenRepository{DB: db}
+}
+
+const selectAccessTokens = `select token_id, site_id, user_id, name, hash, scopes, created_at, last_used_at, revoked_at from access_tokens `
+
+func scanAccessToken(s scanner) (domain.AccessToken, error) {
+	t := domain.AccessToken{}
+	var scopes string
+	err := s.Scan(&t.ID, &t.SiteID, &t.UserID, &t.Name, &t.Hash, &scopes, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt)
+	t.Scopes = strings.Fields(scopes)
+	return t, err
+}
+
+func (r *AccessTokenRepository) ListByUser(ctx context.Context, siteID string, userID string) ([]domain.AccessToken, error) {
+	rows, err := r.DB.QueryContext(ctx, selectAccessTokens+"where site_id = ? and user_id = ? and revoked_at is null order by created_at desc", siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []domain.AccessToken{}
+	for rows.Next() {
+		t, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *AccessTokenRepository) GetByHash(ctx context.Context, siteID string, hash string) (domain.AccessToken, error) {
+	t, err := scanAccessToken(r.DB.QueryRowContext(ctx, selectAccessTokens+"where site_id = ? and hash = ? and revoked_at is null", siteID, hash))
+	if err != nil {
+		return domain.AccessToken{}, notFound(err)
+	}
+	return t, nil
+}
+
+func (r *AccessTokenRepository) Create(ctx context.Context, t domain.AccessToken) error {
+	_, err := r.DB.ExecContext(ctx, "insert into access_tokens (token_id, site_id, user_id, name, hash, scopes, created_at) values (?, ?, ?, ?, ?, ?, ?)",
+		t.ID, t.SiteID, t.UserID, t.Name, t.Hash, strings.Join(t.Scopes, " "), time.Now().UTC())
+	return err
+}
+
+func (r *AccessTokenRepository) Touch(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := r.DB.ExecContext(ctx, "update access_tokens set last_used_at = ? where token_id = ?", usedAt.UTC(), id)
+	return err
+}
+
+func (r *AccessTokenRepository) Revoke(ctx context.Context, siteID string, userID string, id string) error {
+	result, err := r.DB.ExecContext(ctx, "update access_tokens set revoked_at = ? where site_id = ? and user_id = ? and token_id = ? and revoked_at is null",
+		time.Now().UTC(), siteID, userID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
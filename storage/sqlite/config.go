@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type ConfigRepository struct {
+	DB *sql.DB
+}
+
+func NewConfigRepository(db *sql.DB) *ConfigRepository {
+	return &ConfigRepository{DB: db}
+}
+
+const selectConfig = `select config_id, site_id, active, backyard_version, title_home, desc_home, image_home, favicon_home, footer_html, theme, custom_css, locale, signup_mode, inviters, admin_user_id, created_by, created_at, updated_at from config `
+
+func scanConfig(s scanner) (domain.Config, error) {
+	c := domain.Config{}
+	err := s.Scan(&c.ID, &c.SiteID, &c.Active, &c.BackyardVersion, &c.Title, &c.Description, &c.ImageHome, &c.Favicon, &c.Footer, &c.Theme, &c.CustomCSS, &c.Locale, &c.SignupMode, &c.Inviters, &c.AdminUserID, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt)
+	return c, err
+}
+
+func (r *ConfigRepository) GetActive(ctx context.Context, siteID string) (domain.Config, error) {
+	c, err := scanConfig(r.DB.QueryRowContext(ctx, selectConfig+"where site_id = ? and active is true order by updated_at desc limit 1", siteID))
+	if err != nil {
+		return domain.Config{}, notFound(err)
+	}
+	return c, nil
+}
+
+func (r *ConfigRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Config, error) {
+	c, err := scanConfig(r.DB.QueryRowContext(ctx, selectConfig+"where site_id = ? and config_id = ?", siteID, id))
+	if err != nil {
+		return domain.Config{}, notFound(err)
+	}
+	return c, nil
+}
+
+func (r *ConfigRepository) List(ctx context.Context, siteID string) ([]domain.Config, error) {
+	rows, err := r.DB.QueryContext(ctx, selectConfig+"where site_id = ? order by created_at desc, rowid desc", siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	configs := []domain.Config{}
+	for rows.Next() {
+		c, err := scanConfig(rows)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+func (r *ConfigRepository) Save(ctx context.Context, c domain.Config) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error in begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "update config set active = false, updated_at = current_timestamp where site_id = ? and active is true", c.SiteID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into config (config_id, site_id, active, backyard_version, title_home, desc_home, image_home, favicon_home, footer_html, theme, custom_css, locale, signup_mode, inviters, admin_user_id, created_by)
+        values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		c.ID, c.SiteID, true, c.BackyardVersion, c.Title, c.Description, c.ImageHome, c.Favicon, c.Footer, c.Theme, c.CustomCSS, c.Locale, c.SignupMode, c.Inviters, c.AdminUserID, c.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error in commit transaction: %v", err)
+	}
+	return nil
+}
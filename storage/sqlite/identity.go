@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type IdentityRepository struct {
+	DB *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) *IdentityRepository {
+	return &IdentityRepository{DB: db}
+}
+
+const selectIdentities = `select identity_id, site_id, user_id, issuer, subject, email, created_at, last_login_at from identities `
+
+func scanIdentity(s scanner) (domain.Identity, error) {
+	i := domain.Identity{}
+	err := s.Scan(&i.ID, &i.SiteID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+	return i, err
+}
+
+func (r *IdentityRepository) GetBySubject(ctx context.Context, siteID string, issuer string, subject string) (domain.Identity, error) {
+	i, err := scanIdentity(r.DB.QueryRowContext(ctx, selectIdentities+"where site_id = ? and issuer = ? and subject = ?", siteID, issuer, subject))
+	if err != nil {
+		return domain.Identity{}, notFound(err)
+	}
+	return i, nil
+}
+
+func (r *IdentityRepository) ListByUser(ctx context.Context, userID string) ([]domain.Identity, error) {
+	rows, err := r.DB.QueryContext(ctx, selectIdentities+"where user_id = ? order by created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []domain.Identity{}
+	for rows.Next() {
+		i, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (r *IdentityRepository) Create(ctx context.Context, i domain.Identity) error {
+	_, err := r.DB.ExecContext(ctx, "insert into identities (identity_id, site_id, user_id, issuer, subject, email, created_at) values (?, ?, ?, ?, ?, ?, ?)",
+		i.ID, i.SiteID, i.UserID, i.Issuer, i.Subject, i.Email, time.Now().UTC())
+	return err
+}
+
+func (r *IdentityRepository) RecordLogin(ctx context.Context, id string, email string, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, "update identities set email = ?, last_login_at = ? where identity_id = ?", email, at.UTC(), id)
+	return err
+}
+
+func (r *IdentityRepository) Delete(ctx context.Context, userID string, id string) error {
+	result, err := r.DB.ExecContext(ctx, "delete from identities where user_id = ? and identity_id = ?", userID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type ImageRepository struct {
+	DB *sql.DB
+}
+
+func NewImageRepository(db *sql.DB) *ImageRepository {
+	return &ImageRepository{DB: db}
+}
+
+func (r *ImageRepository) Create(ctx context.Context, i domain.Image) error {
+	_, err := r.DB.ExecContext(ctx, "insert into images (image_id, site_id, user_id, filename, content_type, data, created_at) values (?, ?, ?, ?, ?, ?, ?)",
+		i.ID, i.SiteID, i.UserID, i.Filename, i.ContentType, i.Data, time.Now().UTC())
+	return err
+}
+
+func (r *ImageRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Image, error) {
+	i := domain.Image{}
+	err := r.DB.QueryRowContext(ctx, "select image_id, site_id, user_id, filename, content_type, data, created_at from images where site_id = ? and image_id = ?", siteID, id).
+		Scan(&i.ID, &i.SiteID, &i.UserID, &i.Filename, &i.ContentType, &i.Data, &i.CreatedAt)
+	if err != nil {
+		return domain.Image{}, notFound(err)
+	}
+	return i, nil
+}
+
+func (r *ImageRepository) List(ctx context.Context, siteID string) ([]domain.Image, error) {
+	rows, err := r.DB.QueryContext(ctx, "select image_id, site_id, user_id, filename, content_type, created_at from images where site_id = ? order by created_at desc", siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []domain.Image{}
+	for rows.Next() {
+		i := domain.Image{}
+		if err := rows.Scan(&i.ID, &i.SiteID, &i.UserID, &i.Filename, &i.ContentType, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, i)
+	}
+	return images, rows.Err()
+}
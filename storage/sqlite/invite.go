@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type InviteRepository struct {
+	DB *sql.DB
+}
+
+func NewInviteRepository(db *sql.DB) *InviteRepository {
+	return &InviteRepository{DB: db}
+}
+
+const selectInvites = `select code, site_id, created_by, max_uses, uses, expires_at, revoked_at, created_at from invites `
+
+func scanInvite(s scanner) (domain.Invite, error) {
+	i := domain.Invite{}
+	err := s.Scan(&i.Code, &i.SiteID, &i.CreatedBy, &i.MaxUses, &i.Uses, &i.ExpiresAt, &i.RevokedAt, &i.CreatedAt)
+	return i, err
+}
+
+func (r *InviteRepository) GetByCode(ctx context.Context, siteID string, code string) (domain.Invite, error) {
+	i, err := scanInvite(r.DB.QueryRowContext(ctx, selectInvites+"where site_id = ? and code = ?", siteID, code))
+	if err != nil {
+		return domain.Invite{}, notFound(err)
+	}
+	return i, nil
+}
+
+func (r *InviteRepository) ListByCreator(ctx context.Context, siteID string, userID string) ([]domain.Invite, error) {
+	rows, err := r.DB.QueryContext(ctx, selectInvites+"where site_id = ? and created_by = ? order by created_at desc", siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []domain.Invite{}
+	for rows.Next() {
+		i, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+func (r *InviteRepository) Create(ctx context.Context, i domain.Invite) error {
+	_, err := r.DB.ExecContext(ctx, "insert into invites (code, site_id, created_by, max_uses, uses, expires_at, created_at) values (?, ?, ?, ?, 0, ?, ?)",
+		i.Code, i.SiteID, i.CreatedBy, i.MaxUses, i.ExpiresAt.UTC(), time.Now().UTC())
+	return err
+}
+
+func (r *InviteRepository) Revoke(ctx context.Context, siteID string, userID string, code string) error {
+	result, err := r.DB.ExecContext(ctx, "update invites set revoked_at = ? where site_id = ? and created_by = ? and code = ? and revoked_at is null",
+		time.Now().UTC(), siteID, userID, code)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *InviteRepository) Redeem(ctx context.Context, siteID string, code string, now time.Time) (domain.Invite, error) {
+	i, err := scanInvite(r.DB.QueryRowContext(ctx, `update invites set uses = uses + 1
+        where site_id = ? and code = ? and revoked_at is null and uses < max_uses and expires_at > ?
+        returning code, site_id, created_by, max_uses, uses, expires_at, revoked_at, created_at`,
+		siteID, code, now.UTC()))
+	if err != nil {
+		return domain.Invite{}, notFound(err)
+	}
+	return i, nil
+}
+
+func (r *InviteRepository) AddInvitee(ctx context.Context, i domain.Invitee) error {
+	_, err := r.DB.ExecContext(ctx, "insert into invitees (user_id, site_id, inviter_id, invite_code, created_at) values (?, ?, ?, ?, ?)",
+		i.UserID, i.SiteID, i.InviterID, i.InviteCode, time.Now().UTC())
+	return err
+}
+
+func (r *InviteRepository) ListInvitees(ctx context.Context, siteID string) ([]domain.Invitee, error) {
+	rows, err := r.DB.QueryContext(ctx, "select user_id, site_id, coalesce(inviter_id, ''), invite_code, created_at from invitees where site_id = ? order by created_at", siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitees := []domain.Invitee{}
+	for rows.Next() {
+		i := domain.Invitee{}
+		if err := rows.Scan(&i.UserID, &i.SiteID, &i.InviterID, &i.InviteCode, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		invitees = append(invitees, i)
+	}
+	return invitees, rows.Err()
+}
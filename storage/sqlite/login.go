@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type LoginRepository struct {
+	DB *sql.DB
+}
+
+func NewLoginRepository(db *sql.DB) *LoginRepository {
+	return &LoginRepository{DB: db}
+}
+
+const selectLoginFailures = `select site_id, username, failures, locked_until, updated_at from login_failures `
+
+func scanLoginFailure(s scanner) (domain.LoginFailure, error) {
+	f := domain.LoginFailure{}
+	err := s.Scan(&f.SiteID, &f.Username, &f.Failures, &f.LockedUntil, &f.UpdatedAt)
+	return f, err
+}
+
+func (r *LoginRepository) GetFailures(ctx context.Context, siteID string, username string) (domain.LoginFailure, error) {
+	f, err := scanLoginFailure(r.DB.QueryRowContext(ctx, selectLoginFailures+"where site_id = ? and username = ?", siteID, username))
+	if err != nil {
+		return domain.LoginFailure{}, notFound(err)
+	}
+	return f, nil
+}
+
+func (r *LoginRepository) IncrementFailures(ctx context.Context, siteID string, username string) (domain.LoginFailure, error) {
+	return scanLoginFailure(r.DB.QueryRowContext(ctx, `insert into login_failures (site_id, username, failures, updated_at) values (?, ?, 1, ?)
+        on conflict (site_id, username) do update set failures = failures + 1, updated_at = excluded.updated_at
+        returning site_id, username, failures, locked_until, updated_at`,
+		siteID, username, time.Now().UTC()))
+}
+
+func (r *LoginRepository) Lock(ctx context.Context, siteID string, username string, until time.Time) error {
+	_, err := r.DB.ExecContext(ctx, "update login_failures set locked_until = ?, updated_at = ? where site_id = ? and username = ?",
+		until.UTC(), time.Now().UTC(), siteID, username)
+	return err
+}
+
+func (r *LoginRepository) ClearFailures(ctx context.Context, siteID string, username string) error {
+	_, err := r.DB.ExecContext(ctx, "delete from login_failures where site_id = ? and username = ?", siteID, username)
+	return err
+}
+
+func (r *LoginRepository) ListLocked(ctx context.Context, siteID string) ([]domain.LoginFailure, error) {
+	rows, err := r.DB.QueryContext(ctx, selectLoginFailures+"where site_id = ? and locked_until > ? order by locked_until desc", siteID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []domain.LoginFailure{}
+	for rows.Next() {
+		f, err := scanLoginFailure(rows)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+func (r *LoginRepository) AddEvent(ctx context.Context, e domain.LoginEvent) error {
+	_, err := r.DB.ExecContext(ctx, "insert into login_events (event_id, site_id, username, user_id, ip, event, actor_id, created_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		e.ID, e.SiteID, e.Username, e.UserID, e.IP, e.Event, e.ActorID, time.Now().UTC())
+	return err
+}
+
+func (r *LoginRepository) ListEvents(ctx context.Context, siteID string, limit int) ([]domain.LoginEvent, error) {
+	rows, err := r.DB.QueryContext(ctx, `select event_id, site_id, username, user_id, ip, event, actor_id, created_at from login_events
+        where site_id = ? order by created_at desc limit ?`, siteID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []domain.LoginEvent{}
+	for rows.Next() {
+		e := domain.LoginEvent{}
+		err := rows.Scan(&e.ID, &e.SiteID, &e.Username, &e.UserID, &e.IP, &e.Event, &e.ActorID, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (r *LoginRepository) LastLogins(ctx context.Context, siteID string) (map[string]time.Time, error) {
+	// With max() SQLite takes the bare created_at column from the row holding
+	// the maximum, keeping its type
+	rows, err := r.DB.QueryContext(ctx, `select user_id, created_at, max(created_at) from login_events
+        where site_id = ? and event = ? and user_id != '' group by user_id`, siteID, domain.LoginEventSuccess)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logins := map[string]time.Time{}
+	for rows.Next() {
+		var userID string
+		var at time.Time
+		var max any
+		if err := rows.Scan(&userID, &at, &max); err != nil {
+			return nil, err
+		}
+		logins[userID] = at
+	}
+	return logins, rows.Err()
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type PasskeyRepository struct {
+	DB *sql.DB
+}
+
+func NewPasskeyRepository(db *sql.DB) *PasskeyRepository {
+	return &PasskeyRepository{DB: db}
+}
+
+const selectPasskeys = `select credential_id, site_id, user_id, name, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, created_at, last_used_at from passkeys `
+
+func scanPasskey(s scanner) (domain.Passkey, error) {
+	p := domain.Passkey{}
+	var transports string
+	err := s.Scan(&p.ID, &p.SiteID, &p.UserID, &p.Name, &p.PublicKey, &p.AttestationType, &p.AAGUID, &p.SignCount, &transports, &p.BackupEligible, &p.BackupState, &p.CreatedAt, &p.LastUsedAt)
+	if transports != "" {
+		p.Transports = strings.Split(transports, ",")
+	}
+	return p, err
+}
+
+func (r *PasskeyRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Passkey, error) {
+	p, err := scanPasskey(r.DB.QueryRowContext(ctx, selectPasskeys+"where site_id = ? and credential_id = ?", siteID, id))
+	if err != nil {
+		return domain.Passkey{}, notFound(err)
+	}
+	return p, nil
+}
+
+func (r *PasskeyRepository) ListByUser(ctx context.Context, userID string) ([]domain.Passkey, error) {
+	rows, err := r.DB.QueryContext(ctx, selectPasskeys+"where user_id = ? order by created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []domain.Passkey{}
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+func (r *PasskeyRepository) Create(ctx context.Context, p domain.Passkey) error {
+	_, err := r.DB.ExecContext(ctx, `insert into passkeys (credential_id, site_id, user_id, name, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, created_at)
+        values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.SiteID, p.UserID, p.Name, p.PublicKey, p.AttestationType, p.AAGUID, p.SignCount, strings.Join(p.Transports, ","), p.BackupEligible, p.BackupState, time.Now().UTC())
+	return err
+}
+
+func (r *PasskeyRepository) Use(ctx context.Context, id string, signCount uint32, backupState bool, usedAt time.Time) error {
+	_, err := r.DB.ExecContext(ctx, "update passkeys set sign_count = ?, backup_state = ?, last_used_at = ? where credential_id = ?", signCount, backupState, usedAt.UTC(), id)
+	return err
+}
+
+func (r *PasskeyRepository) Delete(ctx context.Context, userID string, id string) error {
+	result, err := r.DB.ExecContext(ctx, "delete from passkeys where user_id = ? and credential_id = ?", userID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
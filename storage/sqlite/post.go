@@ -0,0 +1,293 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type PostRepository struct {
+	DB *sql.DB
+}
+
+func NewPostRepository(db *sql.DB) *PostRepository {
+	return &PostRepository{DB: db}
+}
+
+// The only relation supported for now is author, and only one user can be related to the post
+const selectPosts = `select posts.post_id, posts.site_id, posts.title, posts.content, posts.draft, posts.created_at, posts.updated_at,
+        coalesce(users_posts.user_id, ''), coalesce(users_posts.relation_type, ''), coalesce(users.username, '')` + fromPosts
+
+const fromPosts = ` from posts
+        left join users_posts on posts.post_id = users_posts.post_id
+        left join users on users_posts.user_id = users.user_id `
+
+func scanPost(s scanner) (domain.Post, error) {
+	p := domain.Post{}
+	err := s.Scan(&p.ID, &p.SiteID, &p.Title, &p.Content, &p.Draft, &p.CreatedAt, &p.UpdatedAt, &p.Access.UserID, &p.Access.Relation, &p.Access.Username)
+	return p, err
+}
+
+func (r *PostRepository) List(ctx context.Context, siteID string, includeDrafts bool) ([]domain.Post, error) {
+	where := ` where posts.site_id = ? `
+	if !includeDrafts {
+		where += ` and posts.draft = false `
+	}
+	return r.list(ctx, where+newestFirst, siteID)
+}
+
+func (r *PostRepository) ListByAuthor(ctx context.Context, siteID string, userID string, includeDrafts bool) ([]domain.Post, error) {
+	where := ` where posts.site_id = ? and users_posts.user_id = ? and users_posts.relation_type = 'AUTHOR' `
+	if !includeDrafts {
+		where += ` and posts.draft = false `
+	}
+	return r.list(ctx, where+newestFirst, siteID, userID)
+}
+
+func (r *PostRepository) Search(ctx context.Context, filter domain.PostFilter) ([]domain.Post, error) {
+	where, args := postFilter(filter)
+	where += newestFirst
+	if filter.Limit > 0 {
+		where += ` limit ? offset ? `
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	return r.list(ctx, where, args...)
+}
+
+func (r *PostRepository) Count(ctx context.Context, filter domain.PostFilter) (int, error) {
+	where, args := postFilter(filter)
+	var count int
+	err := r.DB.QueryRowContext(ctx, `select count(*)`+fromPosts+where, args...).Scan(&count)
+	return count, err
+}
+
+// postFilter returns the where clause selecting the posts matching the filter
+// and its arguments.
+func postFilter(filter domain.PostFilter) (string, []any) {
+	where := ` where posts.site_id = ? `
+	args := []any{filter.SiteID}
+	if filter.AuthorID != "" {
+		where += ` and users_posts.user_id = ? and users_posts.relation_type = 'AUTHOR' `
+		args = append(args, filter.AuthorID)
+	}
+	if filter.Tag != "" {
+		where += ` and posts.post_id in (select post_id from post_tags where tag = ?) `
+		args = append(args, filter.Tag)
+	}
+	switch {
+	case filter.AllDrafts:
+	case filter.DraftsOf != "":
+		where += ` and (posts.draft = false or (users_posts.user_id = ? and users_posts.relation_type = 'AUTHOR')) `
+		args = append(args, filter.DraftsOf)
+	default:
+		where += ` and posts.draft = false `
+	}
+	return where, args
+}
+
+const newestFirst = ` order by posts.updated_at desc `
+
+// list returns the posts selected by clauses, which follow the joins of
+// selectPosts.
+func (r *PostRepository) list(ctx context.Context, clauses string, args ...any) ([]domain.Post, error) {
+	rows, err := r.DB.QueryContext(ctx, selectPosts+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []domain.Post{}
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Only the tags of the listed posts are read, even for a page of them
+	return posts, r.loadTags(ctx, posts, "post_id in (select posts.post_id"+fromPosts+clauses+")", args...)
+}
+
+// loadTags fills the tags of posts, reading the post_tags rows matching
+// filter.
+func (r *PostRepository) loadTags(ctx context.Context, posts []domain.Post, filter string, args ...any) error {
+	rows, err := r.DB.QueryContext(ctx, "select post_id, tag from post_tags where "+filter+" order by tag", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	index := map[string]int{}
+	for i := range posts {
+		posts[i].Tags = []string{}
+		index[posts[i].ID] = i
+	}
+	for rows.Next() {
+		var postID, tag string
+		if err := rows.Scan(&postID, &tag); err != nil {
+			return err
+		}
+		if i, ok := index[postID]; ok {
+			posts[i].Tags = append(posts[i].Tags, tag)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *PostRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Post, error) {
+	p, err := scanPost(r.DB.QueryRowContext(ctx, selectPosts+` where posts.site_id = ? and posts.post_id = ?`, siteID, id))
+	if err != nil {
+		return domain.Post{}, notFound(err)
+	}
+	posts := []domain.Post{p}
+	err = r.loadTags(ctx, posts, "post_id = ?", id)
+	return posts[0], err
+}
+
+// setTags replaces the tags of a post.
+func setTags(ctx context.Context, tx *sql.Tx, postID string, tags []string) error {
+	_, err := tx.ExecContext(ctx, "delete from post_tags where post_id = ?", postID)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err = tx.ExecContext(ctx, "insert or ignore into post_tags (post_id, tag) values (?, ?)", postID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PostRepository) Create(ctx context.Context, p domain.Post) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error in begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, "insert into posts (post_id, site_id, title, content, draft, created_at, updated_at) values (?,?,?,?,?,?,?)",
+		p.ID, p.SiteID, p.Title, p.Content, p.Draft, now, now)
+	if err != nil {
+		return fmt.Errorf("error executing statement in table posts: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, "insert into users_posts (user_id, post_id, relation_type, created_at, updated_at) values (?, ?, ?, ?, ?)",
+		p.Access.UserID, p.ID, domain.RelationAuthor, now, now)
+	if err != nil {
+		return fmt.Errorf("error executing statement in table users_posts: %v", err)
+	}
+	err = setTags(ctx, tx, p.ID, p.Tags)
+	if err != nil {
+		return fmt.Errorf("error executing statement in table post_tags: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error in commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (r *PostRepository) Update(ctx context.Context, p domain.Post) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update posts set title = ?, content = ?, draft = ?, updated_at = ? where post_id = ? and site_id = ?",
+		p.Title, p.Content, p.Draft, time.Now().UTC(), p.ID, p.SiteID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	err = setTags(ctx, tx, p.ID, p.Tags)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete relies on the foreign keys to delete the author and tags of the post.
+func (r *PostRepository) Delete(ctx context.Context, siteID string, id string) error {
+	result, err := r.DB.ExecContext(ctx, "delete from posts where site_id = ? and post_id = ?", siteID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostRepository) ListTags(ctx context.Context, siteID string) ([]domain.Tag, error) {
+	rows, err := r.DB.QueryContext(ctx, `select post_tags.tag, count(*) from post_tags
+        join posts on posts.post_id = post_tags.post_id
+        where posts.site_id = ? and posts.draft = false group by post_tags.tag order by post_tags.tag`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []domain.Tag{}
+	for rows.Next() {
+		var t domain.Tag
+		if err := rows.Scan(&t.Name, &t.Posts); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (r *PostRepository) IsAuthor(ctx context.Context, postID string, userID string) (bool, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, "select count(*) from users_posts where post_id = ? and user_id = ? and relation_type = ?",
+		postID, userID, domain.RelationAuthor).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *PostRepository) CountAll(ctx context.Context) (int, int, error) {
+	var published, drafts int
+	err := r.DB.QueryRowContext(ctx, "select count(*) filter (where not draft), count(*) filter (where draft) from posts").Scan(&published, &drafts)
+	return published, drafts, err
+}
+
+func (r *PostRepository) CountByAuthor(ctx context.Context, siteID string, includeDrafts bool) (map[string]int, error) {
+	rows, err := r.DB.QueryContext(ctx, `select users_posts.user_id, count(*) from users_posts
+        join posts on posts.post_id = users_posts.post_id
+        where posts.site_id = ? and users_posts.relation_type = ? and (? or posts.draft = false) group by users_posts.user_id`, siteID, domain.RelationAuthor, includeDrafts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var userID string
+		var count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type RoleRepository struct {
+	DB *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) *RoleRepository {
+	return &RoleRepository{DB: db}
+}
+
+const selectRoles = `select roles.role_id, roles.site_id, roles.name, roles.created_at from roles `
+
+// listRoles returns the roles matched by filter, a join and where clause on
+// the roles table, together with their permissions.
+func (r *RoleRepository) listRoles(ctx context.Context, filter string, args ...any) ([]domain.Role, error) {
+	rows, err := r.DB.QueryContext(ctx, selectRoles+filter+" order by roles.name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []domain.Role{}
+	index := map[string]int{}
+	for rows.Next() {
+		role := domain.Role{Permissions: []string{}}
+		if err := rows.Scan(&role.ID, &role.SiteID, &role.Name, &role.CreatedAt); err != nil {
+			return nil, err
+		}
+		index[role.ID] = len(roles)
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.DB.QueryContext(ctx, "select role_id, permission from role_permissions where role_id in (select roles.role_id from roles "+filter+") order by permission", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roleID, permission string
+		if err := rows.Scan(&roleID, &permission); err != nil {
+			return nil, err
+		}
+		if i, ok := index[roleID]; ok {
+			roles[i].Permissions = append(roles[i].Permissions, permission)
+		}
+	}
+	return roles, rows.Err()
+}
+
+func (r *RoleRepository) List(ctx context.Context, siteID string) ([]domain.Role, error) {
+	return r.listRoles(ctx, "where roles.site_id = ?", siteID)
+}
+
+func (r *RoleRepository) Create(ctx context.Context, role domain.Role) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "insert into roles (role_id, site_id, name, created_at) values (?, ?, ?, ?)",
+		role.ID, role.SiteID, role.Name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, permission := range role.Permissions {
+		_, err = tx.ExecContext(ctx, "insert into role_permissions (role_id, permission) values (?, ?)", role.ID, permission)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *RoleRepository) ListByUser(ctx context.Context, userID string) ([]domain.Role, error) {
+	return r.listRoles(ctx, "join user_roles on user_roles.role_id = roles.role_id where user_roles.user_id = ?", userID)
+}
+
+func (r *RoleRepository) HasPermission(ctx context.Context, userID string, permission string) (bool, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, `select count(*) from user_roles
+        join role_permissions on role_permissions.role_id = user_roles.role_id
+        where user_roles.user_id = ? and role_permissions.permission = ?`, userID, permission).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *RoleRepository) Assign(ctx context.Context, siteID string, userID string, roleName string) error {
+	result, err := r.DB.ExecContext(ctx, `insert or ignore into user_roles (user_id, role_id)
+        select ?, role_id from roles where site_id = ? and name = ?`, userID, siteID, roleName)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *RoleRepository) SetUserRoles(ctx context.Context, siteID string, userID string, roleIDs []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "delete from user_roles where user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	for _, roleID := range roleIDs {
+		_, err = tx.ExecContext(ctx, `insert or ignore into user_roles (user_id, role_id)
+            select ?, role_id from roles where site_id = ? and role_id = ?`, userID, siteID, roleID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *RoleRepository) ListUserRoles(ctx context.Context, siteID string) (map[string][]string, error) {
+	rows, err := r.DB.QueryContext(ctx, `select user_roles.user_id, user_roles.role_id from user_roles
+        join roles on roles.role_id = user_roles.role_id
+        where roles.site_id = ? order by roles.name`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userRoles := map[string][]string{}
+	for rows.Next() {
+		var userID, roleID string
+		if err := rows.Scan(&userID, &roleID); err != nil {
+			return nil, err
+		}
+		userRoles[userID] = append(userRoles[userID], roleID)
+	}
+	return userRoles, rows.Err()
+}
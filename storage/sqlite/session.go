@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SessionRepository struct {
+	DB *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{DB: db}
+}
+
+const selectSessions = `select session_id, site_id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at from sessions `
+
+func scanSession(s scanner) (domain.Session, error) {
+	session := domain.Session{}
+	err := s.Scan(&session.ID, &session.SiteID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt)
+	return session, err
+}
+
+func (r *SessionRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Session, error) {
+	s, err := scanSession(r.DB.QueryRowContext(ctx, selectSessions+"where site_id = ? and session_id = ?", siteID, id))
+	if err != nil {
+		return domain.Session{}, notFound(err)
+	}
+	return s, nil
+}
+
+func (r *SessionRepository) ListByUser(ctx context.Context, siteID string, userID string) ([]domain.Session, error) {
+	rows, err := r.DB.QueryContext(ctx, selectSessions+"where site_id = ? and user_id = ? and revoked_at is null and expires_at > ? order by last_seen_at desc",
+		siteID, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []domain.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionRepository) Create(ctx context.Context, s domain.Session) error {
+	now := time.Now().UTC()
+	_, err := r.DB.ExecContext(ctx, "insert into sessions (session_id, site_id, user_id, user_agent, ip, created_at, last_seen_at, expires_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		s.ID, s.SiteID, s.UserID, s.UserAgent, s.IP, now, now, s.ExpiresAt.UTC())
+	return err
+}
+
+func (r *SessionRepository) Touch(ctx context.Context, siteID string, id string, lastSeen time.Time) error {
+	_, err := r.DB.ExecContext(ctx, "update sessions set last_seen_at = ? where site_id = ? and session_id = ?", lastSeen.UTC(), siteID, id)
+	return err
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, siteID string, userID string, id string) error {
+	result, err := r.DB.ExecContext(ctx, "update sessions set revoked_at = ? where site_id = ? and user_id = ? and session_id = ? and revoked_at is null",
+		time.Now().UTC(), siteID, userID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *SessionRepository) RevokeAll(ctx context.Context, siteID string, userID string, keepID string) error {
+	_, err := r.DB.ExecContext(ctx, "update sessions set revoked_at = ? where site_id = ? and user_id = ? and session_id != ? and revoked_at is null",
+		time.Now().UTC(), siteID, userID, keepID)
+	return err
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SiteRepository struct {
+	DB *sql.DB
+}
+
+func NewSiteRepository(db *sql.DB) *SiteRepository {
+	return &SiteRepository{DB: db}
+}
+
+const selectSites = `select site_id, hostname, enable_signup, created_at, updated_at from sites `
+
+func scanSite(s scanner) (domain.Site, error) {
+	site := domain.Site{}
+	err := s.Scan(&site.ID, &site.Hostname, &site.EnableSignup, &site.CreatedAt, &site.UpdatedAt)
+	return site, err
+}
+
+func (r *SiteRepository) GetByID(ctx context.Context, id string) (domain.Site, error) {
+	s, err := scanSite(r.DB.QueryRowContext(ctx, selectSites+"where site_id = ?", id))
+	if err != nil {
+		return domain.Site{}, notFound(err)
+	}
+	return s, nil
+}
+
+func (r *SiteRepository) GetByHostname(ctx context.Context, hostname string) (domain.Site, error) {
+	s, err := scanSite(r.DB.QueryRowContext(ctx, selectSites+"where hostname = ?", hostname))
+	if err != nil {
+		return domain.Site{}, notFound(err)
+	}
+	return s, nil
+}
+
+func (r *SiteRepository) List(ctx context.Context) ([]domain.Site, error) {
+	rows, err := r.DB.QueryContext(ctx, selectSites+"order by hostname")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sites := []domain.Site{}
+	for rows.Next() {
+		s, err := scanSite(rows)
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, s)
+	}
+	return sites, rows.Err()
+}
+
+func (r *SiteRepository) Create(ctx context.Context, s domain.Site) error {
+	now := time.Now().UTC()
+	_, err := r.DB.ExecContext(ctx, "insert into sites (site_id, hostname, enable_signup, created_at, updated_at) values (?, ?, ?, ?, ?)",
+		s.ID, s.Hostname, s.EnableSignup, now, now)
+	return err
+}
+
+func (r *SiteRepository) Provision(ctx context.Context, s domain.NewSite) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, "insert into sites (site_id, hostname, enable_signup, created_at, updated_at) values (?, ?, ?, ?, ?)",
+		s.Site.ID, s.Site.Hostname, s.Site.EnableSignup, now, now)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "insert into users (user_id, site_id, username, email, password, locale, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		s.Admin.ID, s.Site.ID, s.Admin.Username, s.Admin.Email, s.Admin.Password, s.Admin.Locale, now, now)
+	if err != nil {
+		return err
+	}
+	for _, role := range s.Roles {
+		_, err = tx.ExecContext(ctx, "insert into roles (role_id, site_id, name, created_at) values (?, ?, ?, ?)",
+			role.ID, s.Site.ID, role.Name, now)
+		if err != nil {
+			return err
+		}
+		for _, permission := range role.Permissions {
+			_, err = tx.ExecContext(ctx, "insert into role_permissions (role_id, permission) values (?, ?)", role.ID, permission)
+			if err != nil {
+				return err
+			}
+		}
+		if role.Name == domain.RoleAdmin {
+			_, err = tx.ExecContext(ctx, "insert into user_roles (user_id, role_id) values (?, ?)", s.Admin.ID, role.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	c := s.Config
+	_, err = tx.ExecContext(ctx, `insert into config (config_id, site_id, active, backyard_version, title_home, desc_home, image_home, favicon_home, footer_html, theme, custom_css, locale, signup_mode, inviters, admin_user_id, created_by)
+        values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		c.ID, s.Site.ID, true, c.BackyardVersion, c.Title, c.Description, c.ImageHome, c.Favicon, c.Footer, c.Theme, c.CustomCSS, c.Locale, c.SignupMode, c.Inviters, c.AdminUserID, c.CreatedBy)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
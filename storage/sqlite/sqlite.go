@@ -0,0 +1,39 @@
+// Package sqlite implements the domain repositories on top of a SQLite database.
+package sqlite
+
+import (
+	"backyard/domain"
+	"database/sql"
+	"errors"
+)
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrNotFound
+	}
+	return err
+}
+
+var (
+	_ domain.PostRepository        = (*PostRepository)(nil)
+	_ domain.UserRepository        = (*UserRepository)(nil)
+	_ domain.ConfigRepository      = (*ConfigRepository)(nil)
+	_ domain.ImageRepository       = (*ImageRepository)(nil)
+	_ domain.SiteRepository        = (*SiteRepository)(nil)
+	_ domain.UserDomainRepository  = (*UserDomainRepository)(nil)
+	_ domain.SessionRepository     = (*SessionRepository)(nil)
+	_ domain.LoginRepository       = (*LoginRepository)(nil)
+	_ domain.UserTokenRepository   = (*UserTokenRepository)(nil)
+	_ domain.TwoFactorRepository   = (*TwoFactorRepository)(nil)
+	_ domain.PasskeyRepository     = (*PasskeyRepository)(nil)
+	_ domain.IdentityRepository    = (*IdentityRepository)(nil)
+	_ domain.InviteRepository      = (*InviteRepository)(nil)
+	_ domain.RoleRepository        = (*RoleRepository)(nil)
+	_ domain.AccessTokenRepository = (*AccessTokenRepository)(nil)
+	_ domain.WebhookRepository     = (*WebhookRepository)(nil)
+)
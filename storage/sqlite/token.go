@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type UserTokenRepository struct {
+	DB *sql.DB
+}
+
+func NewUserTokenRepository(db *sql.DB) *UserTokenRepository {
+	return &UserTokenRepository{DB: db}
+}
+
+const selectUserTokens = `select token_hash, site_id, user_id, purpose, email, expires_at, used_at, created_at from user_tokens `
+
+func scanUserToken(s scanner) (domain.UserToken, error) {
+	t := domain.UserToken{}
+	err := s.Scan(&t.Hash, &t.SiteID, &t.UserID, &t.Purpose, &t.Email, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	return t, err
+}
+
+func (r *UserTokenRepository) Create(ctx context.Context, t domain.UserToken) error {
+	_, err := r.DB.ExecContext(ctx, "insert into user_tokens (token_hash, site_id, user_id, purpose, email, expires_at, created_at) values (?, ?, ?, ?, ?, ?, ?)",
+		t.Hash, t.SiteID, t.UserID, t.Purpose, t.Email, t.ExpiresAt.UTC(), time.Now().UTC())
+	return err
+}
+
+func (r *UserTokenRepository) Get(ctx context.Context, siteID string, purpose string, hash string) (domain.UserToken, error) {
+	t, err := scanUserToken(r.DB.QueryRowContext(ctx, selectUserTokens+"where site_id = ? and purpose = ? and token_hash = ? and used_at is null and expires_at > ?",
+		siteID, purpose, hash, time.Now().UTC()))
+	if err != nil {
+		return domain.UserToken{}, notFound(err)
+	}
+	return t, nil
+}
+
+func (r *UserTokenRepository) Consume(ctx context.Context, siteID string, purpose string, hash string) (domain.UserToken, error) {
+	now := time.Now().UTC()
+	t, err := scanUserToken(r.DB.QueryRowContext(ctx, `update user_tokens set used_at = ?
+        where site_id = ? and purpose = ? and token_hash = ? and used_at is null and expires_at > ?
+        returning token_hash, site_id, user_id, purpose, email, expires_at, used_at, created_at`,
+		now, siteID, purpose, hash, now))
+	if err != nil {
+		return domain.UserToken{}, notFound(err)
+	}
+	return t, nil
+}
@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type TwoFactorRepository struct {
+	DB *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{DB: db}
+}
+
+func (r *TwoFactorRepository) Get(ctx context.Context, userID string) (domain.TwoFactor, error) {
+	t := domain.TwoFactor{}
+	err := r.DB.QueryRowContext(ctx, "select user_id, secret, enabled_at, last_step, created_at from two_factor where user_id = ?", userID).
+		Scan(&t.UserID, &t.Secret, &t.EnabledAt, &t.LastStep, &t.CreatedAt)
+	if err != nil {
+		return domain.TwoFactor{}, notFound(err)
+	}
+	return t, nil
+}
+
+func (r *TwoFactorRepository) SavePending(ctx context.Context, t domain.TwoFactor) error {
+	_, err := r.DB.ExecContext(ctx, `insert into two_factor (user_id, secret, enabled_at, last_step, created_at) values (?, ?, null, 0, ?)
+        on conflict (user_id) do update set secret = excluded.secret, enabled_at = null, last_step = 0, created_at = excluded.created_at`,
+		t.UserID, t.Secret, time.Now().UTC())
+	return err
+}
+
+func (r *TwoFactorRepository) Enable(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update two_factor set enabled_at = ? where user_id = ?", time.Now().UTC(), userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, codeHashes []string) error {
+	_, err := tx.ExecContext(ctx, "delete from recovery_codes where user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, "insert into recovery_codes (code_hash, user_id) values (?, ?)", hash, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TwoFactorRepository) Delete(ctx context.Context, userID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "delete from recovery_codes where user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "delete from two_factor where user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID string, step int64) error {
+	result, err := r.DB.ExecContext(ctx, "update two_factor set last_step = ? where user_id = ? and last_step < ?", step, userID, step)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID string, codeHash string) error {
+	result, err := r.DB.ExecContext(ctx, "update recovery_codes set used_at = ? where user_id = ? and code_hash = ? and used_at is null", time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *TwoFactorRepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, "select count(*) from recovery_codes where user_id = ? and used_at is null", userID).Scan(&count)
+	return count, err
+}
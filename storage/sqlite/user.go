@@ -0,0 +1,296 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type UserRepository struct {
+	DB *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{DB: db}
+}
+
+const selectUsers = `select user_id, site_id, username, email, email_verified_at, password, locale, theme, suspended_at, password_reset_required, created_at, updated_at from users `
+
+func scanUser(s scanner) (domain.User, error) {
+	u := domain.User{}
+	err := s.Scan(&u.ID, &u.SiteID, &u.Username, &u.Email, &u.EmailVerifiedAt, &u.Password, &u.Locale, &u.Theme, &u.SuspendedAt, &u.PasswordResetRequired, &u.CreatedAt, &u.UpdatedAt)
+	return u, err
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id string) (domain.User, error) {
+	u, err := scanUser(r.DB.QueryRowContext(ctx, selectUsers+"where user_id = ?", id))
+	if err != nil {
+		return domain.User{}, notFound(err)
+	}
+	return u, nil
+}
+
+func (r *UserRepository) GetByUsername(ctx context.Context, siteID string, username string) (domain.User, error) {
+	u, err := scanUser(r.DB.QueryRowContext(ctx, selectUsers+"where site_id = ? and username = ?", siteID, username))
+	if err != nil {
+		return domain.User{}, notFound(err)
+	}
+	return u, nil
+}
+
+func (r *UserRepository) List(ctx context.Context, siteID string) ([]domain.User, error) {
+	return r.Search(ctx, domain.UserFilter{SiteID: siteID})
+}
+
+func (r *UserRepository) Search(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	where := "where site_id = ? "
+	args := []any{filter.SiteID}
+	if filter.Query != "" {
+		like := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Query) + "%"
+		where += `and (username like ? escape '\' or email like ? escape '\') `
+		args = append(args, like, like)
+	}
+	switch filter.Status {
+	case domain.UserStatusActive:
+		where += "and suspended_at is null "
+	case domain.UserStatusSuspended:
+		where += "and suspended_at is not null "
+	}
+	rows, err := r.DB.QueryContext(ctx, selectUsers+where+"order by username", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *UserRepository) UsernameExists(ctx context.Context, siteID string, username string) (bool, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, "select count(username) from users where site_id = ? and username = ?", siteID, username).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, siteID string, email string) (domain.User, error) {
+	u, err := scanUser(r.DB.QueryRowContext(ctx, selectUsers+"where site_id = ? and email = ?", siteID, email))
+	if err != nil {
+		return domain.User{}, notFound(err)
+	}
+	return u, nil
+}
+
+func (r *UserRepository) EmailExists(ctx context.Context, siteID string, email string) (bool, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, "select count(email) from users where site_id = ? and email = ?", siteID, email).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *UserRepository) Create(ctx context.Context, u domain.User) error {
+	now := time.Now().UTC()
+	_, err := r.DB.ExecContext(ctx, "insert into users (user_id, site_id, username, email, password, locale, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		u.ID, u.SiteID, u.Username, u.Email, u.Password, u.Locale, now, now)
+	return err
+}
+
+func (r *UserRepository) SignUp(ctx context.Context, s domain.SignUp, now time.Time) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	u := s.User
+	created := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, "insert into users (user_id, site_id, username, email, password, locale, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		u.ID, u.SiteID, u.Username, u.Email, u.Password, u.Locale, created, created)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `insert into user_roles (user_id, role_id)
+        select ?, role_id from roles where site_id = ? and name = ?`, u.ID, u.SiteID, s.Role)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("site %s has no %s role", u.SiteID, s.Role)
+	}
+	if s.InviteCode != "" {
+		var inviterID string
+		err = tx.QueryRowContext(ctx, `update invites set uses = uses + 1
+        where site_id = ? and code = ? and revoked_at is null and uses < max_uses and expires_at > ?
+        returning created_by`, u.SiteID, s.InviteCode, now.UTC()).Scan(&inviterID)
+		if err != nil {
+			return notFound(err)
+		}
+		_, err = tx.ExecContext(ctx, "insert into invitees (user_id, site_id, inviter_id, invite_code, created_at) values (?, ?, ?, ?, ?)",
+			u.ID, u.SiteID, inviterID, s.InviteCode, created)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *UserRepository) SetLocale(ctx context.Context, id string, locale string) error {
+	_, err := r.DB.ExecContext(ctx, "update users set locale = ?, updated_at = ? where user_id = ?", locale, time.Now().UTC(), id)
+	return err
+}
+
+func (r *UserRepository) SetTheme(ctx context.Context, id string, theme string) error {
+	return r.update(ctx, "update users set theme = ?, updated_at = ? where user_id = ?", theme, time.Now().UTC(), id)
+}
+
+func (r *UserRepository) SetEmail(ctx context.Context, id string, email string) error {
+	return r.update(ctx, "update users set email = ?, email_verified_at = null, updated_at = ? where user_id = ?", email, time.Now().UTC(), id)
+}
+
+func (r *UserRepository) SetUsername(ctx context.Context, id string, username string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID, old string
+	err = tx.QueryRowContext(ctx, "select site_id, username from users where user_id = ?", id).Scan(&siteID, &old)
+	if err != nil {
+		return notFound(err)
+	}
+	_, err = tx.ExecContext(ctx, "update users set username = ?, updated_at = ? where user_id = ?", username, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	// The new username no longer redirects to whoever had it before
+	_, err = tx.ExecContext(ctx, "delete from username_redirects where site_id = ? and username = ?", siteID, username)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "insert or replace into username_redirects (site_id, username, user_id, created_at) values (?, ?, ?, ?)",
+		siteID, old, id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *UserRepository) GetByPreviousUsername(ctx context.Context, siteID string, username string) (domain.User, error) {
+	u, err := scanUser(r.DB.QueryRowContext(ctx, selectUsers+"where user_id = (select user_id from username_redirects where site_id = ? and username = ?)", siteID, username))
+	if err != nil {
+		return domain.User{}, notFound(err)
+	}
+	return u, nil
+}
+
+func (r *UserRepository) SetPassword(ctx context.Context, id string, password string) error {
+	_, err := r.DB.ExecContext(ctx, "update users set password = ?, password_reset_required = false, updated_at = ? where user_id = ?", password, time.Now().UTC(), id)
+	return err
+}
+
+func (r *UserRepository) SetPasswordResetRequired(ctx context.Context, id string, required bool) error {
+	return r.update(ctx, "update users set password_reset_required = ?, updated_at = ? where user_id = ?", required, time.Now().UTC(), id)
+}
+
+func (r *UserRepository) SetSuspended(ctx context.Context, id string, suspendedAt *time.Time) error {
+	if suspendedAt != nil {
+		utc := suspendedAt.UTC()
+		suspendedAt = &utc
+	}
+	return r.update(ctx, "update users set suspended_at = ?, updated_at = ? where user_id = ?", suspendedAt, time.Now().UTC(), id)
+}
+
+// Delete relies on the foreign keys to delete the rows that belong to the user.
+func (r *UserRepository) Delete(ctx context.Context, id string, reassignTo string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID string
+	err = tx.QueryRowContext(ctx, "select site_id from users where user_id = ?", id).Scan(&siteID)
+	if err != nil {
+		return notFound(err)
+	}
+	if reassignTo != "" {
+		_, err = tx.ExecContext(ctx, `update users_posts set user_id = ?, updated_at = ? where user_id = ? and relation_type = ?
+            and post_id in (select post_id from posts where site_id = ?)`, reassignTo, time.Now().UTC(), id, domain.RelationAuthor, siteID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "update images set user_id = ? where site_id = ? and user_id = ?", reassignTo, siteID, id)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Images are deleted with the user by the foreign key
+		_, err = tx.ExecContext(ctx, `delete from posts where site_id = ? and post_id in (
+            select post_id from users_posts where user_id = ? and relation_type = ?)`, siteID, id, domain.RelationAuthor)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "delete from users where user_id = ?", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// update runs a statement changing a single user, returning
+// domain.ErrNotFound if there is no such user.
+func (r *UserRepository) update(ctx context.Context, query string, args ...any) error {
+	result, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) SetEmailVerified(ctx context.Context, id string, email string) error {
+	result, err := r.DB.ExecContext(ctx, "update users set email_verified_at = ?, updated_at = ? where user_id = ? and email = ?", time.Now().UTC(), time.Now().UTC(), id, email)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) CountAll(ctx context.Context) (int, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, "select count(*) from users").Scan(&count)
+	return count, err
+}
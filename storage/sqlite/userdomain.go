@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type UserDomainRepository struct {
+	DB *sql.DB
+}
+
+func NewUserDomainRepository(db *sql.DB) *UserDomainRepository {
+	return &UserDomainRepository{DB: db}
+}
+
+const selectUserDomains = `select domain, user_id, site_id, token, verified_at, created_at from user_domains `
+
+func scanUserDomain(s scanner) (domain.UserDomain, error) {
+	d := domain.UserDomain{}
+	err := s.Scan(&d.Domain, &d.UserID, &d.SiteID, &d.Token, &d.VerifiedAt, &d.CreatedAt)
+	return d, err
+}
+
+func (r *UserDomainRepository) GetByUser(ctx context.Context, userID string) (domain.UserDomain, error) {
+	d, err := scanUserDomain(r.DB.QueryRowContext(ctx, selectUserDomains+"where user_id = ?", userID))
+	if err != nil {
+		return domain.UserDomain{}, notFound(err)
+	}
+	return d, nil
+}
+
+func (r *UserDomainRepository) GetVerified(ctx context.Context, hostname string) (domain.UserDomain, error) {
+	d, err := scanUserDomain(r.DB.QueryRowContext(ctx, selectUserDomains+"where domain = ? and verified_at is not null", hostname))
+	if err != nil {
+		return domain.UserDomain{}, notFound(err)
+	}
+	return d, nil
+}
+
+func (r *UserDomainRepository) Save(ctx context.Context, d domain.UserDomain) error {
+	_, err := r.DB.ExecContext(ctx, `insert into user_domains (user_id, site_id, domain, token, verified_at, created_at) values (?, ?, ?, ?, null, ?)
+        on conflict (user_id) do update set site_id = excluded.site_id, domain = excluded.domain, token = excluded.token, verified_at = null, created_at = excluded.created_at`,
+		d.UserID, d.SiteID, d.Domain, d.Token, time.Now().UTC())
+	return err
+}
+
+func (r *UserDomainRepository) MarkVerified(ctx context.Context, userID string) error {
+	result, err := r.DB.ExecContext(ctx, "update user_domains set verified_at = ? where user_id = ?", time.Now().UTC(), userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserDomainRepository) Delete(ctx context.Context, userID string) error {
+	_, err := r.DB.ExecContext(ctx, "delete from user_domains where user_id = ?", userID)
+	return err
+}
@@ -0,0 +1,186 @@
+package sqlite
+
+import (
+	"backyard/domain"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+)
+
+type WebhookRepository struct {
+	DB *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{DB: db}
+}
+
+const selectWebhooks = `select webhook_id, site_id, url, secret, events, active, created_at from webhooks `
+
+func scanWebhook(s scanner) (domain.Webhook, error) {
+	w := domain.Webhook{}
+	var events string
+	err := s.Scan(&w.ID, &w.SiteID, &w.URL, &w.Secret, &events, &w.Active, &w.CreatedAt)
+	w.Events = strings.Fields(events)
+	return w, err
+}
+
+const deliveryColumns = `delivery_id, site_id, webhook_id, event, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, error, created_at`
+
+const selectDeliveries = `select ` + deliveryColumns + ` from webhook_deliveries `
+
+func scanDelivery(s scanner) (domain.WebhookDelivery, error) {
+	d := domain.WebhookDelivery{}
+	err := s.Scan(&d.ID, &d.SiteID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastAttemptAt, &d.ResponseStatus, &d.Error, &d.CreatedAt)
+	return d, err
+}
+
+func (r *WebhookRepository) List(ctx context.Context, siteID string) ([]domain.Webhook, error) {
+	rows, err := r.DB.QueryContext(ctx, selectWebhooks+"where site_id = ? order by created_at", siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []domain.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, siteID string, id string) (domain.Webhook, error) {
+	w, err := scanWebhook(r.DB.QueryRowContext(ctx, selectWebhooks+"where site_id = ? and webhook_id = ?", siteID, id))
+	if err != nil {
+		return domain.Webhook{}, notFound(err)
+	}
+	return w, nil
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, w domain.Webhook) error {
+	_, err := r.DB.ExecContext(ctx, "insert into webhooks (webhook_id, site_id, url, secret, events, active, created_at) values (?, ?, ?, ?, ?, ?, ?)",
+		w.ID, w.SiteID, w.URL, w.Secret, strings.Join(w.Events, " "), w.Active, time.Now().UTC())
+	return err
+}
+
+func (r *WebhookRepository) Update(ctx context.Context, w domain.Webhook) error {
+	result, err := r.DB.ExecContext(ctx, "update webhooks set url = ?, events = ?, active = ? where site_id = ? and webhook_id = ?",
+		w.URL, strings.Join(w.Events, " "), w.Active, w.SiteID, w.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, siteID string, id string) error {
+	result, err := r.DB.ExecContext(ctx, "delete from webhooks where site_id = ? and webhook_id = ?", siteID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, d domain.WebhookDelivery) error {
+	_, err := r.DB.ExecContext(ctx, "insert into webhook_deliveries (delivery_id, site_id, webhook_id, event, payload, status, attempts, next_attempt_at, created_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		d.ID, d.SiteID, d.WebhookID, d.Event, d.Payload, d.Status, d.Attempts, utc(d.NextAttemptAt), time.Now().UTC())
+	return err
+}
+
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, webhookID string, limit int) ([]domain.WebhookDelivery, error) {
+	return r.listDeliveries(ctx, "where webhook_id = ? order by created_at desc limit ?", webhookID, limit)
+}
+
+func (r *WebhookRepository) GetDelivery(ctx context.Context, webhookID string, id string) (domain.WebhookDelivery, error) {
+	d, err := scanDelivery(r.DB.QueryRowContext(ctx, selectDeliveries+"where webhook_id = ? and delivery_id = ?", webhookID, id))
+	if err != nil {
+		return domain.WebhookDelivery{}, notFound(err)
+	}
+	return d, nil
+}
+
+// ClaimDue selects and moves the deliveries in a single statement, which
+// holds the write lock of the database, so no other process claims them in
+// between.
+func (r *WebhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	claim := `update webhook_deliveries set next_attempt_at = ?
+        where delivery_id in (select delivery_id from webhook_deliveries where status = ? and next_attempt_at <= ? order by next_attempt_at limit ?)
+        returning ` + deliveryColumns
+	deliveries, err := r.queryDeliveries(ctx, claim, now.Add(lease).UTC(), domain.DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	// The order of returning is undefined, and the claimed ones all have the
+	// same next attempt now
+	slices.SortFunc(deliveries, func(a, b domain.WebhookDelivery) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) listDeliveries(ctx context.Context, where string, args ...any) ([]domain.WebhookDelivery, error) {
+	return r.queryDeliveries(ctx, selectDeliveries+where, args...)
+}
+
+// queryDeliveries runs query, which returns deliveryColumns.
+func (r *WebhookRepository) queryDeliveries(ctx context.Context, query string, args ...any) ([]domain.WebhookDelivery, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []domain.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, d domain.WebhookDelivery) error {
+	result, err := r.DB.ExecContext(ctx, "update webhook_deliveries set status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?, response_status = ?, error = ? where delivery_id = ?",
+		d.Status, d.Attempts, utc(d.NextAttemptAt), utc(d.LastAttemptAt), d.ResponseStatus, d.Error, d.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// utc returns t in UTC, so it compares with the other stored times.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
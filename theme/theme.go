@@ -0,0 +1,92 @@
+// Package theme resolves the templates and assets of the instance themes.
+//
+// A theme is a directory under themes/ that mirrors the templates/ and assets/
+// layout of the default theme. Files missing from a theme fall back to the
+// default ones, so a theme may override only some templates or stylesheets.
+package theme
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// Default is the theme made of the top level templates/ and assets/ directories.
+const Default = "default"
+
+// Overlay looks up every file in its layers in order and returns the first one
+// found, so a layer may override only some of the files of the next one.
+type Overlay []fs.FS
+
+func (o Overlay) Open(name string) (fs.File, error) {
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir merges the entries of the directory in every layer. Entries of the
+// first layers take precedence.
+func (o Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	entries := []fs.DirEntry{}
+	found := false
+	for _, layer := range o {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Names returns the default theme followed by every theme directory in files.
+func Names(files fs.FS) []string {
+	names := []string{Default}
+	entries, err := fs.ReadDir(files, "themes")
+	if err != nil {
+		return names
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != Default {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// FS returns the files of the named theme, falling back to the default theme
+// for the files the theme does not provide.
+func FS(files fs.FS, name string) fs.FS {
+	if name == Default || !fs.ValidPath(name) {
+		return files
+	}
+	themeFiles, err := fs.Sub(files, path.Join("themes", name))
+	if err != nil {
+		return files
+	}
+	return Overlay{themeFiles, files}
+}
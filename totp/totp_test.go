@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890".
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeRFC6238 checks the SHA1 test vectors of RFC 6238 appendix B. They
+// have 8 digits, of which the codes are the last 6.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.code[2:]; code != want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, code, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(rfcSecret, code[:3]+" "+code[3:], now)
+	if !ok || step != Step(now) {
+		t.Errorf("Validate of the current code = %d, %v, want %d, true", step, ok, Step(now))
+	}
+	step, ok = Validate(rfcSecret, code, now.Add(period*time.Second))
+	if !ok || step != Step(now) {
+		t.Errorf("Validate of the previous step code = %d, %v, want %d, true", step, ok, Step(now))
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(2*period*time.Second)); ok {
+		t.Error("Validate accepted a code two steps old")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now); ok {
+		t.Error("Validate accepted a code with 5 digits")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("Code with a generated secret: %v", err)
+	}
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == other {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+}
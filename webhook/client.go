@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for webhooks sending to the instance itself
+// or to its private network, which anyone able to manage webhooks could
+// otherwise reach through the deliveries.
+var ErrPrivateAddress = errors.New("the webhook address is private")
+
+// CheckURL returns an error if rawURL is not an http or https URL, or its
+// host is a private address. Hostnames are only resolved when sending, so
+// they are checked again then.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("not an http or https URL: %s", rawURL)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && private(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// private reports whether ip is a loopback, private, link-local or otherwise
+// non-public address.
+func private(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// NewClient returns the client sending deliveries. It refuses to connect to
+// private addresses, checked after the hostname is resolved so names
+// pointing to them are refused too, and does not follow redirects, which
+// would otherwise lead it anywhere.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if private(addrPort.Addr()) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			// A proxy would be connected to instead of the webhook
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: requestTimeout,
+			IdleConnTimeout:     90 * time.Second,
+			MaxIdleConns:        100,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
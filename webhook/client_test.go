@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://example.com/hook", nil},
+		{"http://203.0.113.7:8080/hook", nil},
+		{"http://localhost/hook", ErrPrivateAddress},
+		{"http://LOCALHOST./hook", ErrPrivateAddress},
+		{"http://app.localhost/hook", ErrPrivateAddress},
+		{"http://127.0.0.1/hook", ErrPrivateAddress},
+		{"http://10.1.2.3/hook", ErrPrivateAddress},
+		{"http://192.168.1.1/hook", ErrPrivateAddress},
+		{"http://169.254.169.254/latest/meta-data", ErrPrivateAddress},
+		{"http://0.0.0.0/hook", ErrPrivateAddress},
+		{"http://[::1]/hook", ErrPrivateAddress},
+		{"http://[fe80::1]/hook", ErrPrivateAddress},
+		{"http://[fd00::1]/hook", ErrPrivateAddress},
+		{"http://[::ffff:127.0.0.1]/hook", ErrPrivateAddress},
+	}
+	for _, tt := range tests {
+		if err := CheckURL(tt.url); !errors.Is(err, tt.want) {
+			t.Errorf("CheckURL(%s) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+	for _, url := range []string{"ftp://example.com/hook", "https:///hook", "hook"} {
+		if err := CheckURL(url); err == nil {
+			t.Errorf("CheckURL(%s) accepted it", url)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the client connected to a loopback address")
+	}))
+	defer server.Close()
+
+	// The name is only resolved to the loopback address when dialing
+	_, err := NewClient().Post(strings.Replace(server.URL, "127.0.0.1", "localhost", 1), "application/json", nil)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("posting to localhost: %v, want %v", err, ErrPrivateAddress)
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hook" {
+			t.Errorf("the client followed the redirect to %s", r.URL)
+		}
+		http.Redirect(w, r, "/internal", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// The test server is on a loopback address, which the transport of the
+	// client refuses
+	client := NewClient()
+	client.Transport = server.Client().Transport
+	resp, err := client.Post(server.URL+"/hook", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+}
@@ -0,0 +1,182 @@
+// Package webhook delivers the events of the sites to the webhooks subscribed
+// to them, retrying failed deliveries with exponential backoff.
+package webhook
+
+import (
+	"backyard/domain"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Headers of the requests sent to webhooks.
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body,
+	// keyed with the secret of the webhook.
+	SignatureHeader = "X-Backyard-Signature"
+	EventHeader     = "X-Backyard-Event"
+	DeliveryHeader  = "X-Backyard-Delivery"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before giving up. With
+	// the backoff that is about an hour after the first attempt.
+	MaxAttempts = 8
+	// firstRetryDelay is the wait after the first failed attempt, doubled
+	// after each of the next ones.
+	firstRetryDelay = 30 * time.Second
+	requestTimeout  = 10 * time.Second
+	// pollInterval is how often pending deliveries are looked for, besides
+	// when the dispatcher is notified of new ones.
+	pollInterval = 10 * time.Second
+	batchSize    = 20
+	// claimLease is how long the deliveries of a batch are claimed by the
+	// process sending them, longer than sending all of them may take.
+	claimLease = batchSize*requestTimeout + time.Minute
+)
+
+// Sign returns the value of SignatureHeader for payload.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before retrying a delivery that failed
+// attempts times.
+func Backoff(attempts int) time.Duration {
+	return firstRetryDelay << (attempts - 1)
+}
+
+// Dispatcher sends the pending deliveries stored in the repository. They are
+// kept in the database, so deliveries left over when the process stops are
+// sent after it starts again, and claimed before being sent, so processes
+// sharing the database send each one once.
+type Dispatcher struct {
+	Webhooks domain.WebhookRepository
+	Client   *http.Client
+	wake     chan struct{}
+}
+
+func NewDispatcher(webhooks domain.WebhookRepository) *Dispatcher {
+	return &Dispatcher{
+		Webhooks: webhooks,
+		Client:   NewClient(),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Notify tells the dispatcher there are new deliveries, so they are sent
+// without waiting for the next poll.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the due deliveries until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		d.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := d.Webhooks.ClaimDue(ctx, time.Now(), claimLease, batchSize)
+		if err != nil {
+			slog.ErrorContext(ctx, "claiming due webhook deliveries", "error", err)
+			return
+		}
+		for _, delivery := range due {
+			if ctx.Err() != nil {
+				return
+			}
+			if _, err := d.Attempt(ctx, delivery); err != nil {
+				slog.ErrorContext(ctx, "attempting webhook delivery", "delivery_id", delivery.ID, "error", err)
+			}
+		}
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+// Attempt sends a delivery once and saves the result: delivered, pending
+// for a later retry, or failed once it ran out of attempts. The request is
+// not interrupted when ctx is cancelled, only by its timeout.
+func (d *Dispatcher) Attempt(ctx context.Context, delivery domain.WebhookDelivery) (domain.WebhookDelivery, error) {
+	ctx = context.WithoutCancel(ctx)
+	webhook, err := d.Webhooks.GetByID(ctx, delivery.SiteID, delivery.WebhookID)
+	if err != nil {
+		return delivery, err
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.NextAttemptAt = nil
+	delivery.Error = ""
+	if webhook.Active {
+		delivery.ResponseStatus, err = d.send(ctx, webhook, delivery)
+	} else {
+		delivery.ResponseStatus, err = 0, fmt.Errorf("the webhook is disabled")
+	}
+	switch {
+	case err == nil:
+		delivery.Status = domain.DeliveryDelivered
+	case !webhook.Active || delivery.Attempts >= MaxAttempts:
+		delivery.Status = domain.DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		next := now.Add(Backoff(delivery.Attempts))
+		delivery.Status = domain.DeliveryPending
+		delivery.NextAttemptAt = &next
+		delivery.Error = err.Error()
+	}
+	return delivery, d.Webhooks.UpdateDelivery(ctx, delivery)
+}
+
+// send posts the payload of the delivery to the webhook, and returns the
+// status of the response. Only 2xx statuses count as delivered.
+func (d *Dispatcher) send(ctx context.Context, webhook domain.Webhook, delivery domain.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Backyard-Webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Reading the body lets the connection be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
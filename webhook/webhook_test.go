@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"backyard/domain"
+	"backyard/storage/memory"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatchersSendEachDeliveryOnce(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.Header.Get(DeliveryHeader)]++
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	webhooks := memory.NewWebhookRepository()
+	webhook := domain.Webhook{ID: "webhook", SiteID: domain.DefaultSiteID, URL: server.URL, Secret: "secret", Events: domain.Events, Active: true}
+	if err := webhooks.Create(ctx, webhook); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	deliveries := 3 * batchSize
+	for i := range deliveries {
+		err := webhooks.CreateDelivery(ctx, domain.WebhookDelivery{
+			ID:            fmt.Sprint("delivery-", i),
+			SiteID:        webhook.SiteID,
+			WebhookID:     webhook.ID,
+			Event:         domain.EventPostPublished,
+			Payload:       []byte("{}"),
+			Status:        domain.DeliveryPending,
+			NextAttemptAt: &now,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Like processes sharing the database
+	var wg sync.WaitGroup
+	for range 3 {
+		d := NewDispatcher(webhooks)
+		// The test server is on a loopback address
+		d.Client = server.Client()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliverDue(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if len(received) != deliveries {
+		t.Errorf("%d deliveries received, want %d", len(received), deliveries)
+	}
+	for id, count := range received {
+		if count != 1 {
+			t.Errorf("%s received %d times", id, count)
+		}
+	}
+	if due, err := webhooks.ClaimDue(ctx, time.Now().Add(claimLease), claimLease, batchSize); err != nil || len(due) != 0 {
+		t.Errorf("due deliveries after sending them: %d, %v", len(due), err)
+	}
+}